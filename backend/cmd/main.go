@@ -1,10 +1,15 @@
 package main
 
 import (
+    "context"
     "log"
+    "os"
+    "strconv"
+    "taskflow/internal/auth"
     "taskflow/internal/config"
     "taskflow/internal/handlers"
     "taskflow/internal/middleware"
+    "taskflow/internal/services"
     
     "github.com/gin-gonic/gin"
 )
@@ -14,9 +19,22 @@ func main() {
     if err != nil {
         log.Fatal("Erro ao conectar com banco de dados:", err)
     }
+    if err := auth.CheckTokenKeys(); err != nil {
+        log.Fatal("Erro nas chaves de criptografia de tokens:", err)
+    }
+    if err := services.CheckTaskWorkflow(); err != nil {
+        log.Fatal("Erro no workflow de tarefas:", err)
+    }
 
     handlers.InitDB(db)
     
+    syncWorkers := 4
+    if n, err := strconv.Atoi(os.Getenv("SYNC_WORKERS")); err == nil && n > 0 {
+        syncWorkers = n
+    }
+    services.NewSyncWorker(db).Start(context.Background(), syncWorkers)
+    services.StartRebalancer(context.Background(), db)
+    
     calendarHandler := handlers.NewCalendarHandler(db)
     
     r := gin.Default()
@@ -27,24 +45,121 @@ func main() {
     {
         public.POST("/auth/register", handlers.Register)
         public.POST("/auth/login", handlers.Login)
+        public.POST("/calendar/webhooks/google", calendarHandler.GoogleWebhook)
+        public.GET("/feeds/:token/tasks.ics", handlers.GetTaskFeed)
+    }
+    
+    // CalDAV server, clients sign in with app passwords
+    r.Handle("PROPFIND", "/.well-known/caldav", handlers.CalDAVWellKnown)
+    r.GET("/.well-known/caldav", handlers.CalDAVWellKnown)
+    r.OPTIONS("/dav/*path", handlers.CalDAVOptions)
+    dav := r.Group("/dav")
+    dav.Use(middleware.AppPasswordAuth(db))
+    for _, method := range handlers.CalDAVMethods {
+        dav.Handle(method, "/*path", handlers.ServeCalDAV)
+    }
+    
+    // Workspaces are picked by path here rather than by token, so a token
+    // can always be switched away from a workspace the user has left
+    workspaces := r.Group("/api")
+    workspaces.Use(middleware.AuthMiddleware())
+    {
+        workspaces.POST("/auth/workspace", handlers.SwitchWorkspace)
+        workspaces.GET("/workspaces", handlers.GetWorkspaces)
+        workspaces.POST("/workspaces", handlers.CreateWorkspace)
+        workspaces.GET("/workspaces/:id", handlers.GetWorkspace)
+        workspaces.PUT("/workspaces/:id", handlers.UpdateWorkspace)
+        workspaces.DELETE("/workspaces/:id", handlers.DeleteWorkspace)
+        workspaces.GET("/workspaces/:id/members", handlers.GetMembers)
+        workspaces.POST("/workspaces/:id/members", handlers.AddMember)
+        workspaces.PUT("/workspaces/:id/members/:user_id", handlers.UpdateMember)
+        workspaces.DELETE("/workspaces/:id/members/:user_id", handlers.RemoveMember)
     }
     
     protected := r.Group("/api")
-    protected.Use(middleware.AuthMiddleware())
+    protected.Use(middleware.AuthMiddleware(), middleware.Workspace(db))
     {
         // Tasks routes
         protected.GET("/tasks", handlers.GetTasks)
         protected.POST("/tasks", handlers.CreateTask)
+        protected.GET("/tasks/search", handlers.SearchTasks)
         protected.GET("/tasks/:id", handlers.GetTask)
         protected.PUT("/tasks/:id", handlers.UpdateTask)
+        protected.PATCH("/tasks/:id", handlers.PatchTask)
         protected.DELETE("/tasks/:id", handlers.DeleteTask)
+        protected.POST("/tasks/:id/move", handlers.MoveTask)
+        protected.GET("/tasks/:id/subtasks", handlers.GetSubtasks)
+        protected.POST("/tasks/:id/subtasks", handlers.CreateSubtask)
+        protected.GET("/tasks/:id/dependencies", handlers.GetDependencies)
+        protected.POST("/tasks/:id/dependencies", handlers.AddDependency)
+        protected.DELETE("/tasks/:id/dependencies/:other_id", handlers.RemoveDependency)
+        protected.POST("/tasks/:id/skip", handlers.SkipOccurrence)
+        protected.POST("/tasks/:id/end-series", handlers.EndSeries)
+        protected.PUT("/tasks/:id/labels", handlers.SetTaskLabels)
+        protected.POST("/tasks/:id/labels/:label_id", handlers.AddTaskLabel)
+        protected.DELETE("/tasks/:id/labels/:label_id", handlers.RemoveTaskLabel)
+        protected.PUT("/tasks/:id/assignee", handlers.AssignTask)
+        protected.DELETE("/tasks/:id/assignee", handlers.UnassignTask)
+        protected.GET("/tasks/:id/assignments", handlers.GetAssignments)
+        protected.POST("/tasks/:id/watchers", handlers.WatchTask)
+        protected.DELETE("/tasks/:id/watchers", handlers.UnwatchTask)
+
+        // Checklist items of a task
+        protected.GET("/tasks/:id/checklist", handlers.GetChecklist)
+        protected.POST("/tasks/:id/checklist", handlers.CreateChecklistItem)
+        protected.PUT("/tasks/:id/checklist/order", handlers.ReorderChecklist)
+        protected.PATCH("/tasks/:id/checklist/:item_id", handlers.UpdateChecklistItem)
+        protected.DELETE("/tasks/:id/checklist/:item_id", handlers.DeleteChecklistItem)
+
+        // Projects
+        protected.GET("/projects", handlers.GetProjects)
+        protected.POST("/projects", handlers.CreateProject)
+        protected.GET("/projects/:id", handlers.GetProject)
+        protected.PUT("/projects/:id", handlers.UpdateProject)
+        protected.DELETE("/projects/:id", handlers.DeleteProject)
+        protected.GET("/projects/:id/tasks", handlers.GetProjectTasks)
+        protected.GET("/projects/:id/stats", handlers.GetProjectStats)
+
+        // Labels
+        protected.GET("/labels", handlers.GetLabels)
+        protected.POST("/labels", handlers.CreateLabel)
+        protected.PUT("/labels/:id", handlers.UpdateLabel)
+        protected.DELETE("/labels/:id", handlers.DeleteLabel)
+        protected.POST("/labels/:id/merge", handlers.MergeLabel)
+
+        // App passwords for CalDAV clients
+        protected.GET("/app-passwords", handlers.GetAppPasswords)
+        protected.POST("/app-passwords", handlers.CreateAppPassword)
+        protected.DELETE("/app-passwords/:id", handlers.DeleteAppPassword)
+
+        // Calendar feed routes
+        protected.GET("/feeds", handlers.GetFeeds)
+        protected.POST("/feeds", handlers.CreateFeed)
+        protected.PUT("/feeds/:id", handlers.UpdateFeed)
+        protected.POST("/feeds/:id/regenerate", handlers.RegenerateFeedToken)
+        protected.DELETE("/feeds/:id", handlers.DeleteFeed)
 
         // Calendar routes
-        protected.POST("/calendar/auth", calendarHandler.InitGoogleAuth)
-        protected.POST("/calendar/callback", calendarHandler.HandleGoogleCallback)
+        protected.POST("/calendar/auth", calendarHandler.InitAuth)
+        protected.POST("/calendar/callback", calendarHandler.HandleCallback)
         protected.POST("/calendar/sync", calendarHandler.ToggleCalendarSync)
-        protected.GET("/calendar/status/:user_id", calendarHandler.GetSyncStatus)
-        protected.POST("/calendar/disconnect/:user_id", calendarHandler.DisconnectGoogle)
+        protected.GET("/calendar/status", calendarHandler.GetSyncStatus)
+        protected.POST("/calendar/disconnect", calendarHandler.DisconnectCalendar)
+        protected.GET("/calendar/settings", calendarHandler.GetCalendarSettings)
+        protected.PUT("/calendar/settings", calendarHandler.UpdateCalendarSettings)
+        protected.GET("/calendar/events", calendarHandler.ListEvents)
+        protected.POST("/calendar/events", calendarHandler.CreateEvent)
+        protected.PUT("/calendar/events/:id", calendarHandler.UpdateEvent)
+        protected.DELETE("/calendar/events/:id", calendarHandler.DeleteEvent)
+        protected.GET("/calendar/connections", calendarHandler.ListConnections)
+        protected.POST("/calendar/connections/caldav", calendarHandler.ConnectCalDAV)
+        protected.POST("/calendar/connections/:provider/auth", calendarHandler.InitAuth)
+        protected.POST("/calendar/connections/:provider/callback", calendarHandler.HandleCallback)
+        protected.DELETE("/calendar/connections/:provider", calendarHandler.DisconnectCalendar)
+
+        // Deprecated aliases, the user always comes from the JWT
+        protected.GET("/calendar/status/:user_id", middleware.DeprecatedUserParam("user_id"), calendarHandler.GetSyncStatus)
+        protected.POST("/calendar/disconnect/:user_id", middleware.DeprecatedUserParam("user_id"), calendarHandler.DisconnectCalendar)
     }
     
     r.Run(":8080")
@@ -0,0 +1,86 @@
+// Command reencrypt-tokens migrates stored calendar credentials to the
+// active encryption key. It encrypts credentials still stored as plaintext
+// or in the "v1" format, and re-wraps the data key of credentials encrypted
+// with a rotated-out key. Run it after changing TOKEN_ENCRYPTION_ACTIVE_KEY,
+// before removing the old key from TOKEN_ENCRYPTION_KEYS.
+package main
+
+import (
+    "flag"
+    "log"
+    "taskflow/internal/auth"
+    "taskflow/internal/config"
+    "taskflow/internal/models"
+    "taskflow/internal/services"
+)
+
+func main() {
+    dryRun := flag.Bool("dry-run", false, "report how many tokens would change without writing")
+    batchSize := flag.Int("batch-size", 100, "number of connections loaded per batch")
+    flag.Parse()
+
+    db, err := config.InitDatabase()
+    if err != nil {
+        log.Fatal("Erro ao conectar com banco de dados:", err)
+    }
+
+    var migrated, failed int
+    var lastID uint
+    for {
+        var connections []models.CalendarConnection
+        err := db.Select("id", "provider", "credentials").
+            Where("id > ? AND credentials <> ''", lastID).
+            Order("id").
+            Limit(*batchSize).
+            Find(&connections).Error
+        if err != nil {
+            log.Fatal("Erro ao carregar conexões:", err)
+        }
+        if len(connections) == 0 {
+            break
+        }
+
+        for _, conn := range connections {
+            lastID = conn.ID
+
+            needed, err := auth.TokenNeedsReencryption(conn.Credentials)
+            if err != nil {
+                log.Fatal("Erro ao verificar token:", err)
+            }
+            if !needed {
+                continue
+            }
+
+            encrypted, err := services.ReencryptCredentials(&conn)
+            if err != nil {
+                log.Printf("connection %d: failed to re-encrypt credentials: %v", conn.ID, err)
+                failed++
+                continue
+            }
+
+            if *dryRun {
+                migrated++
+                continue
+            }
+
+            // Only overwrite the value we read, a concurrent refresh wins
+            result := db.Model(&models.CalendarConnection{}).
+                Where("id = ? AND credentials = ?", conn.ID, conn.Credentials).
+                UpdateColumn("credentials", encrypted)
+            if result.Error != nil {
+                log.Printf("connection %d: failed to save credentials: %v", conn.ID, result.Error)
+                failed++
+                continue
+            }
+            if result.RowsAffected > 0 {
+                migrated++
+            }
+        }
+    }
+
+    if *dryRun {
+        log.Printf("%d tokens need re-encryption, %d could not be re-encrypted", migrated, failed)
+    } else {
+        log.Printf("%d tokens re-encrypted, %d failed", migrated, failed)
+    }
+}
@@ -9,10 +9,20 @@ import (
     "golang.org/x/crypto/bcrypt"
 )
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+// jwtSecret signs tokens, with a fallback for development without
+// JWT_SECRET so tokens issued there still validate.
+var jwtSecret = func() []byte {
+    if secret := os.Getenv("JWT_SECRET"); secret != "" {
+        return []byte(secret)
+    }
+    return []byte("fallback-secret-key")
+}()
 
+// Claims identify the user of a token and, when set, the workspace they
+// work in.
 type Claims struct {
-    UserID uint `json:"user_id"`
+    UserID      uint `json:"user_id"`
+    WorkspaceID uint `json:"workspace_id,omitempty"`
     jwt.RegisteredClaims
 }
 
@@ -27,10 +37,17 @@ func CheckPasswordHash(password, hash string) bool {
 }
 
 func GenerateJWT(userID uint) (string, error) {
+    return GenerateWorkspaceJWT(userID, 0)
+}
+
+// GenerateWorkspaceJWT issues a token working in a workspace, or in the
+// user's own tasks when workspaceID is 0.
+func GenerateWorkspaceJWT(userID, workspaceID uint) (string, error) {
     expirationTime := time.Now().Add(24 * time.Hour)
     
     claims := &Claims{
-        UserID: userID,
+        UserID:      userID,
+        WorkspaceID: workspaceID,
         RegisteredClaims: jwt.RegisteredClaims{
             ExpiresAt: jwt.NewNumericDate(expirationTime),
             IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -42,10 +59,6 @@ func GenerateJWT(userID uint) (string, error) {
 }
 
 func ValidateJWT(tokenString string) (*Claims, error) {
-    if len(jwtSecret) == 0 {
-        jwtSecret = []byte("fallback-secret-key")
-    }
-    
     claims := &Claims{}
     token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
         return jwtSecret, nil
@@ -0,0 +1,27 @@
+package auth
+
+import (
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+)
+
+// GenerateSecretToken returns a random URL-safe token and the hash to store
+// in its place. The token itself is only shown to the user once.
+func GenerateSecretToken() (token, hash string, err error) {
+    b := make([]byte, 32)
+    if _, err := rand.Read(b); err != nil {
+        return "", "", err
+    }
+
+    token = base64.RawURLEncoding.EncodeToString(b)
+    return token, HashSecretToken(token), nil
+}
+
+// HashSecretToken hashes a token for lookup. Tokens are random, so a plain
+// SHA-256 is enough and keeps the lookup a simple equality.
+func HashSecretToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,296 @@
+package auth
+
+import (
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/rand"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+    "sync"
+)
+
+// Encrypted values look like "v2:<key id>:<wrapped data key>:<ciphertext>".
+// Every value gets its own random data key, which is sealed with the
+// master key named by the key id (envelope encryption). Rotating the master
+// key therefore only needs the small data keys to be re-wrapped, which is
+// what ReencryptToken does, and old values keep decrypting as long as their
+// key stays configured.
+//
+// The ciphertext is bound to the additional data given by the caller, the
+// row the value is stored in, so it can't be copied to another row. "v1"
+// values predate that and are sealed without additional data.
+const (
+    encryptedTokenVersion = "v2"
+    legacyTokenVersion    = "v1"
+)
+
+var (
+    ErrTokenKeysNotConfigured  = errors.New("TOKEN_ENCRYPTION_KEYS is not configured")
+    ErrUnknownTokenKey         = errors.New("token was encrypted with an unknown key")
+    ErrMalformedEncryptedToken = errors.New("malformed encrypted token")
+)
+
+type tokenKeyring struct {
+    activeKeyID string
+    keys        map[string][]byte
+}
+
+var (
+    keyringOnce sync.Once
+    keyring     *tokenKeyring
+    keyringErr  error
+)
+
+// loadTokenKeyring reads the master keys from the environment:
+// TOKEN_ENCRYPTION_KEYS is a comma separated list of "<id>:<base64 key>"
+// entries holding 32 byte AES keys, and TOKEN_ENCRYPTION_ACTIVE_KEY names
+// the one used for new values (defaults to the first entry).
+func loadTokenKeyring() (*tokenKeyring, error) {
+    keyringOnce.Do(func() {
+        keyring, keyringErr = parseTokenKeyring(os.Getenv("TOKEN_ENCRYPTION_KEYS"), os.Getenv("TOKEN_ENCRYPTION_ACTIVE_KEY"))
+    })
+    return keyring, keyringErr
+}
+
+// CheckTokenKeys reports whether the master keys are configured and valid,
+// so a misconfiguration is caught at startup rather than on the first
+// calendar connection.
+func CheckTokenKeys() error {
+    _, err := loadTokenKeyring()
+    return err
+}
+
+func parseTokenKeyring(rawKeys, activeKeyID string) (*tokenKeyring, error) {
+    if strings.TrimSpace(rawKeys) == "" {
+        return nil, ErrTokenKeysNotConfigured
+    }
+
+    kr := &tokenKeyring{keys: make(map[string][]byte)}
+    for _, entry := range strings.Split(rawKeys, ",") {
+        id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+        if !ok || id == "" {
+            return nil, fmt.Errorf("invalid TOKEN_ENCRYPTION_KEYS entry %q", entry)
+        }
+
+        key, err := base64.StdEncoding.DecodeString(encoded)
+        if err != nil || len(key) != 32 {
+            return nil, fmt.Errorf("key %q must be 32 bytes encoded as base64", id)
+        }
+
+        kr.keys[id] = key
+        if kr.activeKeyID == "" {
+            kr.activeKeyID = id
+        }
+    }
+
+    if activeKeyID != "" {
+        if _, ok := kr.keys[activeKeyID]; !ok {
+            return nil, fmt.Errorf("active key %q is not in TOKEN_ENCRYPTION_KEYS", activeKeyID)
+        }
+        kr.activeKeyID = activeKeyID
+    }
+
+    return kr, nil
+}
+
+// EncryptToken seals a secret with the active master key, bound to aad.
+func EncryptToken(plaintext, aad string) (string, error) {
+    kr, err := loadTokenKeyring()
+    if err != nil {
+        return "", err
+    }
+
+    dataKey := make([]byte, 32)
+    if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+        return "", err
+    }
+
+    ciphertext, err := seal(dataKey, []byte(plaintext), []byte(aad))
+    if err != nil {
+        return "", err
+    }
+
+    return wrapToken(kr, dataKey, ciphertext)
+}
+
+// wrapToken seals the data key with the active master key and formats the
+// stored value.
+func wrapToken(kr *tokenKeyring, dataKey, ciphertext []byte) (string, error) {
+    wrappedKey, err := seal(kr.keys[kr.activeKeyID], dataKey, nil)
+    if err != nil {
+        return "", err
+    }
+
+    return strings.Join([]string{
+        encryptedTokenVersion,
+        kr.activeKeyID,
+        base64.RawURLEncoding.EncodeToString(wrappedKey),
+        base64.RawURLEncoding.EncodeToString(ciphertext),
+    }, ":"), nil
+}
+
+// DecryptToken opens a value produced by EncryptToken with the same aad.
+// Values stored before encryption was introduced are returned unchanged so
+// existing users keep working until the re-encryption command has run.
+func DecryptToken(value, aad string) (string, error) {
+    if !IsEncryptedToken(value) {
+        return value, nil
+    }
+
+    kr, err := loadTokenKeyring()
+    if err != nil {
+        return "", err
+    }
+
+    parts, err := splitToken(value)
+    if err != nil {
+        return "", err
+    }
+
+    dataKey, err := unwrapToken(kr, parts)
+    if err != nil {
+        return "", err
+    }
+
+    ciphertext, err := base64.RawURLEncoding.DecodeString(parts[3])
+    if err != nil {
+        return "", ErrMalformedEncryptedToken
+    }
+
+    var additionalData []byte
+    if parts[0] == encryptedTokenVersion {
+        additionalData = []byte(aad)
+    }
+    plaintext, err := open(dataKey, ciphertext, additionalData)
+    if err != nil {
+        return "", err
+    }
+
+    return string(plaintext), nil
+}
+
+// ReencryptToken moves a stored value to the active master key. Values
+// already in the current format only get their data key re-wrapped; the
+// ciphertext is kept as is. Plaintext and "v1" values are encrypted again
+// so they become bound to aad.
+func ReencryptToken(value, aad string) (string, error) {
+    if !IsEncryptedToken(value) || strings.HasPrefix(value, legacyTokenVersion+":") {
+        plaintext, err := DecryptToken(value, aad)
+        if err != nil {
+            return "", err
+        }
+        return EncryptToken(plaintext, aad)
+    }
+
+    kr, err := loadTokenKeyring()
+    if err != nil {
+        return "", err
+    }
+
+    parts, err := splitToken(value)
+    if err != nil {
+        return "", err
+    }
+
+    dataKey, err := unwrapToken(kr, parts)
+    if err != nil {
+        return "", err
+    }
+
+    ciphertext, err := base64.RawURLEncoding.DecodeString(parts[3])
+    if err != nil {
+        return "", ErrMalformedEncryptedToken
+    }
+
+    return wrapToken(kr, dataKey, ciphertext)
+}
+
+func splitToken(value string) ([]string, error) {
+    parts := strings.Split(value, ":")
+    if len(parts) != 4 {
+        return nil, ErrMalformedEncryptedToken
+    }
+    return parts, nil
+}
+
+// unwrapToken opens the data key of a split value with its master key.
+func unwrapToken(kr *tokenKeyring, parts []string) ([]byte, error) {
+    masterKey, ok := kr.keys[parts[1]]
+    if !ok {
+        return nil, fmt.Errorf("%w: %s", ErrUnknownTokenKey, parts[1])
+    }
+
+    wrappedKey, err := base64.RawURLEncoding.DecodeString(parts[2])
+    if err != nil {
+        return nil, ErrMalformedEncryptedToken
+    }
+
+    return open(masterKey, wrappedKey, nil)
+}
+
+func IsEncryptedToken(value string) bool {
+    return strings.HasPrefix(value, encryptedTokenVersion+":") || strings.HasPrefix(value, legacyTokenVersion+":")
+}
+
+// TokenNeedsReencryption reports whether a stored value is still plaintext,
+// in the "v1" format or sealed with a key other than the active one.
+func TokenNeedsReencryption(value string) (bool, error) {
+    if value == "" {
+        return false, nil
+    }
+    if !strings.HasPrefix(value, encryptedTokenVersion+":") {
+        return true, nil
+    }
+
+    kr, err := loadTokenKeyring()
+    if err != nil {
+        return false, err
+    }
+
+    parts := strings.SplitN(value, ":", 3)
+    if len(parts) < 3 {
+        return false, ErrMalformedEncryptedToken
+    }
+    return parts[1] != kr.activeKeyID, nil
+}
+
+// seal encrypts with AES-GCM and prepends the random nonce.
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+    gcm, err := newGCM(key)
+    if err != nil {
+        return nil, err
+    }
+
+    nonce := make([]byte, gcm.NonceSize())
+    if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+        return nil, err
+    }
+
+    return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(key, sealed, additionalData []byte) ([]byte, error) {
+    gcm, err := newGCM(key)
+    if err != nil {
+        return nil, err
+    }
+
+    if len(sealed) < gcm.NonceSize() {
+        return nil, ErrMalformedEncryptedToken
+    }
+
+    nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+    return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+    block, err := aes.NewCipher(key)
+    if err != nil {
+        return nil, err
+    }
+    return cipher.NewGCM(block)
+}
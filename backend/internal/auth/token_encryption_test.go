@@ -0,0 +1,105 @@
+package auth
+
+import (
+    "encoding/base64"
+    "strings"
+    "testing"
+)
+
+func useTestKeys(t *testing.T, rawKeys, activeKeyID string) {
+    t.Helper()
+
+    kr, err := parseTokenKeyring(rawKeys, activeKeyID)
+    if err != nil {
+        t.Fatal(err)
+    }
+    keyringOnce.Do(func() {})
+    keyring, keyringErr = kr, nil
+}
+
+func testKey(b byte) string {
+    return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32)))
+}
+
+func TestTokenIsBoundToItsRow(t *testing.T) {
+    useTestKeys(t, "k1:"+testKey('a'), "")
+
+    value, err := EncryptToken("secret", "calendar_connection:1:google")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if got, err := DecryptToken(value, "calendar_connection:1:google"); err != nil || got != "secret" {
+        t.Fatalf("got %q, %v, want secret", got, err)
+    }
+    if _, err := DecryptToken(value, "calendar_connection:2:google"); err == nil {
+        t.Error("a value copied to another row decrypted")
+    }
+}
+
+func TestReencryptTokenRewrapsTheDataKey(t *testing.T) {
+    useTestKeys(t, "k1:"+testKey('a'), "")
+    value, err := EncryptToken("secret", "row")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    useTestKeys(t, "k1:"+testKey('a')+",k2:"+testKey('b'), "k2")
+    if needed, err := TokenNeedsReencryption(value); err != nil || !needed {
+        t.Fatalf("got %v, %v, want the old key to need re-encryption", needed, err)
+    }
+
+    rewrapped, err := ReencryptToken(value, "row")
+    if err != nil {
+        t.Fatal(err)
+    }
+    old, rotated := strings.Split(value, ":"), strings.Split(rewrapped, ":")
+    if rotated[1] != "k2" || rotated[3] != old[3] {
+        t.Errorf("got %s, want the k2 key around the same ciphertext", rewrapped)
+    }
+
+    useTestKeys(t, "k2:"+testKey('b'), "")
+    if got, err := DecryptToken(rewrapped, "row"); err != nil || got != "secret" {
+        t.Errorf("got %q, %v after removing k1, want secret", got, err)
+    }
+}
+
+func TestReencryptTokenBindsLegacyValues(t *testing.T) {
+    useTestKeys(t, "k1:"+testKey('a'), "")
+
+    for _, value := range []string{"plain secret", legacyToken(t, "plain secret")} {
+        if needed, err := TokenNeedsReencryption(value); err != nil || !needed {
+            t.Errorf("%.10s: got %v, %v, want re-encryption needed", value, needed, err)
+        }
+        if got, err := DecryptToken(value, "row"); err != nil || got != "plain secret" {
+            t.Errorf("%.10s: got %q, %v before migrating", value, got, err)
+        }
+
+        migrated, err := ReencryptToken(value, "row")
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !strings.HasPrefix(migrated, encryptedTokenVersion+":") {
+            t.Errorf("got %s, want the current format", migrated)
+        }
+        if _, err := DecryptToken(migrated, "other row"); err == nil {
+            t.Errorf("%.10s: the migrated value is not bound to its row", value)
+        }
+    }
+}
+
+// legacyToken builds a "v1" value, sealed without additional data.
+func legacyToken(t *testing.T, plaintext string) string {
+    t.Helper()
+
+    dataKey := []byte(strings.Repeat("d", 32))
+    ciphertext, err := seal(dataKey, []byte(plaintext), nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    value, err := wrapToken(keyring, dataKey, ciphertext)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return legacyTokenVersion + strings.TrimPrefix(value, encryptedTokenVersion)
+}
@@ -21,11 +21,152 @@ func InitDatabase() (*gorm.DB, error) {
         return nil, fmt.Errorf("erro ao conectar com banco: %w", err)
     }
     
-    err = db.AutoMigrate(&models.User{}, &models.Task{})
+    err = db.AutoMigrate(
+        &models.User{},
+        &models.Task{},
+        &models.SyncJob{},
+        &models.OAuthState{},
+        &models.CalendarConnection{},
+        &models.TaskEventMapping{},
+        &models.CalendarFeed{},
+        &models.AppPassword{},
+        &models.CalDAVObject{},
+        &models.ChecklistItem{},
+        &models.TaskDependency{},
+        &models.Label{},
+        &models.TaskLabel{},
+        &models.Project{},
+        &models.Workspace{},
+        &models.WorkspaceMember{},
+        &models.TaskWatcher{},
+        &models.AssignmentChange{},
+    )
     if err != nil {
         return nil, fmt.Errorf("erro ao migrar banco: %w", err)
     }
+
+    if err := migrateLegacyCalendarColumns(db); err != nil {
+        return nil, fmt.Errorf("erro ao migrar conexões de calendário: %w", err)
+    }
+
+    if err := migrateTaskSearch(db); err != nil {
+        return nil, fmt.Errorf("erro ao criar índice de busca: %w", err)
+    }
+
+    if err := migrateLabelNames(db); err != nil {
+        return nil, fmt.Errorf("erro ao criar índice de etiquetas: %w", err)
+    }
     
     log.Println("Banco de dados conectado e migrado com sucesso!")
     return db, nil
 }
+
+// migrateTaskSearch adds the search_vector column used by the task search, a
+// generated tsvector of the title (weight A) and description (weight B), and
+// its GIN index. Both are indexed in Portuguese and English so queries can be
+// stemmed in either language.
+func migrateTaskSearch(db *gorm.DB) error {
+    err := db.Exec(`
+        ALTER TABLE tasks ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+            setweight(to_tsvector('portuguese', COALESCE(title, '')), 'A') ||
+            setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+            setweight(to_tsvector('portuguese', COALESCE(description, '')), 'B') ||
+            setweight(to_tsvector('english', COALESCE(description, '')), 'B')
+        ) STORED`).Error
+    if err != nil {
+        return err
+    }
+
+    return db.Exec(`CREATE INDEX IF NOT EXISTS idx_tasks_search_vector ON tasks USING GIN (search_vector)`).Error
+}
+
+// migrateLabelNames keeps label names unique regardless of case within the
+// space they belong to: a user's own labels, or a workspace's. It replaces
+// the per-user index labels had before workspaces.
+func migrateLabelNames(db *gorm.DB) error {
+    if err := db.Exec(`DROP INDEX IF EXISTS idx_labels_user_name`).Error; err != nil {
+        return err
+    }
+
+    return db.Exec(`
+        CREATE UNIQUE INDEX IF NOT EXISTS idx_labels_space_name ON labels (
+            (CASE WHEN workspace_id IS NULL THEN user_id ELSE 0 END),
+            COALESCE(workspace_id, 0),
+            LOWER(name)
+        )`).Error
+}
+
+// migrateLegacyCalendarColumns moves the Google token kept on users and the
+// event IDs kept on tasks into calendar_connections and task_event_mappings,
+// then drops the old columns. It does nothing once they are gone.
+func migrateLegacyCalendarColumns(db *gorm.DB) error {
+    migrator := db.Migrator()
+    if !migrator.HasColumn(&models.User{}, "google_token") {
+        return nil
+    }
+
+    return db.Transaction(func(tx *gorm.DB) error {
+        m := tx.Migrator()
+
+        syncEnabled := "true"
+        if m.HasColumn(&models.User{}, "calendar_sync") {
+            syncEnabled = "COALESCE(calendar_sync, false)"
+        }
+        disabledReason, disabledAt := "''", "NULL"
+        if m.HasColumn(&models.User{}, "calendar_sync_disabled_reason") {
+            disabledReason = "COALESCE(calendar_sync_disabled_reason, '')"
+        }
+        if m.HasColumn(&models.User{}, "calendar_sync_disabled_at") {
+            disabledAt = "calendar_sync_disabled_at"
+        }
+
+        err := tx.Exec(`
+            INSERT INTO calendar_connections (user_id, provider, credentials, calendar_id, sync_enabled, disabled_reason, disabled_at, created_at, updated_at)
+            SELECT id, 'google', google_token, '', ` + syncEnabled + `, ` + disabledReason + `, ` + disabledAt + `, NOW(), NOW()
+            FROM users
+            WHERE (google_token <> '' OR ` + disabledReason + ` <> '') AND deleted_at IS NULL
+            ON CONFLICT DO NOTHING`).Error
+        if err != nil {
+            return err
+        }
+
+        if m.HasColumn(&models.Task{}, "google_event_id") {
+            calendarID := "'primary'"
+            if m.HasColumn(&models.Task{}, "google_calendar_id") {
+                calendarID = "COALESCE(NULLIF(t.google_calendar_id, ''), 'primary')"
+            }
+
+            err := tx.Exec(`
+                INSERT INTO task_event_mappings (task_id, connection_id, external_event_id, calendar_id, etag, created_at, updated_at)
+                SELECT t.id, c.id, t.google_event_id, ` + calendarID + `, '', NOW(), NOW()
+                FROM tasks t
+                JOIN calendar_connections c ON c.user_id = t.user_id AND c.provider = 'google'
+                WHERE t.google_event_id <> ''
+                ON CONFLICT DO NOTHING`).Error
+            if err != nil {
+                return err
+            }
+        }
+
+        legacy := []struct {
+            model  interface{}
+            column string
+        }{
+            {&models.User{}, "google_token"},
+            {&models.User{}, "calendar_sync"},
+            {&models.User{}, "calendar_sync_disabled_reason"},
+            {&models.User{}, "calendar_sync_disabled_at"},
+            {&models.Task{}, "google_event_id"},
+            {&models.Task{}, "google_calendar_id"},
+        }
+        for _, col := range legacy {
+            if !m.HasColumn(col.model, col.column) {
+                continue
+            }
+            if err := m.DropColumn(col.model, col.column); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+}
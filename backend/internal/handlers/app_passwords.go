@@ -0,0 +1,82 @@
+package handlers
+
+import (
+    "net/http"
+    "strconv"
+    "taskflow/internal/auth"
+    "taskflow/internal/models"
+
+    "github.com/gin-gonic/gin"
+)
+
+type AppPasswordRequest struct {
+    Name string `json:"name" binding:"required"`
+}
+
+// appPasswordResponse carries the generated password, it is only returned
+// when the password is created.
+type appPasswordResponse struct {
+    models.AppPassword
+    Password string `json:"password"`
+}
+
+func GetAppPasswords(c *gin.Context) {
+    userID := c.GetUint("user_id")
+
+    var passwords []models.AppPassword
+    if err := db.Where("user_id = ?", userID).Order("id").Find(&passwords).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch app passwords"})
+        return
+    }
+
+    c.JSON(http.StatusOK, passwords)
+}
+
+func CreateAppPassword(c *gin.Context) {
+    userID := c.GetUint("user_id")
+
+    var req AppPasswordRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    password, hash, err := auth.GenerateSecretToken()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate app password"})
+        return
+    }
+
+    appPassword := models.AppPassword{
+        UserID:       userID,
+        Name:         req.Name,
+        PasswordHash: hash,
+    }
+    if err := db.Create(&appPassword).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create app password"})
+        return
+    }
+
+    c.JSON(http.StatusCreated, appPasswordResponse{AppPassword: appPassword, Password: password})
+}
+
+func DeleteAppPassword(c *gin.Context) {
+    userID := c.GetUint("user_id")
+    passwordID, err := strconv.Atoi(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid app password ID"})
+        return
+    }
+
+    result := db.Where("id = ? AND user_id = ?", passwordID, userID).Delete(&models.AppPassword{})
+    if result.Error != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete app password"})
+        return
+    }
+    if result.RowsAffected == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "App password not found"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "App password revoked successfully"})
+}
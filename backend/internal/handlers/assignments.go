@@ -0,0 +1,115 @@
+package handlers
+
+import (
+    "errors"
+    "net/http"
+    "taskflow/internal/models"
+    "taskflow/internal/services"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+)
+
+type AssignRequest struct {
+    AssigneeID uint `json:"assignee_id" binding:"required"`
+}
+
+// AssignTask hands a task to the user in the body, who starts watching it.
+// It honours If-Match like UpdateTask.
+func AssignTask(c *gin.Context) {
+    task, ok := findTask(c, services.PermEdit)
+    if !ok || !taskIfMatch(c, task) {
+        return
+    }
+
+    var req AssignRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    if err := services.ValidateAssignee(db, task, req.AssigneeID); err != nil {
+        if errors.Is(err, services.ErrAssigneeNotAllowed) {
+            c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+        } else {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check assignee"})
+        }
+        return
+    }
+
+    assignTask(c, task, &req.AssigneeID)
+}
+
+// UnassignTask leaves a task without an assignee.
+func UnassignTask(c *gin.Context) {
+    task, ok := findTask(c, services.PermEdit)
+    if !ok || !taskIfMatch(c, task) {
+        return
+    }
+
+    assignTask(c, task, nil)
+}
+
+// GetAssignments lists the assignment changes of a task, newest first.
+func GetAssignments(c *gin.Context) {
+    task, ok := findTask(c, services.PermView)
+    if !ok {
+        return
+    }
+
+    var changes []models.AssignmentChange
+    if err := db.Where("task_id = ?", task.ID).Order("created_at DESC, id DESC").Find(&changes).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assignments"})
+        return
+    }
+
+    c.JSON(http.StatusOK, changes)
+}
+
+// WatchTask subscribes the user to a task. Viewers can watch tasks too.
+func WatchTask(c *gin.Context) {
+    task, ok := findTask(c, services.PermView)
+    if !ok {
+        return
+    }
+
+    respondTaskWatchers(c, task, services.WatchTask(db, task, c.GetUint("user_id")))
+}
+
+// UnwatchTask unsubscribes the user from a task.
+func UnwatchTask(c *gin.Context) {
+    task, ok := findTask(c, services.PermView)
+    if !ok {
+        return
+    }
+
+    respondTaskWatchers(c, task, services.UnwatchTask(db, task, c.GetUint("user_id")))
+}
+
+func assignTask(c *gin.Context, task *models.Task, assigneeID *uint) {
+    err := db.Transaction(func(tx *gorm.DB) error {
+        return services.AssignTask(tx, task, assigneeID, c.GetUint("user_id"))
+    })
+    respondTaskSaved(c, task, err)
+}
+
+// respondTaskWatchers answers a change to the watchers of a task with the
+// watchers it now has.
+func respondTaskWatchers(c *gin.Context, task *models.Task, err error) {
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update watchers"})
+        return
+    }
+
+    tasks := []models.Task{*task}
+    if err := services.LoadTaskWatchers(db, tasks); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch watchers"})
+        return
+    }
+    watchers := tasks[0].Watchers
+    if watchers == nil {
+        watchers = []models.UserRef{}
+    }
+
+    c.JSON(http.StatusOK, watchers)
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+    "errors"
+    "net/http"
+    "taskflow/internal/services"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+)
+
+// MoveTaskRequest places a task on the board: in the Status column, right
+// after the task AfterID and before the task BeforeID. Status defaults to
+// the task's own.
+type MoveTaskRequest struct {
+    Status   string `json:"status"`
+    AfterID  *uint  `json:"after_id"`
+    BeforeID *uint  `json:"before_id"`
+}
+
+// MoveTask drags a task to a spot on the board, possibly in another status
+// column. The status change is checked like in UpdateTask and it honours
+// If-Match the same way. Neighbours need only one side given; without
+// either the task goes to the bottom of the column.
+func MoveTask(c *gin.Context) {
+    task, ok := findTask(c, services.PermEdit)
+    if !ok || !taskIfMatch(c, task) {
+        return
+    }
+
+    var req MoveTaskRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if req.Status == "" {
+        req.Status = task.Status
+    }
+    if !validTaskEnums(c, req.Status, "") {
+        return
+    }
+    if (req.AfterID != nil && *req.AfterID == task.ID) || (req.BeforeID != nil && *req.BeforeID == task.ID) {
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "A task can't be moved next to itself"})
+        return
+    }
+
+    if req.Status != task.Status {
+        if err := services.TaskWorkflow().CanTransition(task.Status, req.Status); err != nil {
+            respondTransitionError(c, err)
+            return
+        }
+        if err := services.CheckNotBlocked(db, task, req.Status); err != nil {
+            respondBlockedError(c, err)
+            return
+        }
+    }
+
+    err := db.Transaction(func(tx *gorm.DB) error {
+        position, err := services.MovePosition(tx, task, req.Status, req.AfterID, req.BeforeID)
+        if err != nil {
+            return err
+        }
+        task.Status = req.Status
+        task.Position = position
+        return writeTask(tx, task)
+    })
+    if errors.Is(err, services.ErrNeighbourNotFound) || errors.Is(err, services.ErrNeighbourOrder) {
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+        return
+    }
+    respondTaskSaved(c, task, err)
+}
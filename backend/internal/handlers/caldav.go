@@ -0,0 +1,805 @@
+package handlers
+
+import (
+    "bytes"
+    "encoding/xml"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "path"
+    "strconv"
+    "strings"
+    "time"
+    "taskflow/internal/ical"
+    "taskflow/internal/models"
+    "taskflow/internal/services"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+)
+
+// CalDAV server (RFC 4791) exposing each user's tasks as one VTODO
+// collection:
+//
+//    /dav/                              service root
+//    /dav/principals/<user id>/         principal
+//    /dav/calendars/<user id>/          calendar home
+//    /dav/calendars/<user id>/tasks/    the task collection
+//    /dav/calendars/<user id>/tasks/x   one task per resource
+//
+// Clients authenticate with HTTP Basic and an app password.
+
+const (
+    nsDAV       = "DAV:"
+    nsCalDAV    = "urn:ietf:params:xml:ns:caldav"
+    nsCalServer = "http://calendarserver.org/ns/"
+
+    davRoot             = "/dav/"
+    davTaskCollection   = "tasks"
+    maxCalDAVObjectSize = 1 << 20
+)
+
+var davPrefixes = map[string]string{
+    nsDAV:       "d",
+    nsCalDAV:    "c",
+    nsCalServer: "cs",
+}
+
+// CalDAVMethods are the methods routed to the CalDAV handler.
+var CalDAVMethods = []string{"PROPFIND", "REPORT", http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete}
+
+func davPrincipalPath(userID uint) string {
+    return fmt.Sprintf("%sprincipals/%d/", davRoot, userID)
+}
+
+func davHomePath(userID uint) string {
+    return fmt.Sprintf("%scalendars/%d/", davRoot, userID)
+}
+
+func davCollectionPath(userID uint) string {
+    return davHomePath(userID) + davTaskCollection + "/"
+}
+
+// CalDAVOptions advertises DAV support. It needs no authentication.
+func CalDAVOptions(c *gin.Context) {
+    c.Header("DAV", "1, 3, calendar-access")
+    c.Header("Allow", "OPTIONS, "+strings.Join(CalDAVMethods, ", "))
+    c.Status(http.StatusOK)
+}
+
+// CalDAVWellKnown points clients doing service discovery (RFC 6764) to the
+// service root.
+func CalDAVWellKnown(c *gin.Context) {
+    c.Redirect(http.StatusMovedPermanently, davRoot)
+}
+
+// ServeCalDAV dispatches a CalDAV request on the path below /dav.
+func ServeCalDAV(c *gin.Context) {
+    userID := c.GetUint("user_id")
+    segments := strings.Split(strings.Trim(c.Param("path"), "/"), "/")
+    if len(segments) == 1 && segments[0] == "" {
+        segments = nil
+    }
+
+    // Only the authenticated user's own resources exist
+    if len(segments) >= 2 && segments[1] != strconv.FormatUint(uint64(userID), 10) {
+        c.Status(http.StatusForbidden)
+        return
+    }
+
+    switch {
+    case len(segments) == 0:
+        davServeCollection(c, userID, davRoot)
+    case len(segments) == 2 && segments[0] == "principals":
+        davServeCollection(c, userID, davPrincipalPath(userID))
+    case len(segments) == 2 && segments[0] == "calendars":
+        davServeCollection(c, userID, davHomePath(userID))
+    case len(segments) == 3 && segments[0] == "calendars" && segments[2] == davTaskCollection:
+        davServeTaskCollection(c, userID)
+    case len(segments) == 4 && segments[0] == "calendars" && segments[2] == davTaskCollection:
+        name, err := url.PathUnescape(segments[3])
+        if err != nil {
+            c.Status(http.StatusBadRequest)
+            return
+        }
+        davServeTask(c, userID, name)
+    default:
+        c.Status(http.StatusNotFound)
+    }
+}
+
+// davServeCollection answers PROPFIND on the structural collections above
+// the task collection.
+func davServeCollection(c *gin.Context, userID uint, href string) {
+    if c.Request.Method != "PROPFIND" {
+        c.Status(http.StatusMethodNotAllowed)
+        return
+    }
+
+    requested, ok := parsePropfind(c)
+    if !ok {
+        return
+    }
+
+    var user models.User
+    if err := db.First(&user, userID).Error; err != nil {
+        c.Status(http.StatusNotFound)
+        return
+    }
+
+    props := davCommonProps(&user)
+    var children []string
+    switch href {
+    case davRoot:
+        props[davName(nsDAV, "resourcetype")] = "<d:collection/>"
+        props[davName(nsDAV, "displayname")] = "TaskFlow"
+    case davPrincipalPath(userID):
+        props[davName(nsDAV, "resourcetype")] = "<d:principal/>"
+        props[davName(nsDAV, "displayname")] = xmlText(user.Name)
+        props[davName(nsDAV, "principal-URL")] = davHref(davPrincipalPath(userID))
+        props[davName(nsCalDAV, "calendar-home-set")] = davHref(davHomePath(userID))
+        props[davName(nsCalDAV, "calendar-user-address-set")] = davHref("mailto:" + user.Email)
+    case davHomePath(userID):
+        props[davName(nsDAV, "resourcetype")] = "<d:collection/>"
+        props[davName(nsDAV, "displayname")] = xmlText(user.Name)
+        children = append(children, davCollectionPath(userID))
+    }
+
+    responses := []string{davPropResponse(href, props, requested)}
+    if c.GetHeader("Depth") != "0" && len(children) > 0 {
+        collectionProps, err := davTaskCollectionProps(&user)
+        if err != nil {
+            c.Status(http.StatusInternalServerError)
+            return
+        }
+        responses = append(responses, davPropResponse(children[0], collectionProps, requested))
+    }
+
+    writeMultistatus(c, responses)
+}
+
+func davServeTaskCollection(c *gin.Context, userID uint) {
+    var user models.User
+    if err := db.First(&user, userID).Error; err != nil {
+        c.Status(http.StatusNotFound)
+        return
+    }
+
+    switch c.Request.Method {
+    case "PROPFIND":
+        requested, ok := parsePropfind(c)
+        if !ok {
+            return
+        }
+
+        props, err := davTaskCollectionProps(&user)
+        if err != nil {
+            c.Status(http.StatusInternalServerError)
+            return
+        }
+        responses := []string{davPropResponse(davCollectionPath(userID), props, requested)}
+
+        if c.GetHeader("Depth") != "0" {
+            resources, err := loadTaskResources(userID)
+            if err != nil {
+                c.Status(http.StatusInternalServerError)
+                return
+            }
+            for _, resource := range resources {
+                responses = append(responses, davPropResponse(resource.href(userID), resource.props(false), requested))
+            }
+        }
+
+        writeMultistatus(c, responses)
+    case "REPORT":
+        davReport(c, userID)
+    default:
+        c.Status(http.StatusMethodNotAllowed)
+    }
+}
+
+func davServeTask(c *gin.Context, userID uint, name string) {
+    resource, err := findTaskResource(userID, name)
+    if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+        c.Status(http.StatusInternalServerError)
+        return
+    }
+
+    switch c.Request.Method {
+    case http.MethodGet, http.MethodHead:
+        if resource == nil {
+            c.Status(http.StatusNotFound)
+            return
+        }
+        c.Header("ETag", resource.etag())
+        c.Header("Last-Modified", resource.task.UpdatedAt.UTC().Format(http.TimeFormat))
+        if etagMatches(c.GetHeader("If-None-Match"), resource.etag()) {
+            c.Status(http.StatusNotModified)
+            return
+        }
+        c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(resource.calendarData()))
+    case "PROPFIND":
+        if resource == nil {
+            c.Status(http.StatusNotFound)
+            return
+        }
+        requested, ok := parsePropfind(c)
+        if !ok {
+            return
+        }
+        writeMultistatus(c, []string{davPropResponse(resource.href(userID), resource.props(false), requested)})
+    case http.MethodPut:
+        if davCanEdit(c, userID, resource) {
+            davPutTask(c, userID, name, resource)
+        }
+    case http.MethodDelete:
+        if davCanEdit(c, userID, resource) {
+            davDeleteTask(c, resource)
+        }
+    default:
+        c.Status(http.StatusMethodNotAllowed)
+    }
+}
+
+// davCanEdit checks that the user may change the task behind an existing
+// resource, answering 403 when a workspace role no longer allows it.
+func davCanEdit(c *gin.Context, userID uint, resource *taskResource) bool {
+    if resource == nil {
+        return true
+    }
+
+    allowed, err := services.CanEditTask(db, userID, &resource.task)
+    if err != nil {
+        c.Status(http.StatusInternalServerError)
+        return false
+    }
+    if !allowed {
+        davError(c, http.StatusForbidden, nsDAV, "need-privileges")
+        return false
+    }
+    return true
+}
+
+// davPutTask creates or replaces a task from a VTODO. The stored task only
+// keeps the fields TaskFlow knows, so no ETag is returned: clients fetch the
+// normalized resource again (RFC 4791 section 5.3.4).
+func davPutTask(c *gin.Context, userID uint, name string, resource *taskResource) {
+    if !davPreconditionsMet(c, resource) {
+        c.Status(http.StatusPreconditionFailed)
+        return
+    }
+
+    data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxCalDAVObjectSize))
+    if err != nil {
+        c.Status(http.StatusRequestEntityTooLarge)
+        return
+    }
+
+    cal, err := ical.Parse(bytes.NewReader(data))
+    if err != nil || cal.Name != "VCALENDAR" {
+        davError(c, http.StatusBadRequest, nsCalDAV, "valid-calendar-data")
+        return
+    }
+    todos := cal.Children("VTODO")
+    if len(todos) == 0 {
+        davError(c, http.StatusForbidden, nsCalDAV, "supported-calendar-component")
+        return
+    }
+    vtodo := todos[0]
+    uid := vtodo.Text("UID")
+    if uid == "" {
+        davError(c, http.StatusBadRequest, nsCalDAV, "valid-calendar-object-resource")
+        return
+    }
+
+    task := models.Task{UserID: userID}
+    if resource != nil {
+        task = resource.task
+    }
+    if err := services.ApplyVTodo(&task, vtodo); err != nil {
+        davError(c, http.StatusBadRequest, nsCalDAV, "valid-calendar-data")
+        return
+    }
+    // Like in the API, a recurring task needs a due date to repeat from
+    if task.Recurrence != "" && task.DueDate == nil {
+        davError(c, http.StatusForbidden, nsCalDAV, "valid-calendar-object-resource")
+        return
+    }
+
+    // Status changes follow the task workflow and dependencies like in the
+    // API
+    workflow := services.TaskWorkflow()
+    if resource == nil {
+        err = workflow.CanCreate(task.Status)
+    } else {
+        err = workflow.CanTransition(resource.task.Status, task.Status)
+    }
+    if err != nil {
+        davError(c, http.StatusForbidden, nsCalDAV, "valid-calendar-object-resource")
+        return
+    }
+    if resource != nil {
+        err = services.CheckNotBlocked(db, &resource.task, task.Status)
+        var blocked *services.BlockedError
+        if errors.As(err, &blocked) {
+            davError(c, http.StatusForbidden, nsCalDAV, "valid-calendar-object-resource")
+            return
+        }
+        if err != nil {
+            c.Status(http.StatusInternalServerError)
+            return
+        }
+    }
+
+    err = db.Transaction(func(tx *gorm.DB) error {
+        if err := writeTask(tx, &task); err != nil {
+            return err
+        }
+        if resource != nil {
+            return nil
+        }
+        object := models.CalDAVObject{UserID: userID, TaskID: task.ID, Name: name, UID: uid}
+        return tx.Create(&object).Error
+    })
+    if errors.Is(err, services.ErrTaskVersionConflict) {
+        c.Status(http.StatusPreconditionFailed)
+        return
+    }
+    if err != nil {
+        c.Status(http.StatusInternalServerError)
+        return
+    }
+
+    if resource == nil {
+        c.Status(http.StatusCreated)
+        return
+    }
+    c.Status(http.StatusNoContent)
+}
+
+func davDeleteTask(c *gin.Context, resource *taskResource) {
+    if resource == nil {
+        c.Status(http.StatusNotFound)
+        return
+    }
+    if !davPreconditionsMet(c, resource) {
+        c.Status(http.StatusPreconditionFailed)
+        return
+    }
+
+    task := resource.task
+    err := db.Transaction(func(tx *gorm.DB) error {
+        // Like in the API, a task changed since it was read is kept
+        result := tx.Where("version = ?", task.Version).Delete(&task)
+        if result.Error != nil {
+            return result.Error
+        }
+        if result.RowsAffected == 0 {
+            return services.ErrTaskVersionConflict
+        }
+        if err := tx.Where("task_id = ?", task.ID).Delete(&models.CalDAVObject{}).Error; err != nil {
+            return err
+        }
+        if err := services.DeleteSubtasks(tx, &task); err != nil {
+            return err
+        }
+        return services.EnqueueTaskSync(tx, &task)
+    })
+    if errors.Is(err, services.ErrTaskVersionConflict) {
+        c.Status(http.StatusPreconditionFailed)
+        return
+    }
+    if err != nil {
+        c.Status(http.StatusInternalServerError)
+        return
+    }
+
+    c.Status(http.StatusNoContent)
+}
+
+// davPreconditionsMet checks If-Match and If-None-Match against the
+// resource, nil when it doesn't exist yet.
+func davPreconditionsMet(c *gin.Context, resource *taskResource) bool {
+    if ifMatch := c.GetHeader("If-Match"); ifMatch != "" {
+        if resource == nil || !etagMatches(ifMatch, resource.etag()) {
+            return false
+        }
+    }
+    if c.GetHeader("If-None-Match") != "" && resource != nil {
+        if etagMatches(c.GetHeader("If-None-Match"), resource.etag()) {
+            return false
+        }
+    }
+    return true
+}
+
+type davReportRequest struct {
+    XMLName xml.Name
+    Prop    *davPropList `xml:"DAV: prop"`
+    Hrefs   []string     `xml:"DAV: href"`
+    Filter  *struct {
+        CompFilter davCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+    } `xml:"urn:ietf:params:xml:ns:caldav filter"`
+}
+
+type davCompFilter struct {
+    Name        string          `xml:"name,attr"`
+    CompFilters []davCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+// matchesTodos reports whether a calendar-query filter can match VTODOs.
+// Narrower filters (time ranges, properties) are not evaluated, the client
+// gets every task, which it filters again anyway.
+func (f davCompFilter) matchesTodos() bool {
+    if !strings.EqualFold(f.Name, "VCALENDAR") {
+        return false
+    }
+    if len(f.CompFilters) == 0 {
+        return true
+    }
+    for _, child := range f.CompFilters {
+        if strings.EqualFold(child.Name, "VTODO") {
+            return true
+        }
+    }
+    return false
+}
+
+func davReport(c *gin.Context, userID uint) {
+    var req davReportRequest
+    if err := xml.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+        c.Status(http.StatusBadRequest)
+        return
+    }
+
+    var requested []xml.Name
+    if req.Prop != nil {
+        requested = req.Prop.names()
+    }
+
+    var responses []string
+    switch {
+    case req.XMLName.Space == nsCalDAV && req.XMLName.Local == "calendar-query":
+        if req.Filter != nil && !req.Filter.CompFilter.matchesTodos() {
+            break
+        }
+        resources, err := loadTaskResources(userID)
+        if err != nil {
+            c.Status(http.StatusInternalServerError)
+            return
+        }
+        for _, resource := range resources {
+            responses = append(responses, davPropResponse(resource.href(userID), resource.props(true), requested))
+        }
+    case req.XMLName.Space == nsCalDAV && req.XMLName.Local == "calendar-multiget":
+        for _, href := range req.Hrefs {
+            hrefPath := href
+            if u, err := url.Parse(href); err == nil {
+                hrefPath = u.Path
+            }
+            name := path.Base(hrefPath)
+            if path.Dir(hrefPath)+"/" != davCollectionPath(userID) {
+                responses = append(responses, davStatusResponse(href, http.StatusNotFound))
+                continue
+            }
+
+            resource, err := findTaskResource(userID, name)
+            if errors.Is(err, gorm.ErrRecordNotFound) {
+                responses = append(responses, davStatusResponse(href, http.StatusNotFound))
+                continue
+            }
+            if err != nil {
+                c.Status(http.StatusInternalServerError)
+                return
+            }
+            responses = append(responses, davPropResponse(resource.href(userID), resource.props(true), requested))
+        }
+    default:
+        davError(c, http.StatusForbidden, nsDAV, "supported-report")
+        return
+    }
+
+    writeMultistatus(c, responses)
+}
+
+// taskResource is a task as served over CalDAV.
+type taskResource struct {
+    task   models.Task
+    object *models.CalDAVObject
+}
+
+func (r *taskResource) name() string {
+    if r.object != nil {
+        return r.object.Name
+    }
+    return fmt.Sprintf("task-%d.ics", r.task.ID)
+}
+
+func (r *taskResource) href(userID uint) string {
+    return davCollectionPath(userID) + url.PathEscape(r.name())
+}
+
+// etag changes with every update of the task.
+func (r *taskResource) etag() string {
+    return `"` + strconv.FormatInt(r.task.UpdatedAt.UnixMicro(), 10) + `"`
+}
+
+func (r *taskResource) calendarData() string {
+    vtodo := services.TaskVTodo(&r.task)
+    if r.object != nil {
+        vtodo.Set("UID", r.object.UID)
+    }
+    cal := ical.NewCalendar()
+    cal.Add(vtodo)
+    return cal.String()
+}
+
+// props returns the resource's properties; calendar-data is only included
+// when withData is set, as it is not part of allprop.
+func (r *taskResource) props(withData bool) map[xml.Name]string {
+    props := map[xml.Name]string{
+        davName(nsDAV, "resourcetype"):    "",
+        davName(nsDAV, "getetag"):         xmlText(r.etag()),
+        davName(nsDAV, "getcontenttype"):  "text/calendar; charset=utf-8; component=vtodo",
+        davName(nsDAV, "getlastmodified"): r.task.UpdatedAt.UTC().Format(http.TimeFormat),
+        davName(nsDAV, "displayname"):     xmlText(r.task.Title),
+    }
+    if withData {
+        props[davName(nsCalDAV, "calendar-data")] = xmlText(r.calendarData())
+    }
+    return props
+}
+
+// loadTaskResources loads the tasks on the user's calendar, as
+// services.CalendarTasks picks them, with their CalDAV names.
+func loadTaskResources(userID uint) ([]taskResource, error) {
+    var tasks []models.Task
+    if err := services.CalendarTasks(db, userID).Order("id").Find(&tasks).Error; err != nil {
+        return nil, err
+    }
+
+    var objects []models.CalDAVObject
+    if err := db.Where("user_id = ?", userID).Find(&objects).Error; err != nil {
+        return nil, err
+    }
+    byTask := make(map[uint]*models.CalDAVObject, len(objects))
+    for i := range objects {
+        byTask[objects[i].TaskID] = &objects[i]
+    }
+
+    resources := make([]taskResource, 0, len(tasks))
+    for _, task := range tasks {
+        resources = append(resources, taskResource{task: task, object: byTask[task.ID]})
+    }
+    return resources, nil
+}
+
+// findTaskResource resolves a resource name to a task: a name a client
+// chose, or task-<id>.ics for tasks created elsewhere.
+func findTaskResource(userID uint, name string) (*taskResource, error) {
+    var object models.CalDAVObject
+    err := db.Where("user_id = ? AND name = ?", userID, name).First(&object).Error
+    if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, err
+    }
+
+    resource := &taskResource{}
+    var taskID uint
+    if err == nil {
+        resource.object = &object
+        taskID = object.TaskID
+    } else {
+        var id uint
+        if _, err := fmt.Sscanf(name, "task-%d.ics", &id); err != nil || fmt.Sprintf("task-%d.ics", id) != name {
+            return nil, gorm.ErrRecordNotFound
+        }
+        taskID = id
+    }
+
+    if err := services.CalendarTasks(db, userID).Where("id = ?", taskID).First(&resource.task).Error; err != nil {
+        return nil, err
+    }
+
+    // A task a client created is only reachable under the client's name
+    if resource.object == nil {
+        var count int64
+        if err := db.Model(&models.CalDAVObject{}).Where("task_id = ?", taskID).Count(&count).Error; err != nil {
+            return nil, err
+        }
+        if count > 0 {
+            return nil, gorm.ErrRecordNotFound
+        }
+    }
+    return resource, nil
+}
+
+func davCommonProps(user *models.User) map[xml.Name]string {
+    return map[xml.Name]string{
+        davName(nsDAV, "current-user-principal"): davHref(davPrincipalPath(user.ID)),
+        davName(nsDAV, "owner"):                  davHref(davPrincipalPath(user.ID)),
+    }
+}
+
+func davTaskCollectionProps(user *models.User) (map[xml.Name]string, error) {
+    ctag, err := davCollectionTag(user.ID)
+    if err != nil {
+        return nil, err
+    }
+
+    props := davCommonProps(user)
+    props[davName(nsDAV, "resourcetype")] = "<d:collection/><c:calendar/>"
+    props[davName(nsDAV, "displayname")] = "TaskFlow"
+    props[davName(nsCalDAV, "supported-calendar-component-set")] = `<c:comp name="VTODO"/>`
+    props[davName(nsCalServer, "getctag")] = xmlText(ctag)
+    props[davName(nsDAV, "getetag")] = xmlText(`"` + ctag + `"`)
+    props[davName(nsDAV, "current-user-privilege-set")] = "<d:privilege><d:read/></d:privilege>" +
+        "<d:privilege><d:write/></d:privilege>" +
+        "<d:privilege><d:write-content/></d:privilege>" +
+        "<d:privilege><d:bind/></d:privilege>" +
+        "<d:privilege><d:unbind/></d:privilege>"
+    props[davName(nsDAV, "supported-report-set")] = "<d:supported-report><d:report><c:calendar-query/></d:report></d:supported-report>" +
+        "<d:supported-report><d:report><c:calendar-multiget/></d:report></d:supported-report>"
+    return props, nil
+}
+
+// davCollectionTag changes whenever a task on the user's calendar is
+// created, updated, deleted or handed to someone else, so clients know when
+// to look at the resources again. The latest update and deletion are read as
+// plain columns and compared here, aggregates lose the column type on some
+// databases.
+func davCollectionTag(userID uint) (string, error) {
+    tasks := func() *gorm.DB {
+        return services.CalendarTasks(db.Unscoped().Model(&models.Task{}), userID)
+    }
+
+    var count int64
+    if err := tasks().Count(&count).Error; err != nil {
+        return "", err
+    }
+
+    var latest time.Time
+    for _, column := range []string{"updated_at", "deleted_at"} {
+        var times []time.Time
+        err := tasks().Where(column + " IS NOT NULL").Order(column + " DESC").Limit(1).Pluck(column, &times).Error
+        if err != nil {
+            return "", err
+        }
+        if len(times) > 0 && times[0].After(latest) {
+            latest = times[0]
+        }
+    }
+    return fmt.Sprintf("%d-%d", latest.UnixMicro(), count), nil
+}
+
+type davPropfindRequest struct {
+    AllProp *struct{}    `xml:"DAV: allprop"`
+    Prop    *davPropList `xml:"DAV: prop"`
+}
+
+type davPropList struct {
+    Props []struct {
+        XMLName xml.Name
+    } `xml:",any"`
+}
+
+func (l *davPropList) names() []xml.Name {
+    names := make([]xml.Name, 0, len(l.Props))
+    for _, prop := range l.Props {
+        names = append(names, prop.XMLName)
+    }
+    return names
+}
+
+// parsePropfind returns the requested properties, nil for allprop. An
+// empty body means allprop.
+func parsePropfind(c *gin.Context) ([]xml.Name, bool) {
+    body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxCalDAVObjectSize))
+    if err != nil {
+        c.Status(http.StatusBadRequest)
+        return nil, false
+    }
+    if len(bytes.TrimSpace(body)) == 0 {
+        return nil, true
+    }
+
+    var req davPropfindRequest
+    if err := xml.Unmarshal(body, &req); err != nil {
+        c.Status(http.StatusBadRequest)
+        return nil, false
+    }
+    if req.Prop == nil {
+        return nil, true
+    }
+    return req.Prop.names(), true
+}
+
+func davName(space, local string) xml.Name {
+    return xml.Name{Space: space, Local: local}
+}
+
+func davHref(href string) string {
+    return "<d:href>" + xmlText(href) + "</d:href>"
+}
+
+func xmlText(s string) string {
+    var b bytes.Buffer
+    xml.EscapeText(&b, []byte(s))
+    return b.String()
+}
+
+// davElement writes an element with the given inner XML, declaring the
+// namespace inline when it has no prefix on the multistatus root.
+func davElement(name xml.Name, inner string) string {
+    prefix, ok := davPrefixes[name.Space]
+    if !ok {
+        prefix = "x"
+        open := prefix + ":" + name.Local + ` xmlns:x="` + xmlText(name.Space) + `"`
+        if inner == "" {
+            return "<" + open + "/>"
+        }
+        return "<" + open + ">" + inner + "</" + prefix + ":" + name.Local + ">"
+    }
+
+    tag := prefix + ":" + name.Local
+    if inner == "" {
+        return "<" + tag + "/>"
+    }
+    return "<" + tag + ">" + inner + "</" + tag + ">"
+}
+
+// davPropResponse answers the requested properties from props, all of
+// them when requested is nil. Unknown properties are reported as 404.
+func davPropResponse(href string, props map[xml.Name]string, requested []xml.Name) string {
+    var found, missing strings.Builder
+    if requested == nil {
+        for name, value := range props {
+            found.WriteString(davElement(name, value))
+        }
+    }
+    for _, name := range requested {
+        if value, ok := props[name]; ok {
+            found.WriteString(davElement(name, value))
+        } else {
+            missing.WriteString(davElement(name, ""))
+        }
+    }
+
+    var b strings.Builder
+    b.WriteString("<d:response>" + davHref(href))
+    if found.Len() > 0 {
+        b.WriteString("<d:propstat><d:prop>" + found.String() + "</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>")
+    }
+    if missing.Len() > 0 {
+        b.WriteString("<d:propstat><d:prop>" + missing.String() + "</d:prop><d:status>HTTP/1.1 404 Not Found</d:status></d:propstat>")
+    }
+    b.WriteString("</d:response>")
+    return b.String()
+}
+
+func davStatusResponse(href string, status int) string {
+    return "<d:response>" + davHref(href) + fmt.Sprintf("<d:status>HTTP/1.1 %d %s</d:status>", status, http.StatusText(status)) + "</d:response>"
+}
+
+func writeMultistatus(c *gin.Context, responses []string) {
+    var b strings.Builder
+    b.WriteString(`<?xml version="1.0" encoding="utf-8"?>`)
+    b.WriteString(`<d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav" xmlns:cs="http://calendarserver.org/ns/">`)
+    for _, response := range responses {
+        b.WriteString(response)
+    }
+    b.WriteString(`</d:multistatus>`)
+
+    c.Header("DAV", "1, 3, calendar-access")
+    c.Data(http.StatusMultiStatus, "application/xml; charset=utf-8", []byte(b.String()))
+}
+
+// davError answers with a precondition element (RFC 4918 section 16).
+func davError(c *gin.Context, status int, space, condition string) {
+    body := `<?xml version="1.0" encoding="utf-8"?>` +
+        `<d:error xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">` +
+        davElement(davName(space, condition), "") +
+        `</d:error>`
+    c.Data(status, "application/xml; charset=utf-8", []byte(body))
+}
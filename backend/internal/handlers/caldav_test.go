@@ -0,0 +1,152 @@
+package handlers
+
+import (
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+    "taskflow/internal/models"
+
+    "github.com/gin-gonic/gin"
+)
+
+const davTestCollection = "/dav/calendars/1/tasks/"
+
+// newCalDAVTest serves the CalDAV routes of main.go as user 1, standing in
+// for AppPasswordAuth.
+func newCalDAVTest(t *testing.T) *gin.Engine {
+    InitDB(newTestDB(t, &models.User{}, &models.Task{}, &models.CalDAVObject{}, &models.WorkspaceMember{},
+        &models.TaskDependency{}, &models.SyncJob{}, &models.CalendarConnection{}, &models.TaskEventMapping{}))
+    t.Cleanup(func() { InitDB(nil) })
+
+    for _, user := range []models.User{{ID: 1, Email: "ana@example.com"}, {ID: 2, Email: "bruno@example.com"}} {
+        if err := db.Create(&user).Error; err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    gin.SetMode(gin.TestMode)
+    r := gin.New()
+    r.Use(func(c *gin.Context) {
+        c.Set("user_id", uint(1))
+        c.Next()
+    })
+    for _, method := range CalDAVMethods {
+        r.Handle(method, "/dav/*path", ServeCalDAV)
+    }
+    return r
+}
+
+func davTestTodo(uid, summary string) string {
+    return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\n" +
+        "BEGIN:VTODO\r\nUID:" + uid + "\r\nSUMMARY:" + summary + "\r\nEND:VTODO\r\n" +
+        "END:VCALENDAR\r\n"
+}
+
+func TestCalDAVPropfindListsOwnTasks(t *testing.T) {
+    r := newCalDAVTest(t)
+    for _, task := range []models.Task{
+        {UserID: 1, Title: "Buy milk"},
+        {UserID: 1, Title: "Call the bank"},
+        {UserID: 2, Title: "Someone else's"},
+    } {
+        if err := db.Create(&task).Error; err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    propfind := func() string {
+        t.Helper()
+        w := serveWith(r, "PROPFIND", davTestCollection, "", map[string]string{"Depth": "1"})
+        if w.Code != http.StatusMultiStatus {
+            t.Fatalf("got %d, want 207: %s", w.Code, w.Body)
+        }
+        return w.Body.String()
+    }
+
+    body := propfind()
+    if got := strings.Count(body, "<d:response>"); got != 3 {
+        t.Errorf("got %d responses, want the collection and its 2 tasks: %s", got, body)
+    }
+    for _, href := range []string{davTestCollection + "task-1.ics", davTestCollection + "task-2.ics"} {
+        if !strings.Contains(body, href) {
+            t.Errorf("%s is missing: %s", href, body)
+        }
+    }
+    if strings.Contains(body, "task-3.ics") {
+        t.Errorf("another user's task is listed: %s", body)
+    }
+
+    ctag := func(body string) string {
+        start := strings.Index(body, "getctag>")
+        if start < 0 {
+            t.Fatalf("no getctag: %s", body)
+        }
+        return body[start : start+strings.Index(body[start:], "<")]
+    }
+    before := ctag(body)
+    if err := db.Delete(&models.Task{}, 2).Error; err != nil {
+        t.Fatal(err)
+    }
+    if after := ctag(propfind()); after == before {
+        t.Errorf("the ctag stayed %s after a delete", after)
+    }
+}
+
+func TestCalDAVPutIfNoneMatchCreatesOnce(t *testing.T) {
+    r := newCalDAVTest(t)
+    headers := map[string]string{"If-None-Match": "*", "Content-Type": "text/calendar"}
+
+    w := serveWith(r, http.MethodPut, davTestCollection+"milk.ics", davTestTodo("milk", "Buy milk"), headers)
+    if w.Code != http.StatusCreated {
+        t.Fatalf("create: got %d, want 201: %s", w.Code, w.Body)
+    }
+
+    w = serveWith(r, http.MethodPut, davTestCollection+"milk.ics", davTestTodo("milk", "Buy oat milk"), headers)
+    if w.Code != http.StatusPreconditionFailed {
+        t.Fatalf("overwrite: got %d, want 412", w.Code)
+    }
+
+    var tasks []models.Task
+    if err := db.Find(&tasks).Error; err != nil {
+        t.Fatal(err)
+    }
+    if len(tasks) != 1 || tasks[0].Title != "Buy milk" {
+        t.Errorf("got %+v, want the first version only", tasks)
+    }
+}
+
+func TestCalDAVDeleteRefusesStaleIfMatch(t *testing.T) {
+    r := newCalDAVTest(t)
+    task := models.Task{UserID: 1, Title: "Buy milk"}
+    if err := db.Create(&task).Error; err != nil {
+        t.Fatal(err)
+    }
+    path := davTestCollection + "task-1.ics"
+
+    w := serveWith(r, http.MethodGet, path, "", nil)
+    if w.Code != http.StatusOK {
+        t.Fatalf("get: got %d, want 200", w.Code)
+    }
+    stale := w.Header().Get("ETag")
+
+    // Someone else edits the task in the meantime
+    if err := db.Model(&task).Updates(map[string]interface{}{"title": "Buy oat milk", "updated_at": time.Now().Add(time.Minute)}).Error; err != nil {
+        t.Fatal(err)
+    }
+
+    if w := serveWith(r, http.MethodDelete, path, "", map[string]string{"If-Match": stale}); w.Code != http.StatusPreconditionFailed {
+        t.Fatalf("stale delete: got %d, want 412", w.Code)
+    }
+    if err := db.First(&models.Task{}, task.ID).Error; err != nil {
+        t.Fatalf("the task was deleted: %v", err)
+    }
+
+    current := serveWith(r, http.MethodGet, path, "", nil).Header().Get("ETag")
+    if w := serveWith(r, http.MethodDelete, path, "", map[string]string{"If-Match": current}); w.Code != http.StatusNoContent {
+        t.Fatalf("delete: got %d, want 204", w.Code)
+    }
+    if err := db.First(&models.Task{}, task.ID).Error; err == nil {
+        t.Error("the task is still there")
+    }
+}
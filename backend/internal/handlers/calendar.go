@@ -1,7 +1,11 @@
 package handlers
 
 import (
+    "errors"
+    "log"
     "net/http"
+    "time"
+    "taskflow/internal/auth"
     "taskflow/internal/models"
     "taskflow/internal/services"
 
@@ -10,133 +14,385 @@ import (
 )
 
 type CalendarHandler struct {
-    calendarService *services.GoogleCalendarService
-    db              *gorm.DB
+    db *gorm.DB
 }
 
 func NewCalendarHandler(db *gorm.DB) *CalendarHandler {
     return &CalendarHandler{
-        calendarService: services.NewGoogleCalendarService(),
-        db:              db,
+        db: db,
     }
 }
 
-type GoogleAuthRequest struct {
-    UserID uint `json:"user_id" binding:"required"`
+type CalendarAuthResponse struct {
+    AuthURL string `json:"auth_url"`
 }
 
-type GoogleAuthResponse struct {
-    AuthURL string `json:"auth_url"`
+type CalendarCallbackRequest struct {
+    Code       string `json:"code" binding:"required"`
+    State      string `json:"state" binding:"required"`
+    CalendarID string `json:"calendar_id"`
 }
 
-type GoogleCallbackRequest struct {
-    Code   string `json:"code" binding:"required"`
-    UserID uint   `json:"user_id" binding:"required"`
+type CalDAVConnectRequest struct {
+    ServerURL  string `json:"server_url" binding:"required,url"`
+    Username   string `json:"username" binding:"required"`
+    Password   string `json:"password" binding:"required"`
+    CalendarID string `json:"calendar_id"`
 }
 
-func (h *CalendarHandler) InitGoogleAuth(c *gin.Context) {
-    var req GoogleAuthRequest
-    if err := c.ShouldBindJSON(&req); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+// providerParam returns the provider named in the route. The original
+// calendar routes predate other providers and always mean Google.
+func providerParam(c *gin.Context) string {
+    if provider := c.Param("provider"); provider != "" {
+        return provider
+    }
+    if provider := c.Query("provider"); provider != "" {
+        return provider
+    }
+    return services.ProviderGoogle
+}
+
+func (h *CalendarHandler) InitAuth(c *gin.Context) {
+    userID := c.GetUint("user_id")
+    providerName := providerParam(c)
+
+    provider, err := services.NewCalendarProvider(providerName, h.db)
+    if err != nil || !services.IsOAuthProvider(providerName) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported OAuth calendar provider"})
         return
     }
 
-    state := "user_" + string(rune(req.UserID))
-    authURL := h.calendarService.GetAuthURL(state)
+    state, payload, err := auth.GenerateOAuthState(userID, providerName)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate state"})
+        return
+    }
 
-    response := GoogleAuthResponse{
-        AuthURL: authURL,
+    // Drop states nobody came back with before recording the new one
+    h.db.Where("expires_at < ?", time.Now()).Delete(&models.OAuthState{})
+
+    record := models.OAuthState{
+        Nonce:     payload.Nonce,
+        UserID:    userID,
+        Provider:  providerName,
+        ExpiresAt: time.Unix(payload.ExpiresAt, 0),
+    }
+    if err := h.db.Create(&record).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save state"})
+        return
+    }
+
+    response := CalendarAuthResponse{
+        AuthURL: provider.AuthURL(state),
     }
 
     c.JSON(http.StatusOK, response)
 }
 
-func (h *CalendarHandler) HandleGoogleCallback(c *gin.Context) {
-    var req GoogleCallbackRequest
+func (h *CalendarHandler) HandleCallback(c *gin.Context) {
+    userID := c.GetUint("user_id")
+    providerName := providerParam(c)
+
+    var req CalendarCallbackRequest
     if err := c.ShouldBindJSON(&req); err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
 
-    token, err := h.calendarService.ExchangeCode(req.Code)
+    provider, err := services.NewCalendarProvider(providerName, h.db)
+    if err != nil || !services.IsOAuthProvider(providerName) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported OAuth calendar provider"})
+        return
+    }
+
+    state, err := auth.ParseOAuthState(req.State)
+    if err != nil || state.Provider != providerName {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired state"})
+        return
+    }
+
+    // The state must have been issued to the user completing the flow
+    if state.UserID != userID {
+        c.JSON(http.StatusForbidden, gin.H{"error": "State does not belong to this user"})
+        return
+    }
+
+    // Consuming the nonce makes the state single-use
+    result := h.db.Where("nonce = ? AND user_id = ? AND provider = ?", state.Nonce, userID, providerName).Delete(&models.OAuthState{})
+    if result.Error != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate state"})
+        return
+    }
+    if result.RowsAffected == 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "State has already been used"})
+        return
+    }
+
+    credentials, calendarID, err := provider.Connect(c.Request.Context(), services.ConnectParams{
+        Code:       req.Code,
+        CalendarID: req.CalendarID,
+    })
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to exchange code for token"})
         return
     }
 
-    tokenJSON, err := h.calendarService.TokenToJSON(token)
+    conn, err := h.saveConnection(userID, providerName, credentials, calendarID)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to serialize token"})
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save calendar connection"})
         return
     }
 
-    // Update user with Google token and enable calendar sync
-    var user models.User
-    if err := h.db.First(&user, req.UserID).Error; err != nil {
-        c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+    c.JSON(http.StatusOK, gin.H{
+        "message":      "Calendar connected successfully",
+        "sync_enabled": true,
+        "connection":   conn,
+    })
+}
+
+func (h *CalendarHandler) ConnectCalDAV(c *gin.Context) {
+    userID := c.GetUint("user_id")
+
+    var req CalDAVConnectRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    provider := services.NewCalDAVProvider()
+    credentials, calendarID, err := provider.Connect(c.Request.Context(), services.ConnectParams{
+        ServerURL:  req.ServerURL,
+        Username:   req.Username,
+        Password:   req.Password,
+        CalendarID: req.CalendarID,
+    })
+    if errors.Is(err, services.ErrCalDAVInsecureURL) || errors.Is(err, services.ErrCalDAVHostBlocked) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if err != nil {
+        // The server's answer stays in the log, it could describe hosts
+        // only reachable from here
+        log.Printf("user %d: failed to connect to CalDAV server: %v", userID, err)
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to connect to CalDAV server, check the URL and credentials"})
         return
     }
 
-    user.GoogleToken = tokenJSON
-    user.CalendarSync = true
-    if err := h.db.Save(&user).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save user token"})
+    conn, err := h.saveConnection(userID, services.ProviderCalDAV, credentials, calendarID)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save calendar connection"})
         return
     }
 
     c.JSON(http.StatusOK, gin.H{
-        "message": "Google Calendar connected successfully",
+        "message":      "Calendar connected successfully",
         "sync_enabled": true,
+        "connection":   conn,
     })
 }
 
+// saveConnection creates or replaces the user's connection for a provider
+// and queues the user's open tasks so they show up in the new calendar.
+func (h *CalendarHandler) saveConnection(userID uint, provider, credentials, calendarID string) (*models.CalendarConnection, error) {
+    var conn models.CalendarConnection
+
+    err := h.db.Transaction(func(tx *gorm.DB) error {
+        err := tx.Where("user_id = ? AND provider = ?", userID, provider).First(&conn).Error
+        if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+            return err
+        }
+
+        conn.UserID = userID
+        conn.Provider = provider
+        conn.CalendarID = calendarID
+        conn.SyncEnabled = true
+        conn.DisabledReason = ""
+        conn.DisabledAt = nil
+        // The credentials are bound to the row, so it needs an ID first
+        if conn.ID == 0 {
+            if err := tx.Create(&conn).Error; err != nil {
+                return err
+            }
+        }
+
+        conn.Credentials, err = services.EncryptCredentials(&conn, credentials)
+        if err != nil {
+            return err
+        }
+        if err := tx.Save(&conn).Error; err != nil {
+            return err
+        }
+
+        return enqueueOpenTasks(tx, userID)
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    return &conn, nil
+}
+
+// enqueueOpenTasks queues a calendar sync for every task on the user's
+// calendar that has or should have an event.
+func enqueueOpenTasks(tx *gorm.DB, userID uint) error {
+    var tasks []models.Task
+    err := services.CalendarTasks(tx, userID).
+        Where("due_date IS NOT NULL OR id IN (?)", tx.Model(&models.TaskEventMapping{}).Select("task_id")).
+        Find(&tasks).Error
+    if err != nil {
+        return err
+    }
+
+    for i := range tasks {
+        if err := services.EnqueueTaskSync(tx, &tasks[i]); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (h *CalendarHandler) ListConnections(c *gin.Context) {
+    userID := c.GetUint("user_id")
+
+    var connections []models.CalendarConnection
+    if err := h.db.Where("user_id = ?", userID).Order("id").Find(&connections).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch calendar connections"})
+        return
+    }
+
+    c.JSON(http.StatusOK, connections)
+}
+
 type SyncToggleRequest struct {
-    UserID uint `json:"user_id" binding:"required"`
-    Enable bool `json:"enable" binding:"required"`
+    // Deprecated: the user is taken from the JWT. When sent it must match.
+    UserID   uint   `json:"user_id"`
+    Enable   *bool  `json:"enable" binding:"required"`
+    // Provider limits the toggle to one connection, all when empty
+    Provider string `json:"provider"`
 }
 
 func (h *CalendarHandler) ToggleCalendarSync(c *gin.Context) {
+    userID := c.GetUint("user_id")
+
     var req SyncToggleRequest
     if err := c.ShouldBindJSON(&req); err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
 
-    var user models.User
-    if err := h.db.First(&user, req.UserID).Error; err != nil {
-        c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+    if req.UserID != 0 && req.UserID != userID {
+        c.JSON(http.StatusForbidden, gin.H{"error": "Cannot access another user's data"})
         return
     }
 
-    user.CalendarSync = req.Enable
-    if err := h.db.Save(&user).Error; err != nil {
+    query := h.db.Model(&models.CalendarConnection{}).Where("user_id = ? AND credentials <> ''", userID)
+    if req.Provider != "" {
+        query = query.Where("provider = ?", req.Provider)
+    }
+
+    result := query.Update("sync_enabled", *req.Enable)
+    if result.Error != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update calendar sync"})
         return
     }
+    if result.RowsAffected == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "No connected calendar"})
+        return
+    }
 
     c.JSON(http.StatusOK, gin.H{
-        "message":     "Calendar sync updated",
-        "sync_enabled": req.Enable,
+        "message":      "Calendar sync updated",
+        "sync_enabled": *req.Enable,
     })
 }
 
 func (h *CalendarHandler) GetSyncStatus(c *gin.Context) {
-    userID := c.Param("user_id")
+    userID := c.GetUint("user_id")
 
-    var user models.User
-    if err := h.db.First(&user, userID).Error; err != nil {
-        c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+    var connections []models.CalendarConnection
+    if err := h.db.Where("user_id = ?", userID).Order("id").Find(&connections).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch calendar connections"})
         return
     }
 
+    syncEnabled, googleConnected := false, false
+    for _, conn := range connections {
+        connected := conn.Credentials != ""
+        syncEnabled = syncEnabled || (connected && conn.SyncEnabled)
+        googleConnected = googleConnected || (connected && conn.Provider == services.ProviderGoogle)
+    }
+
     c.JSON(http.StatusOK, gin.H{
-        "calendar_sync": user.CalendarSync,
-        "google_connected": user.GoogleToken != "",
+        "calendar_sync":    syncEnabled,
+        "google_connected": googleConnected,
+        "connections":      connections,
     })
 }
 
-func (h *CalendarHandler) DisconnectGoogle(c *gin.Context) {
-    userID := c.Param("user_id")
+// GoogleWebhook receives Google Calendar push notifications. They only
+// signal that something changed, so the connection is scheduled for an
+// immediate pull. Unknown channels are acknowledged too, Google retries
+// failed deliveries.
+func (h *CalendarHandler) GoogleWebhook(c *gin.Context) {
+    // The first message only confirms the channel was created
+    if c.GetHeader("X-Goog-Resource-State") == "sync" {
+        c.Status(http.StatusOK)
+        return
+    }
+
+    err := services.RequestPull(h.db, c.GetHeader("X-Goog-Channel-ID"), c.GetHeader("X-Goog-Channel-Token"))
+    if err != nil {
+        c.Status(http.StatusInternalServerError)
+        return
+    }
+
+    c.Status(http.StatusOK)
+}
+
+// DisconnectCalendar removes a provider connection. Events already written
+// to the external calendar are left in place.
+func (h *CalendarHandler) DisconnectCalendar(c *gin.Context) {
+    userID := c.GetUint("user_id")
+    provider := providerParam(c)
+
+    var conn models.CalendarConnection
+    if err := h.db.Where("user_id = ? AND provider = ?", userID, provider).First(&conn).Error; err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Calendar connection not found"})
+        return
+    }
+
+    err := h.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Where("connection_id = ?", conn.ID).Delete(&models.TaskEventMapping{}).Error; err != nil {
+            return err
+        }
+        return tx.Delete(&conn).Error
+    })
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disconnect calendar"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "message": "Calendar disconnected successfully",
+    })
+}
+
+type CalendarSettingsRequest struct {
+    Timezone        string                 `json:"timezone"`
+    CalendarID      string                 `json:"calendar_id"`
+    DefaultDuration int                    `json:"default_duration" binding:"omitempty,min=5,max=1440"`
+    Reminders       *models.EventReminders `json:"reminders"`
+    AllDayEvents    *bool                  `json:"all_day_events"`
+}
+
+// Google accepts at most 5 reminder overrides, up to 4 weeks before
+const (
+    maxReminderOverrides = 5
+    maxReminderMinutes   = 40320
+)
+
+func (h *CalendarHandler) GetCalendarSettings(c *gin.Context) {
+    userID := c.GetUint("user_id")
 
     var user models.User
     if err := h.db.First(&user, userID).Error; err != nil {
@@ -144,14 +400,83 @@ func (h *CalendarHandler) DisconnectGoogle(c *gin.Context) {
         return
     }
 
-    user.GoogleToken = ""
-    user.CalendarSync = false
-    if err := h.db.Save(&user).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disconnect Google Calendar"})
+    c.JSON(http.StatusOK, calendarSettingsResponse(&user))
+}
+
+func (h *CalendarHandler) UpdateCalendarSettings(c *gin.Context) {
+    userID := c.GetUint("user_id")
+
+    var req CalendarSettingsRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
 
-    c.JSON(http.StatusOK, gin.H{
-        "message": "Google Calendar disconnected successfully",
+    if req.Timezone != "" {
+        if _, err := time.LoadLocation(req.Timezone); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone"})
+            return
+        }
+    }
+
+    if req.Reminders != nil {
+        if len(*req.Reminders) > maxReminderOverrides {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "At most 5 reminders are allowed"})
+            return
+        }
+        for _, reminder := range *req.Reminders {
+            if reminder.Method != "email" && reminder.Method != "popup" {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Reminder method must be email or popup"})
+                return
+            }
+            if reminder.Minutes < 0 || reminder.Minutes > maxReminderMinutes {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Reminder minutes must be between 0 and 40320"})
+                return
+            }
+        }
+    }
+
+    var user models.User
+    if err := h.db.First(&user, userID).Error; err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+        return
+    }
+
+    if req.Timezone != "" {
+        user.Timezone = req.Timezone
+    }
+    if req.CalendarID != "" {
+        user.CalendarPreferences.CalendarID = req.CalendarID
+    }
+    if req.DefaultDuration != 0 {
+        user.CalendarPreferences.DefaultDuration = req.DefaultDuration
+    }
+    if req.Reminders != nil {
+        user.CalendarPreferences.Reminders = req.Reminders
+    }
+    if req.AllDayEvents != nil {
+        user.CalendarPreferences.AllDayEvents = *req.AllDayEvents
+    }
+
+    err := h.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Save(&user).Error; err != nil {
+            return err
+        }
+
+        // Re-render existing events with the new preferences
+        return enqueueOpenTasks(tx, userID)
     })
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update calendar settings"})
+        return
+    }
+
+    c.JSON(http.StatusOK, calendarSettingsResponse(&user))
+}
+
+func calendarSettingsResponse(user *models.User) gin.H {
+    return gin.H{
+        "timezone":             user.Timezone,
+        "calendar_preferences": user.CalendarPreferences,
+    }
 }
@@ -0,0 +1,452 @@
+package handlers
+
+import (
+    "encoding/base64"
+    "errors"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+    "taskflow/internal/models"
+    "taskflow/internal/services"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+)
+
+const (
+    // Range listed when the client does not pass one
+    defaultEventsPast   = 30 * 24 * time.Hour
+    defaultEventsFuture = 90 * 24 * time.Hour
+    maxEventsRange      = 366 * 24 * time.Hour
+)
+
+type CalendarEventRequest struct {
+    Title       *string `json:"title"`
+    Description *string `json:"description"`
+    Start       *string `json:"start"`
+    End         *string `json:"end"`
+    AllDay      *bool   `json:"all_day"`
+    // TaskID schedules the task instead of creating a separate event
+    TaskID *uint `json:"task_id,string"`
+    // Provider picks the calendar new events go to, the first connected
+    // one when empty
+    Provider string `json:"provider"`
+}
+
+// Event IDs in the API are "task-<id>" for events rendered from a task and
+// "<provider>-<base64url event id>" for events of a connected calendar, as
+// provider IDs may contain slashes.
+func apiEventID(event *services.CalendarEvent) string {
+    if event.Provider == "" && event.TaskID != nil {
+        return "task-" + strconv.FormatUint(uint64(*event.TaskID), 10)
+    }
+    return event.Provider + "-" + base64.RawURLEncoding.EncodeToString([]byte(event.ID))
+}
+
+func parseEventID(id string) (provider, eventID string, taskID uint, err error) {
+    prefix, rest, ok := strings.Cut(id, "-")
+    if !ok || rest == "" {
+        return "", "", 0, errors.New("invalid event ID")
+    }
+
+    if prefix == "task" {
+        n, err := strconv.ParseUint(rest, 10, 32)
+        if err != nil {
+            return "", "", 0, errors.New("invalid event ID")
+        }
+        return "", "", uint(n), nil
+    }
+
+    decoded, err := base64.RawURLEncoding.DecodeString(rest)
+    if err != nil {
+        return "", "", 0, errors.New("invalid event ID")
+    }
+    return prefix, string(decoded), 0, nil
+}
+
+func eventResponse(event services.CalendarEvent) services.CalendarEvent {
+    event.ID = apiEventID(&event)
+    return event
+}
+
+func (h *CalendarHandler) ListEvents(c *gin.Context) {
+    userID := c.GetUint("user_id")
+
+    now := time.Now()
+    start, end := now.Add(-defaultEventsPast), now.Add(defaultEventsFuture)
+    if value := c.Query("start"); value != "" {
+        t, err := parseTime(value)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start"})
+            return
+        }
+        start = *t
+    }
+    if value := c.Query("end"); value != "" {
+        t, err := parseTime(value)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end"})
+            return
+        }
+        end = *t
+    }
+    if !end.After(start) || end.Sub(start) > maxEventsRange {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "end must be after start and at most one year later"})
+        return
+    }
+
+    var user models.User
+    if err := h.db.First(&user, userID).Error; err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+        return
+    }
+
+    events, err := services.NewCalendarEventService(h.db).ListEvents(c.Request.Context(), &user, start, end)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events"})
+        return
+    }
+
+    response := make([]services.CalendarEvent, 0, len(events))
+    for _, event := range events {
+        response = append(response, eventResponse(event))
+    }
+
+    c.JSON(http.StatusOK, response)
+}
+
+func (h *CalendarHandler) CreateEvent(c *gin.Context) {
+    userID := c.GetUint("user_id")
+
+    var req CalendarEventRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if req.Start == nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "start is required"})
+        return
+    }
+    if req.TaskID == nil && (req.Title == nil || *req.Title == "") {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "title is required"})
+        return
+    }
+
+    var user models.User
+    if err := h.db.First(&user, userID).Error; err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+        return
+    }
+
+    if req.TaskID != nil {
+        h.updateTaskEvent(c, &user, *req.TaskID, &req, http.StatusCreated)
+        return
+    }
+
+    event := services.CalendarEvent{Title: *req.Title}
+    if req.Description != nil {
+        event.Description = *req.Description
+    }
+    if !applyEventTimes(c, &user, &event, &req) {
+        return
+    }
+
+    svc := services.NewCalendarEventService(h.db)
+    conn, err := svc.Connection(userID, req.Provider)
+    if err != nil {
+        respondEventError(c, err, "Failed to create event")
+        return
+    }
+
+    created, err := svc.CreateEvent(c.Request.Context(), conn, &user, &event)
+    if err != nil {
+        respondEventError(c, err, "Failed to create event")
+        return
+    }
+
+    c.JSON(http.StatusCreated, eventResponse(*created))
+}
+
+func (h *CalendarHandler) UpdateEvent(c *gin.Context) {
+    userID := c.GetUint("user_id")
+
+    provider, eventID, taskID, err := parseEventID(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    var req CalendarEventRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    var user models.User
+    if err := h.db.First(&user, userID).Error; err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+        return
+    }
+
+    if taskID != 0 {
+        h.updateTaskEvent(c, &user, taskID, &req, http.StatusOK)
+        return
+    }
+
+    svc := services.NewCalendarEventService(h.db)
+    conn, err := svc.Connection(userID, provider)
+    if err != nil {
+        respondEventError(c, err, "Failed to update event")
+        return
+    }
+
+    event, err := svc.GetEvent(c.Request.Context(), conn, &user, eventID)
+    if err != nil {
+        respondEventError(c, err, "Failed to update event")
+        return
+    }
+
+    // Events written for a task change through the task, otherwise the
+    // next sync would put them back
+    if event.TaskID != nil {
+        h.updateTaskEvent(c, &user, *event.TaskID, &req, http.StatusOK)
+        return
+    }
+
+    if req.Title != nil {
+        event.Title = *req.Title
+    }
+    if req.Description != nil {
+        event.Description = *req.Description
+    }
+    if !applyEventTimes(c, &user, event, &req) {
+        return
+    }
+
+    updated, err := svc.UpdateEvent(c.Request.Context(), conn, &user, event)
+    if err != nil {
+        respondEventError(c, err, "Failed to update event")
+        return
+    }
+
+    c.JSON(http.StatusOK, eventResponse(*updated))
+}
+
+func (h *CalendarHandler) DeleteEvent(c *gin.Context) {
+    userID := c.GetUint("user_id")
+
+    provider, eventID, taskID, err := parseEventID(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    if taskID != 0 {
+        h.unscheduleTask(c, userID, taskID)
+        return
+    }
+
+    var user models.User
+    if err := h.db.First(&user, userID).Error; err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+        return
+    }
+
+    svc := services.NewCalendarEventService(h.db)
+    conn, err := svc.Connection(userID, provider)
+    if err != nil {
+        respondEventError(c, err, "Failed to delete event")
+        return
+    }
+
+    event, err := svc.GetEvent(c.Request.Context(), conn, &user, eventID)
+    if err != nil {
+        respondEventError(c, err, "Failed to delete event")
+        return
+    }
+    if event.TaskID != nil {
+        h.unscheduleTask(c, userID, *event.TaskID)
+        return
+    }
+
+    if err := svc.DeleteEvent(c.Request.Context(), conn, &user, eventID); err != nil {
+        respondEventError(c, err, "Failed to delete event")
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Event deleted successfully"})
+}
+
+// findCalendarTask loads a task on the user's calendar they may change.
+func (h *CalendarHandler) findCalendarTask(c *gin.Context, userID, taskID uint) (*models.Task, bool) {
+    var task models.Task
+    if err := services.CalendarTasks(h.db, userID).Where("id = ?", taskID).First(&task).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+        } else {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch task"})
+        }
+        return nil, false
+    }
+
+    allowed, err := services.CanEditTask(h.db, userID, &task)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch task"})
+        return nil, false
+    }
+    if !allowed {
+        c.JSON(http.StatusForbidden, gin.H{"error": "Your role doesn't allow this"})
+        return nil, false
+    }
+    return &task, true
+}
+
+// updateTaskEvent applies an event change to the task it renders: the
+// title and description are the task's, the start becomes its due date.
+func (h *CalendarHandler) updateTaskEvent(c *gin.Context, user *models.User, taskID uint, req *CalendarEventRequest, status int) {
+    task, ok := h.findCalendarTask(c, user.ID, taskID)
+    if !ok {
+        return
+    }
+
+    if req.Title != nil && *req.Title != "" {
+        task.Title = *req.Title
+    }
+    if req.Description != nil {
+        task.Description = *req.Description
+    }
+    if req.Start != nil {
+        dueDate, err := parseTime(*req.Start)
+        if err != nil || dueDate == nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start"})
+            return
+        }
+        task.DueDate = dueDate
+        task.DueDateAllDay = isDateOnly(*req.Start)
+    }
+    if req.AllDay != nil && task.DueDate != nil {
+        task.DueDateAllDay = *req.AllDay
+        if *req.AllDay {
+            due := task.DueDate.UTC()
+            midnight := time.Date(due.Year(), due.Month(), due.Day(), 0, 0, 0, 0, time.UTC)
+            task.DueDate = &midnight
+        }
+    }
+    if task.DueDate == nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "start is required"})
+        return
+    }
+
+    err := h.db.Transaction(func(tx *gorm.DB) error {
+        if err := services.SaveTask(tx, task); err != nil {
+            return err
+        }
+        return services.EnqueueTaskSync(tx, task)
+    })
+    if err != nil {
+        respondTaskSaved(c, task, err)
+        return
+    }
+
+    c.JSON(status, eventResponse(services.TaskCalendarEvent(user, task)))
+}
+
+// unscheduleTask clears the due date of the task behind a deleted event.
+// The task itself is kept. Recurring tasks need their due date, their
+// events can't be deleted.
+func (h *CalendarHandler) unscheduleTask(c *gin.Context, userID, taskID uint) {
+    task, ok := h.findCalendarTask(c, userID, taskID)
+    if !ok {
+        return
+    }
+
+    if task.Recurrence != "" {
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": services.ErrRecurrenceNeedsDueDate.Error()})
+        return
+    }
+
+    task.DueDate = nil
+    task.DueDateAllDay = false
+    err := h.db.Transaction(func(tx *gorm.DB) error {
+        if err := services.SaveTask(tx, task); err != nil {
+            return err
+        }
+        return services.EnqueueTaskSync(tx, task)
+    })
+    if err != nil {
+        respondTaskSaved(c, task, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Event deleted successfully"})
+}
+
+// applyEventTimes sets the start and end of an event from the request. A
+// missing end keeps the event's length, or uses the user's default duration
+// for new events. It writes the error response and returns false when the
+// times are invalid.
+func applyEventTimes(c *gin.Context, user *models.User, event *services.CalendarEvent, req *CalendarEventRequest) bool {
+    length := event.End.Sub(event.Start)
+    if event.Start.IsZero() || length <= 0 {
+        length = time.Duration(user.CalendarPreferences.DefaultDuration) * time.Minute
+        if length <= 0 {
+            length = time.Hour
+        }
+    }
+
+    if req.AllDay != nil {
+        event.AllDay = *req.AllDay
+    }
+    if req.Start != nil {
+        start, err := parseTime(*req.Start)
+        if err != nil || start == nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start"})
+            return false
+        }
+        event.Start = *start
+        if req.AllDay == nil {
+            event.AllDay = isDateOnly(*req.Start)
+        }
+    }
+
+    if req.End != nil {
+        end, err := parseTime(*req.End)
+        if err != nil || end == nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end"})
+            return false
+        }
+        event.End = *end
+    } else {
+        event.End = event.Start.Add(length)
+    }
+
+    if event.AllDay {
+        // All-day events span whole days with an exclusive end date
+        event.Start = time.Date(event.Start.Year(), event.Start.Month(), event.Start.Day(), 0, 0, 0, 0, time.UTC)
+        end := time.Date(event.End.Year(), event.End.Month(), event.End.Day(), 0, 0, 0, 0, time.UTC)
+        if !end.After(event.Start) {
+            end = event.Start.AddDate(0, 0, 1)
+        }
+        event.End = end
+    }
+
+    if !event.End.After(event.Start) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "end must be after start"})
+        return false
+    }
+    return true
+}
+
+func respondEventError(c *gin.Context, err error, message string) {
+    switch {
+    case errors.Is(err, services.ErrNoCalendarConnection):
+        c.JSON(http.StatusNotFound, gin.H{"error": "No connected calendar"})
+    case errors.Is(err, services.ErrEventNotFound):
+        c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+    case errors.Is(err, services.ErrCredentialsRevoked):
+        c.JSON(http.StatusConflict, gin.H{"error": "Calendar access was revoked, reconnect to continue"})
+    default:
+        c.JSON(http.StatusBadGateway, gin.H{"error": message})
+    }
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+    "fmt"
+    "net/http"
+    "testing"
+    "time"
+    "taskflow/internal/models"
+
+    "github.com/gin-gonic/gin"
+)
+
+func TestDeleteTaskEventKeepsRecurringDueDate(t *testing.T) {
+    testDB := newTestDB(t, &models.User{}, &models.Task{}, &models.SyncJob{}, &models.CalendarConnection{}, &models.TaskEventMapping{}, &models.WorkspaceMember{})
+    InitDB(testDB)
+    t.Cleanup(func() { InitDB(nil) })
+
+    due := time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)
+    recurring := models.Task{UserID: 1, Title: "Water the plants", DueDate: &due, Recurrence: "FREQ=WEEKLY"}
+    once := models.Task{UserID: 1, Title: "Renew passport", DueDate: &due}
+    for _, task := range []*models.Task{&recurring, &once} {
+        if err := testDB.Create(task).Error; err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    h := NewCalendarHandler(testDB)
+    gin.SetMode(gin.TestMode)
+    r := gin.New()
+    r.Use(func(c *gin.Context) {
+        c.Set("user_id", uint(1))
+        c.Next()
+    })
+    r.DELETE("/api/calendar/events/:id", h.DeleteEvent)
+
+    for _, tc := range []struct {
+        task    *models.Task
+        want    int
+        keepDue bool
+    }{
+        {&recurring, http.StatusUnprocessableEntity, true},
+        {&once, http.StatusOK, false},
+    } {
+        w := serve(r, http.MethodDelete, fmt.Sprintf("/api/calendar/events/task-%d", tc.task.ID), "")
+        if w.Code != tc.want {
+            t.Errorf("%s: got %d, want %d: %s", tc.task.Title, w.Code, tc.want, w.Body)
+        }
+
+        var task models.Task
+        if err := testDB.First(&task, tc.task.ID).Error; err != nil {
+            t.Fatal(err)
+        }
+        if (task.DueDate != nil) != tc.keepDue {
+            t.Errorf("%s: got due date %v, want kept %v", tc.task.Title, task.DueDate, tc.keepDue)
+        }
+    }
+}
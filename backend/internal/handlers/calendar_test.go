@@ -0,0 +1,184 @@
+package handlers
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "taskflow/internal/middleware"
+    "taskflow/internal/models"
+
+    "github.com/gin-gonic/gin"
+    "github.com/glebarez/sqlite"
+    "gorm.io/gorm"
+    "gorm.io/gorm/logger"
+)
+
+// newTestDB opens an in-memory SQLite database of its own for a test.
+func newTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+    t.Helper()
+
+    dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", strings.ReplaceAll(t.Name(), "/", "_"))
+    testDB, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := testDB.AutoMigrate(models...); err != nil {
+        t.Fatal(err)
+    }
+
+    sqlDB, err := testDB.DB()
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { sqlDB.Close() })
+    return testDB
+}
+
+// calendarTestRouter serves the calendar routes of main.go as the user
+// userID, standing in for AuthMiddleware.
+func calendarTestRouter(h *CalendarHandler, userID uint) *gin.Engine {
+    gin.SetMode(gin.TestMode)
+    r := gin.New()
+    r.Use(func(c *gin.Context) {
+        c.Set("user_id", userID)
+        c.Next()
+    })
+
+    r.POST("/api/calendar/sync", h.ToggleCalendarSync)
+    r.GET("/api/calendar/status", h.GetSyncStatus)
+    r.POST("/api/calendar/disconnect", h.DisconnectCalendar)
+    r.GET("/api/calendar/status/:user_id", middleware.DeprecatedUserParam("user_id"), h.GetSyncStatus)
+    r.POST("/api/calendar/disconnect/:user_id", middleware.DeprecatedUserParam("user_id"), h.DisconnectCalendar)
+    return r
+}
+
+// newCalendarTest connects users 1 and 2 to Google Calendar.
+func newCalendarTest(t *testing.T) *CalendarHandler {
+    testDB := newTestDB(t, &models.User{}, &models.CalendarConnection{}, &models.TaskEventMapping{})
+    for _, userID := range []uint{1, 2} {
+        conn := models.CalendarConnection{
+            UserID:      userID,
+            Provider:    "google",
+            Credentials: fmt.Sprintf("token-%d", userID),
+            SyncEnabled: true,
+        }
+        if err := testDB.Create(&conn).Error; err != nil {
+            t.Fatal(err)
+        }
+    }
+    return NewCalendarHandler(testDB)
+}
+
+func serve(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+    return serveWith(r, method, path, body, nil)
+}
+
+// serveWith sends a JSON request with extra headers, which may replace the
+// Content-Type.
+func serveWith(r *gin.Engine, method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+    req := httptest.NewRequest(method, path, strings.NewReader(body))
+    req.Header.Set("Content-Type", "application/json")
+    for name, value := range headers {
+        req.Header.Set(name, value)
+    }
+    w := httptest.NewRecorder()
+    r.ServeHTTP(w, req)
+    return w
+}
+
+func connection(t *testing.T, h *CalendarHandler, userID uint) *models.CalendarConnection {
+    t.Helper()
+
+    var conns []models.CalendarConnection
+    if err := h.db.Where("user_id = ?", userID).Find(&conns).Error; err != nil {
+        t.Fatal(err)
+    }
+    if len(conns) == 0 {
+        return nil
+    }
+    return &conns[0]
+}
+
+func TestDeprecatedUserRoutesRefuseOtherUsers(t *testing.T) {
+    h := newCalendarTest(t)
+    r := calendarTestRouter(h, 1)
+
+    for _, tc := range []struct {
+        method, path string
+    }{
+        {http.MethodGet, "/api/calendar/status/2"},
+        {http.MethodPost, "/api/calendar/disconnect/2"},
+        {http.MethodGet, "/api/calendar/status/abc"},
+    } {
+        if w := serve(r, tc.method, tc.path, ""); w.Code != http.StatusForbidden {
+            t.Errorf("%s %s: got %d, want 403", tc.method, tc.path, w.Code)
+        }
+    }
+
+    if connection(t, h, 2) == nil {
+        t.Fatal("another user's connection was disconnected")
+    }
+
+    if w := serve(r, http.MethodGet, "/api/calendar/status/1", ""); w.Code != http.StatusOK {
+        t.Errorf("own status: got %d, want 200", w.Code)
+    }
+}
+
+func TestToggleCalendarSyncRefusesOtherUser(t *testing.T) {
+    h := newCalendarTest(t)
+    r := calendarTestRouter(h, 1)
+
+    w := serve(r, http.MethodPost, "/api/calendar/sync", `{"user_id": 2, "enable": false}`)
+    if w.Code != http.StatusForbidden {
+        t.Fatalf("got %d, want 403", w.Code)
+    }
+
+    for _, userID := range []uint{1, 2} {
+        if conn := connection(t, h, userID); !conn.SyncEnabled {
+            t.Errorf("user %d: sync was disabled", userID)
+        }
+    }
+}
+
+func TestCalendarRoutesActOnOwnConnection(t *testing.T) {
+    h := newCalendarTest(t)
+    r := calendarTestRouter(h, 1)
+
+    w := serve(r, http.MethodPost, "/api/calendar/sync", `{"enable": false}`)
+    if w.Code != http.StatusOK {
+        t.Fatalf("sync: got %d, want 200", w.Code)
+    }
+    if connection(t, h, 1).SyncEnabled {
+        t.Error("sync: own connection still enabled")
+    }
+    if !connection(t, h, 2).SyncEnabled {
+        t.Error("sync: another user's connection was disabled")
+    }
+
+    w = serve(r, http.MethodGet, "/api/calendar/status", "")
+    if w.Code != http.StatusOK {
+        t.Fatalf("status: got %d, want 200", w.Code)
+    }
+    var status struct {
+        Connections []models.CalendarConnection `json:"connections"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+        t.Fatal(err)
+    }
+    if len(status.Connections) != 1 || status.Connections[0].UserID != 1 {
+        t.Errorf("status: got connections %+v, want only user 1's", status.Connections)
+    }
+
+    if w := serve(r, http.MethodPost, "/api/calendar/disconnect", ""); w.Code != http.StatusOK {
+        t.Fatalf("disconnect: got %d, want 200", w.Code)
+    }
+    if connection(t, h, 1) != nil {
+        t.Error("disconnect: own connection still there")
+    }
+    if connection(t, h, 2) == nil {
+        t.Error("disconnect: another user's connection was removed")
+    }
+}
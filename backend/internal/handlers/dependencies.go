@@ -0,0 +1,151 @@
+package handlers
+
+import (
+    "errors"
+    "net/http"
+    "strconv"
+    "taskflow/internal/models"
+    "taskflow/internal/services"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+)
+
+// DependencyRequest links the task in the path to another one, either
+// blocked by it or blocking it.
+type DependencyRequest struct {
+    BlockedBy *uint `json:"blocked_by"`
+    Blocks    *uint `json:"blocks"`
+}
+
+type dependenciesResponse struct {
+    BlockedBy []models.TaskRef `json:"blocked_by"`
+    Blocks    []models.TaskRef `json:"blocks"`
+}
+
+// GetDependencies lists the tasks blocking the task, finished or not, and
+// the tasks it blocks.
+func GetDependencies(c *gin.Context) {
+    task, ok := findTask(c, services.PermView)
+    if !ok {
+        return
+    }
+
+    response, err := taskDependencies(task.ID)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dependencies"})
+        return
+    }
+
+    c.JSON(http.StatusOK, response)
+}
+
+func AddDependency(c *gin.Context) {
+    task, ok := findTask(c, services.PermEdit)
+    if !ok {
+        return
+    }
+
+    var req DependencyRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if (req.BlockedBy == nil) == (req.Blocks == nil) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Either blocked_by or blocks is required"})
+        return
+    }
+
+    blockerID, blockedID := task.ID, task.ID
+    otherID := req.Blocks
+    if req.BlockedBy != nil {
+        blockerID, otherID = *req.BlockedBy, req.BlockedBy
+    } else {
+        blockedID = *req.Blocks
+    }
+
+    var other models.Task
+    if err := services.TaskSpace(task).Scope(db).Where("id = ?", *otherID).First(&other).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Linked task not found"})
+        } else {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch task"})
+        }
+        return
+    }
+
+    err := db.Transaction(func(tx *gorm.DB) error {
+        return services.AddDependency(tx, blockerID, blockedID)
+    })
+    if errors.Is(err, services.ErrDependencyCycle) {
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add dependency"})
+        return
+    }
+
+    response, err := taskDependencies(task.ID)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dependencies"})
+        return
+    }
+
+    c.JSON(http.StatusCreated, response)
+}
+
+// RemoveDependency removes the link between the task and another one,
+// whichever way it goes.
+func RemoveDependency(c *gin.Context) {
+    task, ok := findTask(c, services.PermEdit)
+    if !ok {
+        return
+    }
+    otherID, err := strconv.Atoi(c.Param("other_id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+        return
+    }
+
+    result := db.Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)", task.ID, otherID, otherID, task.ID).
+        Delete(&models.TaskDependency{})
+    if result.Error != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove dependency"})
+        return
+    }
+    if result.RowsAffected == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Dependency not found"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Dependency removed successfully"})
+}
+
+func taskDependencies(taskID uint) (*dependenciesResponse, error) {
+    response := &dependenciesResponse{
+        BlockedBy: []models.TaskRef{},
+        Blocks:    []models.TaskRef{},
+    }
+
+    err := db.Model(&models.Task{}).
+        Select("tasks.id, tasks.title, tasks.status").
+        Joins("JOIN task_dependencies ON task_dependencies.blocker_id = tasks.id").
+        Where("task_dependencies.blocked_id = ?", taskID).
+        Order("tasks.id").
+        Scan(&response.BlockedBy).Error
+    if err != nil {
+        return nil, err
+    }
+
+    err = db.Model(&models.Task{}).
+        Select("tasks.id, tasks.title, tasks.status").
+        Joins("JOIN task_dependencies ON task_dependencies.blocked_id = tasks.id").
+        Where("task_dependencies.blocker_id = ?", taskID).
+        Order("tasks.id").
+        Scan(&response.Blocks).Error
+    if err != nil {
+        return nil, err
+    }
+    return response, nil
+}
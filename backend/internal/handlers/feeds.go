@@ -0,0 +1,265 @@
+package handlers
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+    "taskflow/internal/auth"
+    "taskflow/internal/models"
+    "taskflow/internal/services"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+)
+
+var feedItemTypes = []string{services.FeedItemEvent, services.FeedItemTodo, services.FeedItemBoth}
+
+type FeedRequest struct {
+    Name       *string  `json:"name"`
+    ItemType   *string  `json:"item_type"`
+    Statuses   []string `json:"statuses"`
+    Priorities []string `json:"priorities"`
+}
+
+// feedResponse includes the feed URL, only available right after the token
+// was generated.
+type feedResponse struct {
+    models.CalendarFeed
+    URL string `json:"url,omitempty"`
+}
+
+func GetFeeds(c *gin.Context) {
+    userID := c.GetUint("user_id")
+
+    var feeds []models.CalendarFeed
+    if err := db.Where("user_id = ?", userID).Order("id").Find(&feeds).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feeds"})
+        return
+    }
+
+    c.JSON(http.StatusOK, feeds)
+}
+
+func CreateFeed(c *gin.Context) {
+    userID := c.GetUint("user_id")
+
+    var req FeedRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    feed := models.CalendarFeed{
+        UserID:   userID,
+        ItemType: services.FeedItemEvent,
+    }
+    if err := applyFeedRequest(&feed, &req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    token, hash, err := auth.GenerateSecretToken()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate feed token"})
+        return
+    }
+    feed.TokenHash = hash
+
+    if err := db.Create(&feed).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create feed"})
+        return
+    }
+
+    c.JSON(http.StatusCreated, feedResponse{CalendarFeed: feed, URL: feedURL(c, token)})
+}
+
+func UpdateFeed(c *gin.Context) {
+    feed, ok := findFeed(c)
+    if !ok {
+        return
+    }
+
+    var req FeedRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if err := applyFeedRequest(feed, &req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    if err := db.Save(feed).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update feed"})
+        return
+    }
+
+    c.JSON(http.StatusOK, feed)
+}
+
+// RegenerateFeedToken replaces the feed's token, the old URL stops working.
+func RegenerateFeedToken(c *gin.Context) {
+    feed, ok := findFeed(c)
+    if !ok {
+        return
+    }
+
+    token, hash, err := auth.GenerateSecretToken()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate feed token"})
+        return
+    }
+
+    feed.TokenHash = hash
+    if err := db.Save(feed).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update feed"})
+        return
+    }
+
+    c.JSON(http.StatusOK, feedResponse{CalendarFeed: *feed, URL: feedURL(c, token)})
+}
+
+// DeleteFeed revokes the feed.
+func DeleteFeed(c *gin.Context) {
+    feed, ok := findFeed(c)
+    if !ok {
+        return
+    }
+
+    if err := db.Delete(feed).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete feed"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Feed revoked successfully"})
+}
+
+// GetTaskFeed serves the iCalendar feed behind a secret token. It needs no
+// other authentication, calendar apps can't send any.
+func GetTaskFeed(c *gin.Context) {
+    var feed models.CalendarFeed
+    if err := db.Where("token_hash = ?", auth.HashSecretToken(c.Param("token"))).First(&feed).Error; err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Feed not found"})
+        return
+    }
+
+    var user models.User
+    if err := db.First(&user, feed.UserID).Error; err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Feed not found"})
+        return
+    }
+
+    query := services.CalendarTasks(db, feed.UserID)
+    if len(feed.Statuses) > 0 {
+        query = query.Where("status IN ?", []string(feed.Statuses))
+    }
+    if len(feed.Priorities) > 0 {
+        query = query.Where("priority IN ?", []string(feed.Priorities))
+    }
+    if feed.ItemType == services.FeedItemEvent {
+        query = query.Where("due_date IS NOT NULL")
+    }
+
+    var tasks []models.Task
+    if err := query.Order("id").Find(&tasks).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tasks"})
+        return
+    }
+
+    body := services.RenderTaskFeed(&feed, &user, tasks).String()
+    sum := sha256.Sum256([]byte(body))
+    etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+    c.Header("ETag", etag)
+    c.Header("Cache-Control", "private, no-cache")
+    if etagMatches(c.GetHeader("If-None-Match"), etag) {
+        c.Status(http.StatusNotModified)
+        return
+    }
+
+    c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(body))
+}
+
+func findFeed(c *gin.Context) (*models.CalendarFeed, bool) {
+    userID := c.GetUint("user_id")
+    feedID, err := strconv.Atoi(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feed ID"})
+        return nil, false
+    }
+
+    var feed models.CalendarFeed
+    if err := db.Where("id = ? AND user_id = ?", feedID, userID).First(&feed).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Feed not found"})
+        } else {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feed"})
+        }
+        return nil, false
+    }
+    return &feed, true
+}
+
+func applyFeedRequest(feed *models.CalendarFeed, req *FeedRequest) error {
+    if req.Name != nil {
+        feed.Name = *req.Name
+    }
+    if req.ItemType != nil {
+        if !contains(feedItemTypes, *req.ItemType) {
+            return fmt.Errorf("item_type must be one of %s", strings.Join(feedItemTypes, ", "))
+        }
+        feed.ItemType = *req.ItemType
+    }
+    if req.Statuses != nil {
+        for _, status := range req.Statuses {
+            if !models.ValidTaskStatus(status) {
+                return fmt.Errorf("invalid status %q", status)
+            }
+        }
+        feed.Statuses = req.Statuses
+    }
+    if req.Priorities != nil {
+        for _, priority := range req.Priorities {
+            if !models.ValidTaskPriority(priority) {
+                return fmt.Errorf("invalid priority %q", priority)
+            }
+        }
+        feed.Priorities = req.Priorities
+    }
+    return nil
+}
+
+func feedURL(c *gin.Context, token string) string {
+    scheme := "http"
+    if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+        scheme = "https"
+    }
+    return scheme + "://" + c.Request.Host + "/api/feeds/" + token + "/tasks.ics"
+}
+
+// etagMatches implements the weak comparison If-None-Match asks for.
+func etagMatches(header, etag string) bool {
+    if header == "" {
+        return false
+    }
+    for _, candidate := range strings.Split(header, ",") {
+        candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+        if candidate == "*" || candidate == etag {
+            return true
+        }
+    }
+    return false
+}
+
+func contains(values []string, value string) bool {
+    for _, v := range values {
+        if v == value {
+            return true
+        }
+    }
+    return false
+}
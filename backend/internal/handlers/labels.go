@@ -0,0 +1,329 @@
+package handlers
+
+import (
+    "errors"
+    "net/http"
+    "regexp"
+    "strconv"
+    "strings"
+    "taskflow/internal/models"
+    "taskflow/internal/services"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+)
+
+const (
+    maxLabelName = 64
+    defaultColor = "#6b7280"
+)
+
+// hexColor matches the #rrggbb colours of labels and projects.
+var hexColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+type LabelRequest struct {
+    Name  *string `json:"name"`
+    Color *string `json:"color"`
+}
+
+// MergeLabelRequest names the label another one is merged into.
+type MergeLabelRequest struct {
+    Into uint `json:"into" binding:"required"`
+}
+
+// TaskLabelsRequest is the full set of labels of a task.
+type TaskLabelsRequest struct {
+    LabelIDs []uint `json:"label_ids"`
+}
+
+func GetLabels(c *gin.Context) {
+    access, ok := authorize(c, services.PermView)
+    if !ok {
+        return
+    }
+
+    var labels []models.Label
+    if err := access.Scope(db).Order("name").Find(&labels).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch labels"})
+        return
+    }
+
+    c.JSON(http.StatusOK, labels)
+}
+
+func CreateLabel(c *gin.Context) {
+    access, ok := authorize(c, services.PermEdit)
+    if !ok {
+        return
+    }
+
+    var req LabelRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if req.Name == nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+        return
+    }
+
+    label := models.Label{UserID: access.UserID, WorkspaceID: access.WorkspaceID, Color: defaultColor}
+    if !applyLabelRequest(c, &label, &req) {
+        return
+    }
+
+    if err := db.Create(&label).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create label"})
+        return
+    }
+
+    c.JSON(http.StatusCreated, label)
+}
+
+// UpdateLabel renames or recolours a label, which every task carrying it
+// shows at once. Renaming to the name of another label is refused with 409
+// and that label's ID; MergeLabel combines them.
+func UpdateLabel(c *gin.Context) {
+    label, ok := findLabel(c, c.Param("id"), services.PermEdit)
+    if !ok {
+        return
+    }
+
+    var req LabelRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if !applyLabelRequest(c, label, &req) {
+        return
+    }
+
+    if err := db.Save(label).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update label"})
+        return
+    }
+
+    c.JSON(http.StatusOK, label)
+}
+
+// DeleteLabel deletes a label and removes it from its tasks.
+func DeleteLabel(c *gin.Context) {
+    label, ok := findLabel(c, c.Param("id"), services.PermEdit)
+    if !ok {
+        return
+    }
+
+    err := db.Transaction(func(tx *gorm.DB) error {
+        return services.DeleteLabel(tx, label)
+    })
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete label"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Label deleted successfully"})
+}
+
+// MergeLabel moves every task of a label to the label named in the body
+// and deletes the first one. It answers the label merged into.
+func MergeLabel(c *gin.Context) {
+    label, ok := findLabel(c, c.Param("id"), services.PermEdit)
+    if !ok {
+        return
+    }
+
+    var req MergeLabelRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if req.Into == label.ID {
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "A label can't be merged into itself"})
+        return
+    }
+
+    var into models.Label
+    if err := labelSpace(label).Scope(db).Where("id = ?", req.Into).First(&into).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Label to merge into not found"})
+        } else {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch label"})
+        }
+        return
+    }
+
+    err := db.Transaction(func(tx *gorm.DB) error {
+        return services.MergeLabel(tx, label, &into)
+    })
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge labels"})
+        return
+    }
+
+    c.JSON(http.StatusOK, into)
+}
+
+// SetTaskLabels replaces the labels of a task.
+func SetTaskLabels(c *gin.Context) {
+    task, ok := findTask(c, services.PermEdit)
+    if !ok || !taskIfMatch(c, task) {
+        return
+    }
+
+    var req TaskLabelsRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    err := db.Transaction(func(tx *gorm.DB) error {
+        if err := services.SetTaskLabels(tx, task, req.LabelIDs); err != nil {
+            return err
+        }
+        return services.SaveTask(tx, task)
+    })
+    respondTaskLabels(c, task, err)
+}
+
+// AddTaskLabel attaches a label to a task.
+func AddTaskLabel(c *gin.Context) {
+    task, ok := findTask(c, services.PermEdit)
+    if !ok || !taskIfMatch(c, task) {
+        return
+    }
+    label, ok := findLabel(c, c.Param("label_id"), services.PermEdit)
+    if !ok {
+        return
+    }
+
+    err := db.Transaction(func(tx *gorm.DB) error {
+        if err := services.AddTaskLabel(tx, task, label); err != nil {
+            return err
+        }
+        return services.SaveTask(tx, task)
+    })
+    respondTaskLabels(c, task, err)
+}
+
+// RemoveTaskLabel detaches a label from a task.
+func RemoveTaskLabel(c *gin.Context) {
+    task, ok := findTask(c, services.PermEdit)
+    if !ok || !taskIfMatch(c, task) {
+        return
+    }
+    labelID, err := strconv.Atoi(c.Param("label_id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid label ID"})
+        return
+    }
+
+    var removed int64
+    err = db.Transaction(func(tx *gorm.DB) error {
+        result := tx.Where("task_id = ? AND label_id = ?", task.ID, labelID).Delete(&models.TaskLabel{})
+        if result.Error != nil || result.RowsAffected == 0 {
+            return result.Error
+        }
+        removed = result.RowsAffected
+        return services.SaveTask(tx, task)
+    })
+    if err == nil && removed == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Label not found on task"})
+        return
+    }
+
+    respondTaskLabels(c, task, err)
+}
+
+// respondTaskLabels answers a change to the labels of a task with the
+// labels it now has. The change is a new version of the task, whose ETag is
+// sent along.
+func respondTaskLabels(c *gin.Context, task *models.Task, err error) {
+    if errors.Is(err, services.ErrTaskVersionConflict) {
+        respondTaskConflict(c, task.ID)
+        return
+    }
+    if errors.Is(err, services.ErrLabelNotFound) {
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update labels"})
+        return
+    }
+
+    tasks := []models.Task{*task}
+    if err := services.LoadTaskLabels(db, tasks); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch labels"})
+        return
+    }
+    labels := tasks[0].Labels
+    if labels == nil {
+        labels = []models.LabelRef{}
+    }
+
+    c.Header("ETag", services.TaskETag(task))
+    c.JSON(http.StatusOK, labels)
+}
+
+// applyLabelRequest validates the fields set in req and writes them onto
+// label. Names are trimmed and must not be taken by another label of the
+// same space.
+func applyLabelRequest(c *gin.Context, label *models.Label, req *LabelRequest) bool {
+    if req.Name != nil {
+        name := strings.TrimSpace(*req.Name)
+        if name == "" || len(name) > maxLabelName {
+            c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "name must be between 1 and 64 characters"})
+            return false
+        }
+
+        existing, err := services.FindLabelByName(db, labelSpace(label), name)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check label name"})
+            return false
+        }
+        if existing != nil && existing.ID != label.ID {
+            c.JSON(http.StatusConflict, gin.H{"error": services.ErrLabelExists.Error(), "label_id": existing.ID})
+            return false
+        }
+        label.Name = name
+    }
+
+    if req.Color != nil {
+        if !hexColor.MatchString(*req.Color) {
+            c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "color must be a hex colour like #1e90ff"})
+            return false
+        }
+        label.Color = strings.ToLower(*req.Color)
+    }
+    return true
+}
+
+// labelSpace is the space a label is in.
+func labelSpace(label *models.Label) services.Space {
+    return services.Space{UserID: label.UserID, WorkspaceID: label.WorkspaceID}
+}
+
+// findLabel loads a label of the request's space, answering 403 when the
+// user's role there doesn't allow perm.
+func findLabel(c *gin.Context, param string, perm services.Permission) (*models.Label, bool) {
+    access, ok := authorize(c, perm)
+    if !ok {
+        return nil, false
+    }
+    labelID, err := strconv.Atoi(param)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid label ID"})
+        return nil, false
+    }
+
+    var label models.Label
+    if err := access.Scope(db).Where("id = ?", labelID).First(&label).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Label not found"})
+        } else {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch label"})
+        }
+        return nil, false
+    }
+    return &label, true
+}
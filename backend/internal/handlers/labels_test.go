@@ -0,0 +1,156 @@
+package handlers
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "sort"
+    "strings"
+    "testing"
+    "taskflow/internal/models"
+)
+
+func createTestLabel(t *testing.T, name string) *models.Label {
+    t.Helper()
+
+    label := models.Label{UserID: 1, Name: name, Color: defaultColor}
+    if err := db.Create(&label).Error; err != nil {
+        t.Fatal(err)
+    }
+    return &label
+}
+
+func labelTask(t *testing.T, task *models.Task, labels ...*models.Label) {
+    t.Helper()
+
+    for _, label := range labels {
+        if err := db.Create(&models.TaskLabel{TaskID: task.ID, LabelID: label.ID}).Error; err != nil {
+            t.Fatal(err)
+        }
+    }
+}
+
+func TestMergeLabel(t *testing.T) {
+    newTaskAPITest(t)
+    r := taskTestRouter(1)
+
+    urgent := createTestLabel(t, "urgent")
+    asap := createTestLabel(t, "ASAP")
+    both := createTestTask(t, models.Task{UserID: 1, Title: "Pay rent"})
+    onlyASAP := createTestTask(t, models.Task{UserID: 1, Title: "Call plumber"})
+    labelTask(t, both, urgent, asap)
+    labelTask(t, onlyASAP, asap)
+
+    w := serve(r, http.MethodPost, fmt.Sprintf("/api/labels/%d/merge", asap.ID), fmt.Sprintf(`{"into": %d}`, urgent.ID))
+    if w.Code != http.StatusOK {
+        t.Fatalf("got %d, want 200: %s", w.Code, w.Body)
+    }
+
+    var links []models.TaskLabel
+    if err := db.Order("task_id").Find(&links).Error; err != nil {
+        t.Fatal(err)
+    }
+    got := make([]string, len(links))
+    for i, link := range links {
+        got[i] = fmt.Sprintf("%d:%d", link.TaskID, link.LabelID)
+    }
+    if want := fmt.Sprint([]string{fmt.Sprintf("%d:%d", both.ID, urgent.ID), fmt.Sprintf("%d:%d", onlyASAP.ID, urgent.ID)}); fmt.Sprint(got) != want {
+        t.Errorf("got links %v, want %s", got, want)
+    }
+    if err := db.First(&models.Label{}, asap.ID).Error; err == nil {
+        t.Error("merged label still exists")
+    }
+
+    w = serve(r, http.MethodPost, fmt.Sprintf("/api/labels/%d/merge", urgent.ID), fmt.Sprintf(`{"into": %d}`, urgent.ID))
+    if w.Code != http.StatusUnprocessableEntity {
+        t.Errorf("merge into itself: got %d, want 422", w.Code)
+    }
+}
+
+func TestLabelNamesAreUniqueIgnoringCase(t *testing.T) {
+    newTaskAPITest(t)
+    r := taskTestRouter(1)
+
+    urgent := createTestLabel(t, "Urgent")
+    home := createTestLabel(t, "home")
+
+    for _, tc := range []struct {
+        method, path, body string
+        want               int
+    }{
+        {http.MethodPut, fmt.Sprintf("/api/labels/%d", home.ID), `{"name": "URGENT"}`, http.StatusConflict},
+        {http.MethodPut, fmt.Sprintf("/api/labels/%d", home.ID), `{"name": " urgent "}`, http.StatusConflict},
+        {http.MethodPost, "/api/labels", `{"name": "urgent"}`, http.StatusConflict},
+        {http.MethodPut, fmt.Sprintf("/api/labels/%d", urgent.ID), `{"name": "URGENT"}`, http.StatusOK},
+        {http.MethodPut, fmt.Sprintf("/api/labels/%d", home.ID), `{"name": "Home"}`, http.StatusOK},
+    } {
+        w := serve(r, tc.method, tc.path, tc.body)
+        if w.Code != tc.want {
+            t.Errorf("%s %s %s: got %d, want %d: %s", tc.method, tc.path, tc.body, w.Code, tc.want, w.Body)
+            continue
+        }
+        if tc.want != http.StatusConflict {
+            continue
+        }
+
+        var body struct {
+            LabelID uint `json:"label_id"`
+        }
+        if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+            t.Fatal(err)
+        }
+        if body.LabelID != urgent.ID {
+            t.Errorf("%s %s: got label_id %d, want %d", tc.method, tc.body, body.LabelID, urgent.ID)
+        }
+    }
+}
+
+func TestLabelFilters(t *testing.T) {
+    newTaskAPITest(t)
+    r := taskTestRouter(1)
+
+    work := createTestLabel(t, "work")
+    urgent := createTestLabel(t, "urgent")
+    home := createTestLabel(t, "home")
+    labelTask(t, createTestTask(t, models.Task{UserID: 1, Title: "report"}), work)
+    labelTask(t, createTestTask(t, models.Task{UserID: 1, Title: "deadline"}), work, urgent)
+    labelTask(t, createTestTask(t, models.Task{UserID: 1, Title: "leak"}), home, urgent)
+    createTestTask(t, models.Task{UserID: 1, Title: "unlabelled"})
+
+    for _, tc := range []struct {
+        query string
+        want  string
+    }{
+        {fmt.Sprintf("labels_any=%d", urgent.ID), "deadline leak"},
+        {fmt.Sprintf("labels_any=%d,%d", work.ID, home.ID), "deadline leak report"},
+        {fmt.Sprintf("labels_all=%d,%d", work.ID, urgent.ID), "deadline"},
+        {fmt.Sprintf("labels_all=%d,%d,%d", work.ID, urgent.ID, urgent.ID), "deadline"},
+        {fmt.Sprintf("labels_all=%d,%d", work.ID, home.ID), ""},
+        {fmt.Sprintf("labels_none=%d", urgent.ID), "report unlabelled"},
+        {fmt.Sprintf("labels_none=%d,%d", work.ID, home.ID), "unlabelled"},
+        {fmt.Sprintf("labels_any=%d&labels_none=%d", urgent.ID, home.ID), "deadline"},
+    } {
+        w := serve(r, http.MethodGet, "/api/tasks?"+tc.query, "")
+        if w.Code != http.StatusOK {
+            t.Errorf("%s: got %d, want 200: %s", tc.query, w.Code, w.Body)
+            continue
+        }
+
+        var tasks []models.Task
+        if err := json.Unmarshal(w.Body.Bytes(), &tasks); err != nil {
+            t.Fatal(err)
+        }
+        titles := make([]string, len(tasks))
+        for i, task := range tasks {
+            titles[i] = task.Title
+        }
+        sort.Strings(titles)
+        if got := strings.Join(titles, " "); got != tc.want {
+            t.Errorf("%s: got %q, want %q", tc.query, got, tc.want)
+        }
+    }
+
+    if w := serve(r, http.MethodGet, "/api/tasks?labels_any=urgent", ""); w.Code != http.StatusBadRequest {
+        t.Errorf("labels_any=urgent: got %d, want 400", w.Code)
+    }
+}
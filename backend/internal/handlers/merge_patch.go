@@ -0,0 +1,25 @@
+package handlers
+
+// mergePatch applies a JSON Merge Patch to a decoded JSON document, as
+// described in RFC 7396 section 2. A patch that is not an object replaces
+// the target; null members remove the member from the target.
+func mergePatch(target, patch interface{}) interface{} {
+    patchObject, ok := patch.(map[string]interface{})
+    if !ok {
+        return patch
+    }
+
+    targetObject, ok := target.(map[string]interface{})
+    if !ok {
+        targetObject = map[string]interface{}{}
+    }
+
+    for name, value := range patchObject {
+        if value == nil {
+            delete(targetObject, name)
+            continue
+        }
+        targetObject[name] = mergePatch(targetObject[name], value)
+    }
+    return targetObject
+}
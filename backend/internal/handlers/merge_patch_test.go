@@ -0,0 +1,96 @@
+package handlers
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "testing"
+    "time"
+    "taskflow/internal/models"
+)
+
+func TestMergePatch(t *testing.T) {
+    // The examples of RFC 7396 appendix A, and a few more
+    for _, tc := range []struct {
+        target, patch, want string
+    }{
+        {`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+        {`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+        {`{"a":"b"}`, `{"a":null}`, `{}`},
+        {`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+        {`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+        {`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+        {`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+        {`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+        {`["a","b"]`, `["c","d"]`, `["c","d"]`},
+        {`{"a":"b"}`, `["c"]`, `["c"]`},
+        {`{"a":"foo"}`, `null`, `null`},
+        {`{"a":"foo"}`, `"bar"`, `"bar"`},
+        {`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+        {`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+        {`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+        {`{"a":{"b":{"c":1,"d":2}}}`, `{"a":{"b":{"c":3}}}`, `{"a":{"b":{"c":3,"d":2}}}`},
+        {`{"tags":["a","b"]}`, `{"tags":["c"]}`, `{"tags":["c"]}`},
+    } {
+        var target, patch interface{}
+        if err := json.Unmarshal([]byte(tc.target), &target); err != nil {
+            t.Fatal(err)
+        }
+        if err := json.Unmarshal([]byte(tc.patch), &patch); err != nil {
+            t.Fatal(err)
+        }
+
+        got, err := json.Marshal(mergePatch(target, patch))
+        if err != nil {
+            t.Fatal(err)
+        }
+        if string(got) != tc.want {
+            t.Errorf("%s + %s: got %s, want %s", tc.target, tc.patch, got, tc.want)
+        }
+    }
+}
+
+func TestPutResetsOmittedFieldsPatchKeepsThem(t *testing.T) {
+    newTaskAPITest(t)
+    r := taskTestRouter(1)
+
+    due := time.Date(2026, 11, 2, 9, 0, 0, 0, time.UTC)
+    newTask := func() *models.Task {
+        return createTestTask(t, models.Task{
+            UserID:      1,
+            Title:       "Pay rent",
+            Description: "Transfer before the 5th",
+            Priority:    models.PriorityHigh,
+            DueDate:     &due,
+        })
+    }
+    put, patch, cleared := newTask(), newTask(), newTask()
+
+    for _, tc := range []struct {
+        method string
+        task   *models.Task
+        body   string
+        want   string
+    }{
+        {http.MethodPut, put, `{"title": "Pay the rent"}`, `Pay the rent "" medium <nil>`},
+        {http.MethodPatch, patch, `{"title": "Pay the rent"}`, `Pay the rent "Transfer before the 5th" high 2026-11-02 09:00:00 +0000 UTC`},
+        {http.MethodPatch, cleared, `{"description": null, "due_date": null}`, `Pay rent "" high <nil>`},
+    } {
+        w := serve(r, tc.method, fmt.Sprintf("/api/tasks/%d", tc.task.ID), tc.body)
+        if w.Code != http.StatusOK {
+            t.Fatalf("%s %s: got %d, want 200: %s", tc.method, tc.body, w.Code, w.Body)
+        }
+
+        var task models.Task
+        if err := db.First(&task, tc.task.ID).Error; err != nil {
+            t.Fatal(err)
+        }
+        var dueDate interface{} = task.DueDate
+        if task.DueDate != nil {
+            dueDate = task.DueDate.UTC()
+        }
+        if got := fmt.Sprintf("%s %q %s %v", task.Title, task.Description, task.Priority, dueDate); got != tc.want {
+            t.Errorf("%s %s: got %s, want %s", tc.method, tc.body, got, tc.want)
+        }
+    }
+}
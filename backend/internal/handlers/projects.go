@@ -0,0 +1,256 @@
+package handlers
+
+import (
+    "errors"
+    "net/http"
+    "strconv"
+    "strings"
+    "taskflow/internal/models"
+    "taskflow/internal/services"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+)
+
+const maxProjectName = 255
+
+type ProjectRequest struct {
+    Name        *string `json:"name"`
+    Description *string `json:"description"`
+    Color       *string `json:"color"`
+    Archived    *bool   `json:"archived"`
+}
+
+// projectStats counts the tasks of a project, subtasks included. Percent is
+// the share of them completed.
+type projectStats struct {
+    Total      int64            `json:"total"`
+    ByStatus   map[string]int64 `json:"by_status"`
+    ByPriority map[string]int64 `json:"by_priority"`
+    Overdue    int64            `json:"overdue"`
+    Percent    int              `json:"percent"`
+}
+
+// GetProjects lists the projects of the request's space, archived ones only
+// with archived=true.
+func GetProjects(c *gin.Context) {
+    access, ok := authorize(c, services.PermView)
+    if !ok {
+        return
+    }
+
+    query := access.Scope(db)
+    if archived, _ := strconv.ParseBool(c.Query("archived")); !archived {
+        query = query.Where("archived = ?", false)
+    }
+
+    var projects []models.Project
+    if err := query.Order("name, id").Find(&projects).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch projects"})
+        return
+    }
+
+    c.JSON(http.StatusOK, projects)
+}
+
+func GetProject(c *gin.Context) {
+    project, ok := findProject(c, services.PermView)
+    if !ok {
+        return
+    }
+
+    c.JSON(http.StatusOK, project)
+}
+
+func CreateProject(c *gin.Context) {
+    access, ok := authorize(c, services.PermEdit)
+    if !ok {
+        return
+    }
+
+    var req ProjectRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if req.Name == nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+        return
+    }
+
+    project := models.Project{UserID: access.UserID, WorkspaceID: access.WorkspaceID, Color: defaultColor}
+    if !applyProjectRequest(c, &project, &req) {
+        return
+    }
+
+    if err := db.Create(&project).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create project"})
+        return
+    }
+
+    c.JSON(http.StatusCreated, project)
+}
+
+// UpdateProject changes the fields set in the body. Archiving a project
+// hides its tasks from task listings; they come back when it is unarchived.
+func UpdateProject(c *gin.Context) {
+    project, ok := findProject(c, services.PermEdit)
+    if !ok {
+        return
+    }
+
+    var req ProjectRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if !applyProjectRequest(c, project, &req) {
+        return
+    }
+
+    if err := db.Save(project).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
+        return
+    }
+
+    c.JSON(http.StatusOK, project)
+}
+
+// DeleteProject deletes a project, its tasks are kept without a project.
+func DeleteProject(c *gin.Context) {
+    project, ok := findProject(c, services.PermEdit)
+    if !ok {
+        return
+    }
+
+    err := db.Transaction(func(tx *gorm.DB) error {
+        return services.DeleteProject(tx, project)
+    })
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Project deleted successfully"})
+}
+
+// GetProjectTasks lists the tasks of a project, archived or not, with the
+// filters, order and paging of GetTasks.
+func GetProjectTasks(c *gin.Context) {
+    project, ok := findProject(c, services.PermView)
+    if !ok {
+        return
+    }
+
+    listTasks(c, project)
+}
+
+// GetProjectStats counts the tasks of a project by status and priority.
+// Overdue tasks are the unfinished ones due before today in the time zone
+// of the user asking.
+func GetProjectStats(c *gin.Context) {
+    project, ok := findProject(c, services.PermView)
+    if !ok {
+        return
+    }
+
+    var user models.User
+    if err := db.First(&user, c.GetUint("user_id")).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch project stats"})
+        return
+    }
+
+    stats := projectStats{
+        ByStatus:   make(map[string]int64),
+        ByPriority: make(map[string]int64),
+    }
+    for _, status := range models.TaskStatuses {
+        stats.ByStatus[status] = 0
+    }
+    for _, priority := range models.TaskPriorities {
+        stats.ByPriority[priority] = 0
+    }
+
+    var rows []struct {
+        Status   string
+        Priority string
+        Count    int64
+    }
+    err := db.Model(&models.Task{}).
+        Select("status, priority, COUNT(*) AS count").
+        Where("project_id = ?", project.ID).
+        Group("status, priority").
+        Scan(&rows).Error
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch project stats"})
+        return
+    }
+    for _, row := range rows {
+        stats.Total += row.Count
+        stats.ByStatus[row.Status] += row.Count
+        stats.ByPriority[row.Priority] += row.Count
+    }
+    if stats.Total > 0 {
+        stats.Percent = int(stats.ByStatus[models.StatusCompleted] * 100 / stats.Total)
+    }
+
+    overdue := &taskQuery{Project: strconv.FormatUint(uint64(project.ID), 10), Due: "overdue"}
+    if err := overdue.Filter(db.Model(&models.Task{}), &user).Count(&stats.Overdue).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch project stats"})
+        return
+    }
+
+    c.JSON(http.StatusOK, stats)
+}
+
+// applyProjectRequest validates the fields set in req and writes them onto
+// project.
+func applyProjectRequest(c *gin.Context, project *models.Project, req *ProjectRequest) bool {
+    if req.Name != nil {
+        name := strings.TrimSpace(*req.Name)
+        if name == "" || len(name) > maxProjectName {
+            c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "name must be between 1 and 255 characters"})
+            return false
+        }
+        project.Name = name
+    }
+    if req.Description != nil {
+        project.Description = *req.Description
+    }
+    if req.Color != nil {
+        if !hexColor.MatchString(*req.Color) {
+            c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "color must be a hex colour like #1e90ff"})
+            return false
+        }
+        project.Color = strings.ToLower(*req.Color)
+    }
+    if req.Archived != nil {
+        project.Archived = *req.Archived
+    }
+    return true
+}
+
+// findProject loads the project in the path from the request's space,
+// answering 403 when the user's role there doesn't allow perm.
+func findProject(c *gin.Context, perm services.Permission) (*models.Project, bool) {
+    access, ok := authorize(c, perm)
+    if !ok {
+        return nil, false
+    }
+    projectID, err := strconv.Atoi(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return nil, false
+    }
+
+    var project models.Project
+    if err := access.Scope(db).Where("id = ?", projectID).First(&project).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        } else {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch project"})
+        }
+        return nil, false
+    }
+    return &project, true
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+    "errors"
+    "net/http"
+    "taskflow/internal/models"
+    "taskflow/internal/services"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+)
+
+// SkipOccurrence drops an occurrence of a recurring task without doing it:
+// the next occurrence is created and the task deleted. It answers the next
+// occurrence.
+func SkipOccurrence(c *gin.Context) {
+    task, ok := findTask(c, services.PermEdit)
+    if !ok || !taskIfMatch(c, task) {
+        return
+    }
+
+    var next *models.Task
+    err := db.Transaction(func(tx *gorm.DB) error {
+        var err error
+        next, err = services.SkipOccurrence(tx, task)
+        return err
+    })
+    switch {
+    case errors.Is(err, services.ErrTaskVersionConflict):
+        respondTaskConflict(c, task.ID)
+        return
+    case errors.Is(err, services.ErrNotRecurring), errors.Is(err, services.ErrOccurrenceCompleted), errors.Is(err, services.ErrSeriesEnded):
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+        return
+    case err != nil:
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to skip occurrence"})
+        return
+    }
+
+    c.Header("ETag", services.TaskETag(next))
+    c.JSON(http.StatusOK, next)
+}
+
+// EndSeries stops a recurring task from repeating. The task itself is
+// kept, it just won't have a next occurrence.
+func EndSeries(c *gin.Context) {
+    task, ok := findTask(c, services.PermEdit)
+    if !ok || !taskIfMatch(c, task) {
+        return
+    }
+    if task.Recurrence == "" {
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": services.ErrNotRecurring.Error()})
+        return
+    }
+
+    task.Recurrence = ""
+    saveTask(c, task)
+}
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+    "errors"
+    "net/http"
+    "strconv"
+    "strings"
+    "taskflow/internal/models"
+    "taskflow/internal/services"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+)
+
+type ChecklistItemRequest struct {
+    Title *string `json:"title"`
+    Done  *bool   `json:"done"`
+}
+
+type ChecklistOrderRequest struct {
+    ItemIDs []uint `json:"item_ids" binding:"required"`
+}
+
+// GetSubtasks lists the direct subtasks of a task with their progress.
+func GetSubtasks(c *gin.Context) {
+    task, ok := findTask(c, services.PermView)
+    if !ok {
+        return
+    }
+
+    var subtasks []models.Task
+    if err := db.Where("parent_id = ?", task.ID).Order("created_at, id").Find(&subtasks).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch subtasks"})
+        return
+    }
+    if err := services.LoadTaskRelations(db, subtasks); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch subtasks"})
+        return
+    }
+
+    c.JSON(http.StatusOK, subtasks)
+}
+
+// CreateSubtask creates a task under the one in the path, as POST /tasks
+// does with a parent_id.
+func CreateSubtask(c *gin.Context) {
+    parent, ok := findTask(c, services.PermEdit)
+    if !ok {
+        return
+    }
+
+    var req CreateTaskRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    req.ParentID = &parent.ID
+
+    createTask(c, &req)
+}
+
+func GetChecklist(c *gin.Context) {
+    task, ok := findTask(c, services.PermView)
+    if !ok {
+        return
+    }
+
+    var items []models.ChecklistItem
+    if err := db.Where("task_id = ?", task.ID).Order("position, id").Find(&items).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch checklist"})
+        return
+    }
+
+    c.JSON(http.StatusOK, items)
+}
+
+// CreateChecklistItem appends an item to the task's checklist.
+func CreateChecklistItem(c *gin.Context) {
+    task, ok := findTask(c, services.PermEdit)
+    if !ok {
+        return
+    }
+
+    var req ChecklistItemRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if req.Title == nil || strings.TrimSpace(*req.Title) == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "title is required"})
+        return
+    }
+
+    item := models.ChecklistItem{
+        TaskID: task.ID,
+        Title:  strings.TrimSpace(*req.Title),
+    }
+    if req.Done != nil {
+        item.Done = *req.Done
+    }
+
+    err := db.Transaction(func(tx *gorm.DB) error {
+        var last struct{ Position *int }
+        err := tx.Model(&models.ChecklistItem{}).Select("MAX(position) AS position").Where("task_id = ?", task.ID).Scan(&last).Error
+        if err != nil {
+            return err
+        }
+        if last.Position != nil {
+            item.Position = *last.Position + 1
+        }
+        return tx.Create(&item).Error
+    })
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create checklist item"})
+        return
+    }
+
+    c.JSON(http.StatusCreated, item)
+}
+
+// UpdateChecklistItem renames an item or checks it off.
+func UpdateChecklistItem(c *gin.Context) {
+    item, ok := findChecklistItem(c)
+    if !ok {
+        return
+    }
+
+    var req ChecklistItemRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if req.Title != nil {
+        if strings.TrimSpace(*req.Title) == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "title can't be empty"})
+            return
+        }
+        item.Title = strings.TrimSpace(*req.Title)
+    }
+    if req.Done != nil {
+        item.Done = *req.Done
+    }
+
+    if err := db.Save(item).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update checklist item"})
+        return
+    }
+
+    c.JSON(http.StatusOK, item)
+}
+
+func DeleteChecklistItem(c *gin.Context) {
+    item, ok := findChecklistItem(c)
+    if !ok {
+        return
+    }
+
+    if err := db.Delete(item).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete checklist item"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Checklist item deleted successfully"})
+}
+
+// ReorderChecklist sets the order of a task's checklist. item_ids must list
+// every item of the checklist exactly once.
+func ReorderChecklist(c *gin.Context) {
+    task, ok := findTask(c, services.PermEdit)
+    if !ok {
+        return
+    }
+
+    var req ChecklistOrderRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    var items []models.ChecklistItem
+    err := db.Transaction(func(tx *gorm.DB) error {
+        var ids []uint
+        if err := tx.Model(&models.ChecklistItem{}).Where("task_id = ?", task.ID).Pluck("id", &ids).Error; err != nil {
+            return err
+        }
+        if !sameIDs(ids, req.ItemIDs) {
+            return errChecklistOrder
+        }
+
+        for position, id := range req.ItemIDs {
+            err := tx.Model(&models.ChecklistItem{}).Where("id = ?", id).Update("position", position).Error
+            if err != nil {
+                return err
+            }
+        }
+        return tx.Where("task_id = ?", task.ID).Order("position, id").Find(&items).Error
+    })
+    if errors.Is(err, errChecklistOrder) {
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder checklist"})
+        return
+    }
+
+    c.JSON(http.StatusOK, items)
+}
+
+var errChecklistOrder = errors.New("item_ids must list every checklist item once")
+
+func findChecklistItem(c *gin.Context) (*models.ChecklistItem, bool) {
+    task, ok := findTask(c, services.PermEdit)
+    if !ok {
+        return nil, false
+    }
+    itemID, err := strconv.Atoi(c.Param("item_id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid checklist item ID"})
+        return nil, false
+    }
+
+    var item models.ChecklistItem
+    if err := db.Where("id = ? AND task_id = ?", itemID, task.ID).First(&item).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Checklist item not found"})
+        } else {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch checklist item"})
+        }
+        return nil, false
+    }
+    return &item, true
+}
+
+// sameIDs reports whether ids lists each of want exactly once.
+func sameIDs(want, ids []uint) bool {
+    if len(want) != len(ids) {
+        return false
+    }
+
+    seen := make(map[uint]bool, len(want))
+    for _, id := range want {
+        seen[id] = true
+    }
+    for _, id := range ids {
+        if !seen[id] {
+            return false
+        }
+        delete(seen, id)
+    }
+    return true
+}
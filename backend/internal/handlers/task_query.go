@@ -0,0 +1,487 @@
+package handlers
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+    "taskflow/internal/models"
+    "taskflow/internal/services"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+)
+
+const (
+    maxTaskPageSize = 500
+    defaultTaskSort = "position"
+)
+
+var (
+    dueWindows    = []string{"today", "tomorrow", "week", "overdue", "future", "none"}
+    taskSortNames = []string{"position", "created_at", "updated_at", "due_date", "priority", "title"}
+)
+
+// taskSortField describes a column tasks can be sorted by. expr is the SQL
+// expression ordered on, value renders a task's key for the cursor and parse
+// reads it back. Nullable keys sort last in both directions.
+type taskSortField struct {
+    expr     string
+    nullable bool
+    value    func(task *models.Task) *string
+    parse    func(value string) (interface{}, error)
+}
+
+var taskSortFields = map[string]taskSortField{
+    // Board order: by status column, then by position within the column
+    "position": {
+        expr: "CASE status WHEN '" + models.StatusPending + "' THEN '1' WHEN '" + models.StatusInProgress + "' THEN '2' ELSE '3' END || position",
+        value: func(task *models.Task) *string {
+            key := strconv.Itoa(statusRank(task.Status)) + task.Position
+            return &key
+        },
+        parse: func(value string) (interface{}, error) { return value, nil },
+    },
+    "created_at": {
+        expr:  "created_at",
+        value: func(task *models.Task) *string { return timeKey(task.CreatedAt) },
+        parse: parseTimeKey,
+    },
+    "updated_at": {
+        expr:  "updated_at",
+        value: func(task *models.Task) *string { return timeKey(task.UpdatedAt) },
+        parse: parseTimeKey,
+    },
+    "due_date": {
+        expr:     "due_date",
+        nullable: true,
+        value: func(task *models.Task) *string {
+            if task.DueDate == nil {
+                return nil
+            }
+            return timeKey(*task.DueDate)
+        },
+        parse: parseTimeKey,
+    },
+    "priority": {
+        expr: "CASE priority WHEN '" + models.PriorityHigh + "' THEN 3 WHEN '" + models.PriorityMedium + "' THEN 2 ELSE 1 END",
+        value: func(task *models.Task) *string {
+            rank := strconv.Itoa(priorityRank(task.Priority))
+            return &rank
+        },
+        parse: func(value string) (interface{}, error) { return strconv.Atoi(value) },
+    },
+    "title": {
+        expr:  "title",
+        value: func(task *models.Task) *string { return &task.Title },
+        parse: func(value string) (interface{}, error) { return value, nil },
+    },
+}
+
+// taskQuery holds the filters, sort order and page of a task listing.
+type taskQuery struct {
+    Statuses   []string
+    Priorities []string
+    Parent     string
+    Project    string
+    Archived   bool
+    Assignee   string
+    Due        string
+    DueFrom    *time.Time
+    DueTo      *time.Time
+    Search     string
+    LabelsAny  []uint
+    LabelsAll  []uint
+    LabelsNone []uint
+    Sort       string
+    Desc       bool
+    Limit      int
+    Cursor     *taskCursor
+}
+
+// taskCursor points just past the last task of a page. It carries the sort
+// it was issued for so it can't be replayed against a different order.
+type taskCursor struct {
+    Sort  string  `json:"s"`
+    Value *string `json:"v"`
+    ID    uint    `json:"id"`
+}
+
+// parseTaskQuery reads the listing parameters of GET /api/tasks:
+//
+//	status, priority   comma separated values
+//	due                today, tomorrow, week, overdue, future or none
+//	due_from, due_to   due date range, a date-only due_to is inclusive
+//	parent_id          subtasks of a task, or none for top-level tasks
+//	project_id         tasks of a project, or none for tasks outside projects
+//	archived           true to include the tasks of archived projects
+//	assignee           a user ID, me for the user's tasks or none for
+//	                   unassigned ones
+//	q                  text in title or description
+//	labels_any         label IDs, tasks with at least one of them
+//	labels_all         label IDs, tasks with every one of them
+//	labels_none        label IDs, tasks with none of them
+//	sort               a sort field, prefixed with - for descending
+//	limit, cursor      page size and the X-Next-Cursor of the previous page
+func parseTaskQuery(c *gin.Context) (*taskQuery, error) {
+    q := &taskQuery{
+        Sort:     strings.TrimPrefix(c.DefaultQuery("sort", defaultTaskSort), "-"),
+        Desc:     strings.HasPrefix(c.Query("sort"), "-"),
+        Due:      c.Query("due"),
+        Parent:   c.Query("parent_id"),
+        Project:  c.Query("project_id"),
+        Assignee: c.Query("assignee"),
+        Search:   strings.TrimSpace(c.Query("q")),
+    }
+
+    if _, ok := taskSortFields[q.Sort]; !ok {
+        return nil, fmt.Errorf("sort must be one of %s", strings.Join(taskSortNames, ", "))
+    }
+
+    var err error
+    if q.Statuses, err = listParam(c, "status", models.TaskStatuses); err != nil {
+        return nil, err
+    }
+    if q.Priorities, err = listParam(c, "priority", models.TaskPriorities); err != nil {
+        return nil, err
+    }
+
+    if q.Parent != "" && q.Parent != "none" {
+        if _, err := strconv.ParseUint(q.Parent, 10, 64); err != nil {
+            return nil, errors.New("parent_id must be a task ID or none")
+        }
+    }
+    if q.Project != "" && q.Project != "none" {
+        if _, err := strconv.ParseUint(q.Project, 10, 64); err != nil {
+            return nil, errors.New("project_id must be a project ID or none")
+        }
+    }
+    if q.Assignee != "" && q.Assignee != "me" && q.Assignee != "none" {
+        if _, err := strconv.ParseUint(q.Assignee, 10, 64); err != nil {
+            return nil, errors.New("assignee must be a user ID, me or none")
+        }
+    }
+    if value := c.Query("archived"); value != "" {
+        if q.Archived, err = strconv.ParseBool(value); err != nil {
+            return nil, errors.New("archived must be true or false")
+        }
+    }
+    if q.Due != "" && !contains(dueWindows, q.Due) {
+        return nil, fmt.Errorf("due must be one of %s", strings.Join(dueWindows, ", "))
+    }
+    if value := c.Query("due_from"); value != "" {
+        if q.DueFrom, err = parseTime(value); err != nil {
+            return nil, errors.New("invalid due_from")
+        }
+    }
+    if value := c.Query("due_to"); value != "" {
+        if q.DueTo, err = parseTime(value); err != nil {
+            return nil, errors.New("invalid due_to")
+        }
+        if isDateOnly(value) {
+            end := q.DueTo.AddDate(0, 0, 1)
+            q.DueTo = &end
+        }
+    }
+
+    if q.LabelsAny, err = idListParam(c, "labels_any"); err != nil {
+        return nil, err
+    }
+    if q.LabelsAll, err = idListParam(c, "labels_all"); err != nil {
+        return nil, err
+    }
+    if q.LabelsNone, err = idListParam(c, "labels_none"); err != nil {
+        return nil, err
+    }
+
+    if value := c.Query("limit"); value != "" {
+        q.Limit, err = strconv.Atoi(value)
+        if err != nil || q.Limit < 1 || q.Limit > maxTaskPageSize {
+            return nil, fmt.Errorf("limit must be between 1 and %d", maxTaskPageSize)
+        }
+    }
+
+    if value := c.Query("cursor"); value != "" {
+        if q.Cursor, err = decodeTaskCursor(value); err != nil || q.Cursor.Sort != c.DefaultQuery("sort", defaultTaskSort) {
+            return nil, errors.New("invalid cursor")
+        }
+    }
+
+    return q, nil
+}
+
+// Filter adds the filters to a query of the user's tasks. Due windows are
+// days in the user's time zone; all-day due dates are stored at midnight UTC
+// and are matched by their date alone.
+func (q *taskQuery) Filter(query *gorm.DB, user *models.User) *gorm.DB {
+    if len(q.Statuses) > 0 {
+        query = query.Where("status IN ?", q.Statuses)
+    }
+    if len(q.Priorities) > 0 {
+        query = query.Where("priority IN ?", q.Priorities)
+    }
+    switch q.Parent {
+    case "":
+    case "none":
+        query = query.Where("parent_id IS NULL")
+    default:
+        query = query.Where("parent_id = ?", q.Parent)
+    }
+    switch q.Project {
+    case "":
+        // Asking for a project shows its tasks even when it is archived
+        if !q.Archived {
+            archived := db.Model(&models.Project{}).Select("id").Where("archived = ?", true)
+            query = query.Where("(tasks.project_id IS NULL OR tasks.project_id NOT IN (?))", archived)
+        }
+    case "none":
+        query = query.Where("project_id IS NULL")
+    default:
+        query = query.Where("project_id = ?", q.Project)
+    }
+
+    switch q.Assignee {
+    case "":
+    case "me":
+        query = query.Where("assignee_id = ?", user.ID)
+    case "none":
+        query = query.Where("assignee_id IS NULL")
+    default:
+        query = query.Where("assignee_id = ?", q.Assignee)
+    }
+
+    if q.Due != "" {
+        loc := services.UserLocation(user)
+        now := time.Now().In(loc)
+        today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+        switch q.Due {
+        case "today":
+            query = dueBetween(query, today, today.AddDate(0, 0, 1))
+        case "tomorrow":
+            query = dueBetween(query, today.AddDate(0, 0, 1), today.AddDate(0, 0, 2))
+        case "week":
+            // Through the coming Sunday, like the board's filter
+            query = dueBetween(query, today, today.AddDate(0, 0, 8-int(today.Weekday())))
+        case "overdue":
+            query = query.Where("status <> ?", models.StatusCompleted)
+            query = dueBetween(query, time.Time{}, today)
+        case "future":
+            query = dueBetween(query, today.AddDate(0, 0, 1), time.Time{})
+        case "none":
+            query = query.Where("due_date IS NULL")
+        }
+    }
+    if q.DueFrom != nil {
+        query = query.Where("due_date >= ?", *q.DueFrom)
+    }
+    if q.DueTo != nil {
+        query = query.Where("due_date < ?", *q.DueTo)
+    }
+
+    if len(q.LabelsAny) > 0 {
+        query = query.Where("tasks.id IN (?)", db.Model(&models.TaskLabel{}).Select("task_id").Where("label_id IN ?", q.LabelsAny))
+    }
+    if len(q.LabelsAll) > 0 {
+        labelled := db.Model(&models.TaskLabel{}).Select("task_id").Where("label_id IN ?", q.LabelsAll).
+            Group("task_id").Having("COUNT(DISTINCT label_id) = ?", len(q.LabelsAll))
+        query = query.Where("tasks.id IN (?)", labelled)
+    }
+    if len(q.LabelsNone) > 0 {
+        query = query.Where("tasks.id NOT IN (?)", db.Model(&models.TaskLabel{}).Select("task_id").Where("label_id IN ?", q.LabelsNone))
+    }
+
+    if q.Search != "" {
+        pattern := "%" + escapeLike(strings.ToLower(q.Search)) + "%"
+        query = query.Where(`(LOWER(title) LIKE ? ESCAPE '\' OR LOWER(description) LIKE ? ESCAPE '\')`, pattern, pattern)
+    }
+    return query
+}
+
+// Apply adds the filters, order and page to a query of the user's tasks.
+func (q *taskQuery) Apply(query *gorm.DB, user *models.User) (*gorm.DB, error) {
+    query = q.Filter(query, user)
+
+    field := taskSortFields[q.Sort]
+    if q.Cursor != nil {
+        after, args, err := q.after(field)
+        if err != nil {
+            return nil, err
+        }
+        query = query.Where(after, args...)
+    }
+
+    direction := "ASC"
+    if q.Desc {
+        direction = "DESC"
+    }
+    if field.nullable {
+        query = query.Order(field.expr + " IS NULL")
+    }
+    query = query.Order(field.expr + " " + direction).Order("id " + direction)
+
+    if q.Limit > 0 {
+        // One extra row tells whether there is a next page
+        query = query.Limit(q.Limit + 1)
+    }
+    return query, nil
+}
+
+// after is the keyset condition selecting the tasks past the cursor.
+func (q *taskQuery) after(field taskSortField) (string, []interface{}, error) {
+    op := ">"
+    if q.Desc {
+        op = "<"
+    }
+
+    if q.Cursor.Value == nil {
+        if !field.nullable {
+            return "", nil, errors.New("invalid cursor")
+        }
+        return fmt.Sprintf("%s IS NULL AND id %s ?", field.expr, op), []interface{}{q.Cursor.ID}, nil
+    }
+
+    value, err := field.parse(*q.Cursor.Value)
+    if err != nil {
+        return "", nil, errors.New("invalid cursor")
+    }
+
+    condition := fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", field.expr, op)
+    if field.nullable {
+        condition = fmt.Sprintf("(%s OR %s IS NULL)", condition, field.expr)
+    }
+    return condition, []interface{}{value, value, q.Cursor.ID}, nil
+}
+
+// Page trims the extra row fetched by Apply and returns the cursor of the
+// next page, empty on the last one.
+func (q *taskQuery) Page(tasks []models.Task) ([]models.Task, string) {
+    if q.Limit == 0 || len(tasks) <= q.Limit {
+        return tasks, ""
+    }
+
+    tasks = tasks[:q.Limit]
+    last := &tasks[len(tasks)-1]
+    sort := q.Sort
+    if q.Desc {
+        sort = "-" + sort
+    }
+    return tasks, encodeTaskCursor(&taskCursor{
+        Sort:  sort,
+        Value: taskSortFields[q.Sort].value(last),
+        ID:    last.ID,
+    })
+}
+
+// dueBetween matches due dates in [from, to), either bound may be zero.
+func dueBetween(query *gorm.DB, from, to time.Time) *gorm.DB {
+    timed := db.Where("due_date_all_day = ?", false)
+    allDay := db.Where("due_date_all_day = ?", true)
+    if !from.IsZero() {
+        timed = timed.Where("due_date >= ?", from)
+        allDay = allDay.Where("due_date >= ?", dateUTC(from))
+    }
+    if !to.IsZero() {
+        timed = timed.Where("due_date < ?", to)
+        allDay = allDay.Where("due_date < ?", dateUTC(to))
+    }
+    return query.Where(db.Where(timed).Or(allDay))
+}
+
+func dateUTC(t time.Time) time.Time {
+    return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// idListParam reads a comma separated list of IDs, each given once.
+func idListParam(c *gin.Context, name string) ([]uint, error) {
+    value := c.Query(name)
+    if value == "" {
+        return nil, nil
+    }
+
+    seen := make(map[uint]bool)
+    var ids []uint
+    for _, v := range strings.Split(value, ",") {
+        id, err := strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+        if err != nil || id == 0 {
+            return nil, fmt.Errorf("%s must be a comma separated list of IDs", name)
+        }
+        if !seen[uint(id)] {
+            seen[uint(id)] = true
+            ids = append(ids, uint(id))
+        }
+    }
+    return ids, nil
+}
+
+func listParam(c *gin.Context, name string, allowed []string) ([]string, error) {
+    value := c.Query(name)
+    if value == "" {
+        return nil, nil
+    }
+
+    values := strings.Split(value, ",")
+    for i, v := range values {
+        values[i] = strings.TrimSpace(v)
+        if !contains(allowed, values[i]) {
+            return nil, fmt.Errorf("invalid %s %q", name, values[i])
+        }
+    }
+    return values, nil
+}
+
+func statusRank(status string) int {
+    switch status {
+    case models.StatusPending:
+        return 1
+    case models.StatusInProgress:
+        return 2
+    default:
+        return 3
+    }
+}
+
+func priorityRank(priority string) int {
+    switch priority {
+    case models.PriorityHigh:
+        return 3
+    case models.PriorityMedium:
+        return 2
+    default:
+        return 1
+    }
+}
+
+func timeKey(t time.Time) *string {
+    key := t.UTC().Format(time.RFC3339Nano)
+    return &key
+}
+
+func parseTimeKey(value string) (interface{}, error) {
+    return time.Parse(time.RFC3339Nano, value)
+}
+
+func escapeLike(value string) string {
+    return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+func encodeTaskCursor(cursor *taskCursor) string {
+    data, _ := json.Marshal(cursor)
+    return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeTaskCursor(value string) (*taskCursor, error) {
+    data, err := base64.RawURLEncoding.DecodeString(value)
+    if err != nil {
+        return nil, err
+    }
+
+    var cursor taskCursor
+    if err := json.Unmarshal(data, &cursor); err != nil {
+        return nil, err
+    }
+    return &cursor, nil
+}
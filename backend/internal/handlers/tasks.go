@@ -1,183 +1,621 @@
 package handlers
 
 import (
+    "encoding/json"
+    "errors"
     "fmt"
     "net/http"
     "strconv"
+    "strings"
     "time"
     "taskflow/internal/models"
+    "taskflow/internal/services"
 
     "github.com/gin-gonic/gin"
+    "github.com/gin-gonic/gin/binding"
     "gorm.io/gorm"
 )
 
+const maxSearchResults = 100
+
+// CreateTaskRequest is the body of POST and PUT. Omitted fields take their
+// defaults, so a PUT replaces the whole task.
 type CreateTaskRequest struct {
     Title       string  `json:"title" binding:"required"`
     Description string  `json:"description"`
     Status      string  `json:"status"`
     Priority    string  `json:"priority"`
     DueDate     *string `json:"due_date"`
+    
+    ParentID             *uint `json:"parent_id"`
+    CompleteWithSubtasks bool  `json:"complete_with_subtasks"`
+    ProjectID            *uint `json:"project_id"`
+    
+    Recurrence string `json:"recurrence"`
+    RecurFrom  string `json:"recur_from"`
 }
 
-type UpdateTaskRequest struct {
-    Title       string  `json:"title"`
-    Description string  `json:"description"`
-    Status      string  `json:"status"`
-    Priority    string  `json:"priority"`
-    DueDate     *string `json:"due_date"`
+func GetTasks(c *gin.Context) {
+    listTasks(c, nil)
 }
 
-func GetTasks(c *gin.Context) {
+// listTasks answers a page of the tasks of the request's space, only those
+// of project when it is set.
+func listTasks(c *gin.Context, project *models.Project) {
     userID := c.GetUint("user_id")
+    access, ok := authorize(c, services.PermView)
+    if !ok {
+        return
+    }
+    
+    q, err := parseTaskQuery(c)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if project != nil {
+        q.Project = strconv.FormatUint(uint64(project.ID), 10)
+    }
+    
+    var user models.User
+    if err := db.First(&user, userID).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tasks"})
+        return
+    }
+    
+    query, err := q.Apply(access.Scope(db), &user)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
     
     var tasks []models.Task
-    if err := db.Where("user_id = ?", userID).Find(&tasks).Error; err != nil {
+    if err := query.Find(&tasks).Error; err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tasks"})
         return
     }
     
+    tasks, next := q.Page(tasks)
+    if err := services.LoadTaskRelations(db, tasks); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tasks"})
+        return
+    }
+    if next != "" {
+        params := c.Request.URL.Query()
+        params.Set("cursor", next)
+        c.Header("X-Next-Cursor", next)
+        c.Header("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, c.Request.URL.Path, params.Encode()))
+    }
+    
     c.JSON(http.StatusOK, tasks)
 }
 
-func GetTask(c *gin.Context) {
+// SearchTasks runs a full text search over the tasks of the request's
+// space for the q parameter, best matches first. lang picks the language
+// the words are stemmed in, and the filters of GetTasks narrow the results.
+func SearchTasks(c *gin.Context) {
     userID := c.GetUint("user_id")
-    taskID, err := strconv.Atoi(c.Param("id"))
+    access, ok := authorize(c, services.PermView)
+    if !ok {
+        return
+    }
+    
+    text := strings.TrimSpace(c.Query("q"))
+    if text == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+        return
+    }
+    
+    language, err := services.SearchLanguage(c.Query("lang"))
     if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
     
-    var task models.Task
-    if err := db.Where("id = ? AND user_id = ?", taskID, userID).First(&task).Error; err != nil {
-        if err == gorm.ErrRecordNotFound {
-            c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
-        } else {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch task"})
-        }
+    limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+    if err != nil || limit < 1 || limit > maxSearchResults {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxSearchResults)})
+        return
+    }
+    offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+    if err != nil || offset < 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
         return
     }
     
-    c.JSON(http.StatusOK, task)
+    q, err := parseTaskQuery(c)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    // q is the search text here, not a substring filter
+    q.Search = ""
+    
+    var user models.User
+    if err := db.First(&user, userID).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search tasks"})
+        return
+    }
+    
+    results, err := services.NewTaskSearch(db).Search(q.Filter(access.Scope(db), &user), services.TaskSearchOptions{
+        Text:     text,
+        Language: language,
+        Limit:    limit,
+        Offset:   offset,
+    })
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search tasks"})
+        return
+    }
+    
+    c.JSON(http.StatusOK, results)
 }
 
-func CreateTask(c *gin.Context) {
-    userID := c.GetUint("user_id")
+func GetTask(c *gin.Context) {
+    task, ok := findTask(c, services.PermView)
+    if !ok {
+        return
+    }
     
+    // The ETag covers the task's own fields, used by If-Match. Its
+    // progress changes with other tasks, so it isn't used for caching.
+    tasks := []models.Task{*task}
+    if err := services.LoadTaskRelations(db, tasks); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch task"})
+        return
+    }
+    
+    c.Header("ETag", services.TaskETag(task))
+    c.JSON(http.StatusOK, tasks[0])
+}
+
+func CreateTask(c *gin.Context) {
     var req CreateTaskRequest
     if err := c.ShouldBindJSON(&req); err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
     
-    if req.Status == "" {
-        req.Status = "pending"
-    }
-    if req.Priority == "" {
-        req.Priority = "medium"
+    createTask(c, &req)
+}
+
+func createTask(c *gin.Context, req *CreateTaskRequest) {
+    access, ok := authorize(c, services.PermEdit)
+    if !ok {
+        return
     }
     
-    task := models.Task{
-        Title:       req.Title,
-        Description: req.Description,
-        Status:      req.Status,
-        Priority:    req.Priority,
-        UserID:      userID,
+    task := models.Task{UserID: access.UserID, WorkspaceID: access.WorkspaceID}
+    if !applyTaskRequest(c, &task, req) {
+        return
     }
     
-    if req.DueDate != nil {
-        dueDate, err := parseTime(*req.DueDate)
-        if err != nil {
-            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid due date format"})
-            return
+    err := db.Transaction(func(tx *gorm.DB) error {
+        if err := services.SaveTask(tx, &task); err != nil {
+            return err
         }
-        task.DueDate = dueDate
-    }
-    
-    if err := db.Create(&task).Error; err != nil {
+        if err := services.EnqueueTaskSync(tx, &task); err != nil {
+            return err
+        }
+        if err := services.AutoCompleteParent(tx, &task); err != nil {
+            return err
+        }
+        _, err := services.NextOccurrence(tx, &task)
+        return err
+    })
+    if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create task"})
         return
     }
     
+    c.Header("ETag", services.TaskETag(&task))
     c.JSON(http.StatusCreated, task)
 }
 
+// UpdateTask replaces a task: fields left out of the body are reset to
+// their defaults. PatchTask changes only some of them. Both honour If-Match
+// like DeleteTask.
 func UpdateTask(c *gin.Context) {
-    userID := c.GetUint("user_id")
-    taskID, err := strconv.Atoi(c.Param("id"))
-    if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+    task, ok := findTask(c, services.PermEdit)
+    if !ok || !taskIfMatch(c, task) {
         return
     }
     
-    var req UpdateTaskRequest
+    var req CreateTaskRequest
     if err := c.ShouldBindJSON(&req); err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
     
+    if !applyTaskRequest(c, task, &req) {
+        return
+    }
+    saveTask(c, task)
+}
+
+// PatchTask applies a JSON Merge Patch (RFC 7396) to a task: members set to
+// null are cleared, absent ones are kept. The patched task is validated
+// like a PUT of the same fields.
+func PatchTask(c *gin.Context) {
+    contentType := c.ContentType()
+    if contentType != "application/merge-patch+json" && contentType != "application/json" {
+        c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be application/merge-patch+json"})
+        return
+    }
+    
+    task, ok := findTask(c, services.PermEdit)
+    if !ok || !taskIfMatch(c, task) {
+        return
+    }
+    
+    var patch interface{}
+    if err := json.NewDecoder(c.Request.Body).Decode(&patch); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merge patch"})
+        return
+    }
+    
+    req, err := patchTaskRequest(taskRequest(task), patch)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    
+    if !applyTaskRequest(c, task, req) {
+        return
+    }
+    saveTask(c, task)
+}
+
+// DeleteTask deletes a task and its subtasks. With an If-Match header, the task is only
+// deleted if it is still at that version; otherwise 412 is answered with the
+// current task.
+func DeleteTask(c *gin.Context) {
+    task, ok := findTask(c, services.PermEdit)
+    if !ok || !taskIfMatch(c, task) {
+        return
+    }
+    
+    err := db.Transaction(func(tx *gorm.DB) error {
+        result := tx.Where("version = ?", task.Version).Delete(task)
+        if result.Error != nil {
+            return result.Error
+        }
+        if result.RowsAffected == 0 {
+            return services.ErrTaskVersionConflict
+        }
+        if err := services.DeleteSubtasks(tx, task); err != nil {
+            return err
+        }
+        return services.EnqueueTaskSync(tx, task)
+    })
+    if errors.Is(err, services.ErrTaskVersionConflict) {
+        respondTaskConflict(c, task.ID)
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete task"})
+        return
+    }
+    
+    c.JSON(http.StatusOK, gin.H{"message": "Task deleted successfully"})
+}
+
+// findTask loads the task in the path from the request's space, answering
+// 403 when the user's role there doesn't allow perm.
+func findTask(c *gin.Context, perm services.Permission) (*models.Task, bool) {
+    access, ok := authorize(c, perm)
+    if !ok {
+        return nil, false
+    }
+    taskID, err := strconv.Atoi(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+        return nil, false
+    }
+    
     var task models.Task
-    if err := db.Where("id = ? AND user_id = ?", taskID, userID).First(&task).Error; err != nil {
-        if err == gorm.ErrRecordNotFound {
+    if err := access.Scope(db).Where("id = ?", taskID).First(&task).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
             c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
         } else {
             c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch task"})
         }
+        return nil, false
+    }
+    return &task, true
+}
+
+// saveTask writes a changed task. If it was changed by someone else since
+// it was read, 412 is answered with their version.
+func saveTask(c *gin.Context, task *models.Task) {
+    err := db.Transaction(func(tx *gorm.DB) error {
+        return writeTask(tx, task)
+    })
+    respondTaskSaved(c, task, err)
+}
+
+// writeTask saves a changed task and carries the change over to its
+// subtasks, parent and series.
+func writeTask(tx *gorm.DB, task *models.Task) error {
+    if err := services.SaveTask(tx, task); err != nil {
+        return err
+    }
+    if err := services.EnqueueTaskSync(tx, task); err != nil {
+        return err
+    }
+    if err := services.MoveSubtasks(tx, task); err != nil {
+        return err
+    }
+    if err := services.AutoCompleteParent(tx, task); err != nil {
+        return err
+    }
+    _, err := services.NextOccurrence(tx, task)
+    return err
+}
+
+// respondTaskSaved answers the outcome of writing a task.
+func respondTaskSaved(c *gin.Context, task *models.Task, err error) {
+    if errors.Is(err, services.ErrTaskVersionConflict) {
+        respondTaskConflict(c, task.ID)
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update task"})
         return
     }
     
-    if req.Title != "" {
-        task.Title = req.Title
+    c.Header("ETag", services.TaskETag(task))
+    c.JSON(http.StatusOK, task)
+}
+
+// taskIfMatch checks the If-Match header of a request changing task. When
+// it names another version, 412 is answered with the current task.
+func taskIfMatch(c *gin.Context, task *models.Task) bool {
+    ifMatch := c.GetHeader("If-Match")
+    if ifMatch == "" || etagMatches(ifMatch, services.TaskETag(task)) {
+        return true
     }
-    if req.Description != "" {
-        task.Description = req.Description
+    
+    c.Header("ETag", services.TaskETag(task))
+    c.JSON(http.StatusPreconditionFailed, task)
+    return false
+}
+
+// respondTaskConflict answers 412 with the current version of a task that
+// changed while it was being written.
+func respondTaskConflict(c *gin.Context, taskID uint) {
+    var task models.Task
+    if err := db.First(&task, taskID).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+        } else {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch task"})
+        }
+        return
     }
-    if req.Status != "" {
-        task.Status = req.Status
+    
+    c.Header("ETag", services.TaskETag(&task))
+    c.JSON(http.StatusPreconditionFailed, task)
+}
+
+// applyTaskRequest validates a create or replace request and writes it onto
+// task, omitted fields taking their defaults. A new task must start in a
+// status the workflow allows, an existing one must be allowed to move to it.
+func applyTaskRequest(c *gin.Context, task *models.Task, req *CreateTaskRequest) bool {
+    workflow := services.TaskWorkflow()
+    if req.Status == "" {
+        req.Status = workflow.Initial
     }
-    if req.Priority != "" {
-        task.Priority = req.Priority
+    if req.Priority == "" {
+        req.Priority = models.PriorityMedium
     }
-    if req.DueDate != nil {
-        if *req.DueDate == "" {
-            task.DueDate = nil
-        } else {
-            dueDate, err := parseTime(*req.DueDate)
-            if err != nil {
-                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid due date format"})
-                return
-            }
-            task.DueDate = dueDate
+    if !validTaskEnums(c, req.Status, req.Priority) {
+        return false
+    }
+    
+    var err error
+    if task.ID == 0 {
+        err = workflow.CanCreate(req.Status)
+    } else {
+        err = workflow.CanTransition(task.Status, req.Status)
+    }
+    if err != nil {
+        respondTransitionError(c, err)
+        return false
+    }
+    if err := services.CheckNotBlocked(db, task, req.Status); err != nil {
+        respondBlockedError(c, err)
+        return false
+    }
+    
+    parentChanged := req.ParentID != nil && (task.ParentID == nil || *task.ParentID != *req.ParentID)
+    if parentChanged {
+        if err := services.ValidateParent(db, task, *req.ParentID); err != nil {
+            respondParentError(c, err)
+            return false
         }
     }
     
-    if err := db.Save(&task).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update task"})
-        return
+    // Subtasks follow their parent's project, they only change project
+    // along with it or by moving to another parent
+    projectID := req.ProjectID
+    if req.ParentID != nil {
+        parentProject, err := services.ParentProject(db, *req.ParentID)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check parent task"})
+            return false
+        }
+        if !parentChanged && !sameProject(projectID, parentProject) {
+            c.JSON(http.StatusUnprocessableEntity, gin.H{"error": services.ErrSubtaskProject.Error()})
+            return false
+        }
+        projectID = parentProject
+    } else if projectID != nil && !sameProject(projectID, task.ProjectID) {
+        if err := services.ValidateProject(db, services.TaskSpace(task), *projectID); err != nil {
+            respondProjectError(c, err)
+            return false
+        }
     }
     
-    c.JSON(http.StatusOK, task)
+    var dueDate *time.Time
+    allDay := false
+    if req.DueDate != nil && *req.DueDate != "" {
+        dueDate, err = parseTime(*req.DueDate)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid due date format"})
+            return false
+        }
+        allDay = isDateOnly(*req.DueDate)
+    }
+    
+    if req.RecurFrom == "" {
+        req.RecurFrom = models.RecurFromDue
+    }
+    if req.RecurFrom != models.RecurFromDue && req.RecurFrom != models.RecurFromCompletion {
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("recur_from must be %s or %s", models.RecurFromDue, models.RecurFromCompletion)})
+        return false
+    }
+    recurrence, err := services.NormalizeRecurrence(req.Recurrence)
+    if err != nil {
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+        return false
+    }
+    if recurrence != "" && dueDate == nil {
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": services.ErrRecurrenceNeedsDueDate.Error()})
+        return false
+    }
+    
+    if task.Status != req.Status {
+        // To the bottom of the new column
+        task.Position = ""
+    }
+    task.Title = req.Title
+    task.Description = req.Description
+    task.Status = req.Status
+    task.Priority = req.Priority
+    task.DueDate = dueDate
+    task.DueDateAllDay = allDay
+    task.ParentID = req.ParentID
+    task.CompleteWithSubtasks = req.CompleteWithSubtasks
+    task.ProjectID = projectID
+    task.Recurrence = recurrence
+    task.RecurFrom = req.RecurFrom
+    return true
 }
 
-func DeleteTask(c *gin.Context) {
-    userID := c.GetUint("user_id")
-    taskID, err := strconv.Atoi(c.Param("id"))
+// taskRequest is the request that would replace a task with itself, the
+// document merge patches apply to.
+func taskRequest(task *models.Task) *CreateTaskRequest {
+    req := &CreateTaskRequest{
+        Title:       task.Title,
+        Description: task.Description,
+        Status:      task.Status,
+        Priority:    task.Priority,
+        
+        ParentID:             task.ParentID,
+        CompleteWithSubtasks: task.CompleteWithSubtasks,
+        ProjectID:            task.ProjectID,
+        
+        Recurrence: task.Recurrence,
+        RecurFrom:  task.RecurFrom,
+    }
+    if task.DueDate != nil {
+        dueDate := task.DueDate.Format(time.RFC3339Nano)
+        if task.DueDateAllDay {
+            dueDate = task.DueDate.UTC().Format("2006-01-02")
+        }
+        req.DueDate = &dueDate
+    }
+    return req
+}
+
+// patchTaskRequest merges patch into req and checks the result like a bound
+// request body.
+func patchTaskRequest(req *CreateTaskRequest, patch interface{}) (*CreateTaskRequest, error) {
+    data, err := json.Marshal(req)
     if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
-        return
+        return nil, err
+    }
+    var doc interface{}
+    if err := json.Unmarshal(data, &doc); err != nil {
+        return nil, err
     }
     
-    result := db.Where("id = ? AND user_id = ?", taskID, userID).Delete(&models.Task{})
-    if result.Error != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete task"})
-        return
+    merged, err := json.Marshal(mergePatch(doc, patch))
+    if err != nil {
+        return nil, err
     }
     
-    if result.RowsAffected == 0 {
-        c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+    var patched CreateTaskRequest
+    if err := json.Unmarshal(merged, &patched); err != nil {
+        return nil, err
+    }
+    if err := binding.Validator.ValidateStruct(&patched); err != nil {
+        return nil, err
+    }
+    return &patched, nil
+}
+
+// validTaskEnums checks a status and priority, either may be empty, and
+// answers 422 when one is not a known value.
+func validTaskEnums(c *gin.Context, status, priority string) bool {
+    if status != "" && !models.ValidTaskStatus(status) {
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("status must be one of %s", strings.Join(models.TaskStatuses, ", "))})
+        return false
+    }
+    if priority != "" && !models.ValidTaskPriority(priority) {
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("priority must be one of %s", strings.Join(models.TaskPriorities, ", "))})
+        return false
+    }
+    return true
+}
+
+// respondParentError answers a parent_id the task can't be moved under.
+func respondParentError(c *gin.Context, err error) {
+    switch {
+    case errors.Is(err, services.ErrParentNotFound), errors.Is(err, services.ErrTaskCycle), errors.Is(err, services.ErrTaskTooDeep):
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+    default:
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check parent task"})
+    }
+}
+
+// respondProjectError answers a project_id the task can't be moved to.
+func respondProjectError(c *gin.Context, err error) {
+    if errors.Is(err, services.ErrProjectNotFound) || errors.Is(err, services.ErrProjectArchived) {
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
         return
     }
-    
-    c.JSON(http.StatusOK, gin.H{"message": "Task deleted successfully"})
+    c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check project"})
+}
+
+func sameProject(a, b *uint) bool {
+    if a == nil || b == nil {
+        return a == b
+    }
+    return *a == *b
+}
+
+// respondBlockedError answers a status change refused because of the tasks
+// still blocking the task, listing them.
+func respondBlockedError(c *gin.Context, err error) {
+    var blocked *services.BlockedError
+    if errors.As(err, &blocked) {
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": blocked.Error(), "blocked_by": blocked.BlockedBy})
+        return
+    }
+    c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check dependencies"})
+}
+
+// respondTransitionError answers a status change refused by the workflow
+// with the statuses the task may move to instead.
+func respondTransitionError(c *gin.Context, err error) {
+    var transition *services.TransitionError
+    if errors.As(err, &transition) {
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": transition.Error(), "allowed": transition.Allowed})
+        return
+    }
+    c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update task"})
 }
 
 func parseTime(timeStr string) (*time.Time, error) {
@@ -201,3 +639,9 @@ func parseTime(timeStr string) (*time.Time, error) {
     
     return nil, fmt.Errorf("could not parse time: %s", timeStr)
 }
+
+// isDateOnly reports whether a due date was given without a time of day.
+func isDateOnly(timeStr string) bool {
+    _, err := time.Parse("2006-01-02", timeStr)
+    return err == nil
+}
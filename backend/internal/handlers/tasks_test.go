@@ -0,0 +1,289 @@
+package handlers
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "testing"
+    "time"
+    "taskflow/internal/middleware"
+    "taskflow/internal/models"
+    "taskflow/internal/services"
+
+    "github.com/gin-gonic/gin"
+)
+
+// newTaskAPITest migrates every model, as config.InitDatabase does, and
+// creates users 1 to 3.
+func newTaskAPITest(t *testing.T) {
+    InitDB(newTestDB(t, &models.User{}, &models.Task{}, &models.SyncJob{}, &models.CalendarConnection{},
+        &models.TaskEventMapping{}, &models.CalDAVObject{}, &models.ChecklistItem{}, &models.TaskDependency{},
+        &models.Label{}, &models.TaskLabel{}, &models.Project{}, &models.Workspace{}, &models.WorkspaceMember{},
+        &models.TaskWatcher{}, &models.AssignmentChange{}))
+    t.Cleanup(func() { InitDB(nil) })
+
+    for _, user := range []models.User{
+        {ID: 1, Email: "ana@example.com"},
+        {ID: 2, Email: "bruno@example.com"},
+        {ID: 3, Email: "carla@example.com"},
+    } {
+        if err := db.Create(&user).Error; err != nil {
+            t.Fatal(err)
+        }
+    }
+}
+
+// taskTestRouter serves the task and label routes of main.go as the user
+// userID, standing in for AuthMiddleware.
+func taskTestRouter(userID uint) *gin.Engine {
+    gin.SetMode(gin.TestMode)
+    r := gin.New()
+    r.Use(func(c *gin.Context) {
+        c.Set("user_id", userID)
+        c.Next()
+    }, middleware.Workspace(db))
+
+    r.GET("/api/tasks", GetTasks)
+    r.POST("/api/tasks", CreateTask)
+    r.GET("/api/tasks/:id", GetTask)
+    r.PUT("/api/tasks/:id", UpdateTask)
+    r.PATCH("/api/tasks/:id", PatchTask)
+    r.DELETE("/api/tasks/:id", DeleteTask)
+    r.POST("/api/tasks/:id/move", MoveTask)
+    r.POST("/api/tasks/:id/dependencies", AddDependency)
+    r.DELETE("/api/tasks/:id/dependencies/:other_id", RemoveDependency)
+    r.POST("/api/tasks/:id/skip", SkipOccurrence)
+    r.PUT("/api/tasks/:id/labels", SetTaskLabels)
+    r.POST("/api/tasks/:id/labels/:label_id", AddTaskLabel)
+    r.DELETE("/api/tasks/:id/labels/:label_id", RemoveTaskLabel)
+    r.PUT("/api/tasks/:id/assignee", AssignTask)
+    r.DELETE("/api/tasks/:id/assignee", UnassignTask)
+    r.POST("/api/labels", CreateLabel)
+    r.PUT("/api/labels/:id", UpdateLabel)
+    r.POST("/api/labels/:id/merge", MergeLabel)
+    return r
+}
+
+func createTestTask(t *testing.T, task models.Task) *models.Task {
+    t.Helper()
+
+    if err := db.Create(&task).Error; err != nil {
+        t.Fatal(err)
+    }
+    return &task
+}
+
+func TestTaskStatusFollowsWorkflow(t *testing.T) {
+    newTaskAPITest(t)
+    r := taskTestRouter(1)
+    done := createTestTask(t, models.Task{UserID: 1, Title: "Pay rent", Status: models.StatusCompleted})
+
+    for _, tc := range []struct {
+        method, path, body string
+        want               int
+        allowed            string
+    }{
+        {http.MethodPost, "/api/tasks", `{"title": "Typo", "status": "done"}`, http.StatusUnprocessableEntity, ""},
+        {http.MethodPost, "/api/tasks", `{"title": "Urgent", "priority": "urgent"}`, http.StatusUnprocessableEntity, ""},
+        {http.MethodPut, "/api/tasks/1", `{"title": "Pay rent", "status": "in_progress"}`, http.StatusUnprocessableEntity, "[pending]"},
+        {http.MethodPatch, "/api/tasks/1", `{"status": "in_progress"}`, http.StatusUnprocessableEntity, "[pending]"},
+        {http.MethodPatch, "/api/tasks/1", `{"status": "pending"}`, http.StatusOK, ""},
+    } {
+        w := serve(r, tc.method, tc.path, tc.body)
+        if w.Code != tc.want {
+            t.Errorf("%s %s %s: got %d, want %d: %s", tc.method, tc.path, tc.body, w.Code, tc.want, w.Body)
+            continue
+        }
+        if tc.allowed == "" {
+            continue
+        }
+        var resp struct {
+            Allowed []string `json:"allowed"`
+        }
+        if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+            t.Fatal(err)
+        }
+        if got := fmt.Sprint(resp.Allowed); got != tc.allowed {
+            t.Errorf("%s %s %s: got allowed %s, want %s", tc.method, tc.path, tc.body, got, tc.allowed)
+        }
+    }
+
+    var task models.Task
+    if err := db.First(&task, done.ID).Error; err != nil {
+        t.Fatal(err)
+    }
+    if task.Status != models.StatusPending {
+        t.Errorf("got status %s, want pending", task.Status)
+    }
+    var count int64
+    if err := db.Model(&models.Task{}).Count(&count).Error; err != nil {
+        t.Fatal(err)
+    }
+    if count != 1 {
+        t.Errorf("got %d tasks, want the invalid ones refused", count)
+    }
+}
+
+func TestSearchTasksOnSQLite(t *testing.T) {
+    InitDB(newTestDB(t, &models.User{}, &models.Task{}, &models.Project{}))
+    t.Cleanup(func() { InitDB(nil) })
+
+    for _, user := range []models.User{{ID: 1, Email: "ana@example.com"}, {ID: 2, Email: "bruno@example.com"}} {
+        if err := db.Create(&user).Error; err != nil {
+            t.Fatal(err)
+        }
+    }
+    for _, task := range []models.Task{
+        {UserID: 1, Title: "Pay <b>rent</b>"},
+        {UserID: 1, Title: "Groceries", Description: "pay for the rental car too"},
+        {UserID: 1, Title: "Walk the dog"},
+        {UserID: 2, Title: "Pay rent"},
+    } {
+        if err := db.Create(&task).Error; err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    gin.SetMode(gin.TestMode)
+    r := gin.New()
+    r.Use(func(c *gin.Context) {
+        c.Set("user_id", uint(1))
+        c.Next()
+    })
+    r.GET("/api/tasks/search", SearchTasks)
+
+    w := serve(r, http.MethodGet, "/api/tasks/search?q=pay+ren", "")
+    if w.Code != http.StatusOK {
+        t.Fatalf("got %d, want 200: %s", w.Code, w.Body)
+    }
+
+    var results []services.TaskSearchResult
+    if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+        t.Fatal(err)
+    }
+    if len(results) != 2 || results[0].Title != "Pay <b>rent</b>" || results[1].Title != "Groceries" {
+        t.Fatalf("got %+v, want the user's two matching tasks, title match first", results)
+    }
+    if got, want := results[0].TitleHighlight, "<mark>Pay</mark> &lt;b&gt;<mark>ren</mark>t&lt;/b&gt;"; got != want {
+        t.Errorf("got title %q, want %q", got, want)
+    }
+    if got, want := results[1].Snippet, "<mark>pay</mark> for the <mark>ren</mark>tal car too"; got != want {
+        t.Errorf("got snippet %q, want %q", got, want)
+    }
+}
+
+func TestStaleIfMatchIsRefused(t *testing.T) {
+    newTaskAPITest(t)
+    r := taskTestRouter(1)
+    due := time.Date(2026, 11, 2, 9, 0, 0, 0, time.UTC)
+    task := createTestTask(t, models.Task{UserID: 1, Title: "Water the plants", DueDate: &due, Recurrence: "FREQ=WEEKLY", Version: 3})
+    createTestTask(t, models.Task{UserID: 1, Title: "Other"})
+    label := models.Label{UserID: 1, Name: "home", Color: "#00aa00"}
+    if err := db.Create(&label).Error; err != nil {
+        t.Fatal(err)
+    }
+
+    current := services.TaskETag(task)
+    stale := fmt.Sprintf(`"%d-2"`, task.ID)
+    path := fmt.Sprintf("/api/tasks/%d", task.ID)
+    for _, tc := range []struct {
+        method, path, body string
+    }{
+        {http.MethodPut, path, `{"title": "Water the garden"}`},
+        {http.MethodPatch, path, `{"title": "Water the garden"}`},
+        {http.MethodDelete, path, ""},
+        {http.MethodPost, path + "/move", `{"status": "in_progress"}`},
+        {http.MethodPut, path + "/labels", fmt.Sprintf(`{"label_ids": [%d]}`, label.ID)},
+        {http.MethodPost, fmt.Sprintf("%s/labels/%d", path, label.ID), ""},
+        {http.MethodPut, path + "/assignee", `{"assignee_id": 1}`},
+        {http.MethodPost, path + "/skip", ""},
+    } {
+        w := serveWith(r, tc.method, tc.path, tc.body, map[string]string{"If-Match": stale})
+        if w.Code != http.StatusPreconditionFailed {
+            t.Errorf("%s %s: got %d, want 412: %s", tc.method, tc.path, w.Code, w.Body)
+            continue
+        }
+        if got := w.Header().Get("ETag"); got != current {
+            t.Errorf("%s %s: got ETag %s, want %s", tc.method, tc.path, got, current)
+        }
+        var body models.Task
+        if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+            t.Fatal(err)
+        }
+        if body.ID != task.ID || body.Version != task.Version || body.Title != task.Title {
+            t.Errorf("%s %s: got %+v, want the current task", tc.method, tc.path, body)
+        }
+    }
+
+    var stored models.Task
+    if err := db.First(&stored, task.ID).Error; err != nil {
+        t.Fatalf("the task is gone: %v", err)
+    }
+    if stored.Version != task.Version || stored.Title != task.Title || stored.Status != task.Status {
+        t.Errorf("got %+v, want the task untouched", stored)
+    }
+}
+
+func TestEveryTaskWriteIsANewVersion(t *testing.T) {
+    newTaskAPITest(t)
+    r := taskTestRouter(1)
+    due := time.Date(2026, 11, 2, 9, 0, 0, 0, time.UTC)
+    task := createTestTask(t, models.Task{UserID: 1, Title: "Water the plants", DueDate: &due, Recurrence: "FREQ=WEEKLY", Version: 1})
+    label := models.Label{UserID: 1, Name: "home", Color: "#00aa00"}
+    if err := db.Create(&label).Error; err != nil {
+        t.Fatal(err)
+    }
+
+    etag := services.TaskETag(task)
+    path := fmt.Sprintf("/api/tasks/%d", task.ID)
+    for i, tc := range []struct {
+        method, path, body string
+        ifMatch            bool
+    }{
+        {http.MethodPut, path, `{"title": "Water the plants", "due_date": "2026-11-02T09:00:00Z", "recurrence": "FREQ=WEEKLY"}`, false},
+        {http.MethodPatch, path, `{"priority": "high"}`, true},
+        {http.MethodPost, path + "/move", `{"status": "in_progress"}`, true},
+        {http.MethodPut, path + "/labels", fmt.Sprintf(`{"label_ids": [%d]}`, label.ID), true},
+        {http.MethodDelete, fmt.Sprintf("%s/labels/%d", path, label.ID), "", false},
+        {http.MethodPost, fmt.Sprintf("%s/labels/%d", path, label.ID), "", true},
+        {http.MethodPut, path + "/assignee", `{"assignee_id": 1}`, true},
+        {http.MethodDelete, path + "/assignee", "", false},
+    } {
+        headers := map[string]string{}
+        if tc.ifMatch {
+            headers["If-Match"] = etag
+        }
+        w := serveWith(r, tc.method, tc.path, tc.body, headers)
+        if w.Code != http.StatusOK {
+            t.Fatalf("%s %s: got %d, want 200: %s", tc.method, tc.path, w.Code, w.Body)
+        }
+
+        var stored models.Task
+        if err := db.First(&stored, task.ID).Error; err != nil {
+            t.Fatal(err)
+        }
+        if want := uint(i + 2); stored.Version != want {
+            t.Errorf("%s %s: got version %d, want %d", tc.method, tc.path, stored.Version, want)
+        }
+        if got := w.Header().Get("ETag"); got != services.TaskETag(&stored) || got == etag {
+            t.Errorf("%s %s: got ETag %s after %s, want %s", tc.method, tc.path, got, etag, services.TaskETag(&stored))
+        }
+        etag = w.Header().Get("ETag")
+    }
+
+    // Skipping replaces the occurrence with the next one
+    w := serveWith(r, http.MethodPost, path+"/skip", "", map[string]string{"If-Match": etag})
+    if w.Code != http.StatusOK {
+        t.Fatalf("skip: got %d, want 200: %s", w.Code, w.Body)
+    }
+    var next models.Task
+    if err := json.Unmarshal(w.Body.Bytes(), &next); err != nil {
+        t.Fatal(err)
+    }
+    if next.ID == task.ID || w.Header().Get("ETag") != services.TaskETag(&next) {
+        t.Errorf("skip: got %+v with ETag %s, want the next occurrence", next, w.Header().Get("ETag"))
+    }
+    if w := serveWith(r, http.MethodPatch, path, `{"title": "Late"}`, map[string]string{"If-Match": etag}); w.Code != http.StatusNotFound {
+        t.Errorf("skipped occurrence: got %d, want 404", w.Code)
+    }
+}
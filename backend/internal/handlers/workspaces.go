@@ -0,0 +1,436 @@
+package handlers
+
+import (
+    "errors"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+    "taskflow/internal/auth"
+    "taskflow/internal/models"
+    "taskflow/internal/services"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+)
+
+const maxWorkspaceName = 255
+
+type WorkspaceRequest struct {
+    Name string `json:"name" binding:"required"`
+}
+
+type MemberRequest struct {
+    Email string `json:"email"`
+    Role  string `json:"role"`
+}
+
+// SwitchWorkspaceRequest names the workspace a new token works in, null
+// for the user's own tasks.
+type SwitchWorkspaceRequest struct {
+    WorkspaceID *uint `json:"workspace_id"`
+}
+
+// workspaceResponse is a workspace with the role the user has in it.
+type workspaceResponse struct {
+    models.Workspace
+    Role string `json:"role"`
+}
+
+type memberResponse struct {
+    UserID    uint      `json:"user_id"`
+    Name      string    `json:"name"`
+    Email     string    `json:"email"`
+    Role      string    `json:"role"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// GetWorkspaces lists the workspaces the user is a member of.
+func GetWorkspaces(c *gin.Context) {
+    userID := c.GetUint("user_id")
+
+    var workspaces []workspaceResponse
+    err := db.Model(&models.Workspace{}).
+        Select("workspaces.*, workspace_members.role").
+        Joins("JOIN workspace_members ON workspace_members.workspace_id = workspaces.id").
+        Where("workspace_members.user_id = ?", userID).
+        Order("workspaces.name, workspaces.id").
+        Scan(&workspaces).Error
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch workspaces"})
+        return
+    }
+
+    c.JSON(http.StatusOK, workspaces)
+}
+
+// CreateWorkspace creates a workspace owned by the user.
+func CreateWorkspace(c *gin.Context) {
+    var req WorkspaceRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    workspace := models.Workspace{}
+    if !applyWorkspaceRequest(c, &workspace, &req) {
+        return
+    }
+
+    err := db.Transaction(func(tx *gorm.DB) error {
+        return services.CreateWorkspace(tx, &workspace, c.GetUint("user_id"))
+    })
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create workspace"})
+        return
+    }
+
+    c.JSON(http.StatusCreated, workspaceResponse{Workspace: workspace, Role: models.RoleOwner})
+}
+
+func GetWorkspace(c *gin.Context) {
+    workspace, access, ok := findWorkspace(c, services.PermView)
+    if !ok {
+        return
+    }
+
+    c.JSON(http.StatusOK, workspaceResponse{Workspace: *workspace, Role: access.Role})
+}
+
+// UpdateWorkspace renames a workspace, for its owner and admins.
+func UpdateWorkspace(c *gin.Context) {
+    workspace, access, ok := findWorkspace(c, services.PermManage)
+    if !ok {
+        return
+    }
+
+    var req WorkspaceRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if !applyWorkspaceRequest(c, workspace, &req) {
+        return
+    }
+
+    if err := db.Save(workspace).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update workspace"})
+        return
+    }
+
+    c.JSON(http.StatusOK, workspaceResponse{Workspace: *workspace, Role: access.Role})
+}
+
+// DeleteWorkspace deletes a workspace and everything in it, for its owner.
+func DeleteWorkspace(c *gin.Context) {
+    workspace, _, ok := findWorkspace(c, services.PermOwn)
+    if !ok {
+        return
+    }
+
+    err := db.Transaction(func(tx *gorm.DB) error {
+        return services.DeleteWorkspace(tx, workspace)
+    })
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete workspace"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Workspace deleted successfully"})
+}
+
+func GetMembers(c *gin.Context) {
+    workspace, _, ok := findWorkspace(c, services.PermView)
+    if !ok {
+        return
+    }
+
+    members, err := workspaceMembers(workspace.ID, 0)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch members"})
+        return
+    }
+
+    c.JSON(http.StatusOK, members)
+}
+
+// AddMember adds the user with the email in the body to a workspace, as a
+// member unless another role is given.
+func AddMember(c *gin.Context) {
+    workspace, access, ok := findWorkspace(c, services.PermManage)
+    if !ok {
+        return
+    }
+
+    var req MemberRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if req.Email == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "email is required"})
+        return
+    }
+    if req.Role == "" {
+        req.Role = models.RoleMember
+    }
+    if !validRole(c, req.Role) {
+        return
+    }
+
+    var user models.User
+    if err := db.Where("email = ?", strings.TrimSpace(req.Email)).First(&user).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "No user with this email"})
+        } else {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+        }
+        return
+    }
+
+    err := db.Transaction(func(tx *gorm.DB) error {
+        _, err := services.AddMember(tx, access, user.ID, req.Role)
+        return err
+    })
+    if respondMemberError(c, err) {
+        return
+    }
+
+    members, err := workspaceMembers(workspace.ID, user.ID)
+    if err != nil || len(members) == 0 {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch members"})
+        return
+    }
+
+    c.JSON(http.StatusCreated, members[0])
+}
+
+// UpdateMember changes the role of a member. Making someone owner hands the
+// workspace over to them.
+func UpdateMember(c *gin.Context) {
+    workspace, access, ok := findWorkspace(c, services.PermManage)
+    if !ok {
+        return
+    }
+    member, ok := findMember(c, workspace)
+    if !ok {
+        return
+    }
+
+    var req MemberRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if !validRole(c, req.Role) {
+        return
+    }
+
+    err := db.Transaction(func(tx *gorm.DB) error {
+        return services.SetMemberRole(tx, access, member, req.Role)
+    })
+    if respondMemberError(c, err) {
+        return
+    }
+
+    members, err := workspaceMembers(workspace.ID, member.UserID)
+    if err != nil || len(members) == 0 {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch members"})
+        return
+    }
+
+    c.JSON(http.StatusOK, members[0])
+}
+
+// RemoveMember takes a user out of a workspace. Members can always remove
+// themselves to leave it.
+func RemoveMember(c *gin.Context) {
+    workspace, access, ok := findWorkspace(c, services.PermView)
+    if !ok {
+        return
+    }
+    member, ok := findMember(c, workspace)
+    if !ok {
+        return
+    }
+    if member.UserID != access.UserID && !access.Can(services.PermManage) {
+        c.JSON(http.StatusForbidden, gin.H{"error": "Your role doesn't allow this"})
+        return
+    }
+
+    err := db.Transaction(func(tx *gorm.DB) error {
+        return services.RemoveMember(tx, access, member)
+    })
+    if respondMemberError(c, err) {
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
+}
+
+// SwitchWorkspace issues a token working in another workspace, or in the
+// user's own tasks. Requests can also pick one with the X-Workspace-ID
+// header.
+func SwitchWorkspace(c *gin.Context) {
+    userID := c.GetUint("user_id")
+
+    var req SwitchWorkspaceRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    var workspaceID uint
+    if req.WorkspaceID != nil {
+        if _, err := services.WorkspaceAccess(db, userID, *req.WorkspaceID); err != nil {
+            if errors.Is(err, services.ErrNotMember) {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+            } else {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check workspace"})
+            }
+            return
+        }
+        workspaceID = *req.WorkspaceID
+    }
+
+    var user models.User
+    if err := db.First(&user, userID).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+        return
+    }
+
+    token, err := auth.GenerateWorkspaceJWT(userID, workspaceID)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+        return
+    }
+
+    user.Password = ""
+    c.JSON(http.StatusOK, AuthResponse{Token: token, User: user})
+}
+
+// requestAccess is what the user may do in the space the request works in,
+// as resolved by middleware.Workspace. Without it, that is the user's own
+// tasks.
+func requestAccess(c *gin.Context) *services.Access {
+    if access, ok := c.Get("access"); ok {
+        return access.(*services.Access)
+    }
+    return services.PersonalAccess(c.GetUint("user_id"))
+}
+
+// authorize answers 403 unless the user's role in the request's space
+// allows perm.
+func authorize(c *gin.Context, perm services.Permission) (*services.Access, bool) {
+    access := requestAccess(c)
+    if !access.Can(perm) {
+        c.JSON(http.StatusForbidden, gin.H{"error": "Your role doesn't allow this"})
+        return nil, false
+    }
+    return access, true
+}
+
+func applyWorkspaceRequest(c *gin.Context, workspace *models.Workspace, req *WorkspaceRequest) bool {
+    name := strings.TrimSpace(req.Name)
+    if name == "" || len(name) > maxWorkspaceName {
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "name must be between 1 and 255 characters"})
+        return false
+    }
+    workspace.Name = name
+    return true
+}
+
+func validRole(c *gin.Context, role string) bool {
+    for _, r := range models.WorkspaceRoles {
+        if r == role {
+            return true
+        }
+    }
+    c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "role must be one of " + strings.Join(models.WorkspaceRoles, ", ")})
+    return false
+}
+
+// respondMemberError answers a membership change the user's role doesn't
+// allow. It reports whether there was an error.
+func respondMemberError(c *gin.Context, err error) bool {
+    switch {
+    case err == nil:
+        return false
+    case errors.Is(err, services.ErrOwnerRequired):
+        c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+    case errors.Is(err, services.ErrAlreadyMember):
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+    case errors.Is(err, services.ErrOwnerRole), errors.Is(err, services.ErrOwnerCantLeave):
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+    default:
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update members"})
+    }
+    return true
+}
+
+// workspaceMembers lists the members of a workspace, only userID's when it
+// is set.
+func workspaceMembers(workspaceID, userID uint) ([]memberResponse, error) {
+    query := db.Model(&models.WorkspaceMember{}).
+        Select("workspace_members.user_id, users.name, users.email, workspace_members.role, workspace_members.created_at").
+        Joins("JOIN users ON users.id = workspace_members.user_id").
+        Where("workspace_members.workspace_id = ?", workspaceID)
+    if userID != 0 {
+        query = query.Where("workspace_members.user_id = ?", userID)
+    }
+
+    members := []memberResponse{}
+    err := query.Order("users.name, users.id").Scan(&members).Error
+    return members, err
+}
+
+// findWorkspace loads the workspace in the path with the user's access to
+// it, answering 404 to non-members and 403 when their role doesn't allow
+// perm.
+func findWorkspace(c *gin.Context, perm services.Permission) (*models.Workspace, *services.Access, bool) {
+    workspaceID, err := strconv.Atoi(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
+        return nil, nil, false
+    }
+
+    access, err := services.WorkspaceAccess(db, c.GetUint("user_id"), uint(workspaceID))
+    if err != nil {
+        if errors.Is(err, services.ErrNotMember) {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+        } else {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch workspace"})
+        }
+        return nil, nil, false
+    }
+    if !access.Can(perm) {
+        c.JSON(http.StatusForbidden, gin.H{"error": "Your role doesn't allow this"})
+        return nil, nil, false
+    }
+
+    var workspace models.Workspace
+    if err := db.First(&workspace, workspaceID).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch workspace"})
+        return nil, nil, false
+    }
+    return &workspace, access, true
+}
+
+func findMember(c *gin.Context, workspace *models.Workspace) (*models.WorkspaceMember, bool) {
+    userID, err := strconv.Atoi(c.Param("user_id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+        return nil, false
+    }
+
+    var member models.WorkspaceMember
+    if err := db.Where("workspace_id = ? AND user_id = ?", workspace.ID, userID).First(&member).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+        } else {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch member"})
+        }
+        return nil, false
+    }
+    return &member, true
+}
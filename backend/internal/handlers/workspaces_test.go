@@ -0,0 +1,186 @@
+package handlers
+
+import (
+    "fmt"
+    "net/http"
+    "strconv"
+    "testing"
+    "taskflow/internal/auth"
+    "taskflow/internal/middleware"
+    "taskflow/internal/models"
+    "taskflow/internal/services"
+
+    "github.com/gin-gonic/gin"
+)
+
+// newWorkspaceTest creates a workspace owned by ana (user 1) with bruno as
+// admin, carla as member and dora (user 4) as viewer.
+func newWorkspaceTest(t *testing.T) *models.Workspace {
+    t.Helper()
+
+    newTaskAPITest(t)
+    if err := db.Create(&models.User{ID: 4, Email: "dora@example.com"}).Error; err != nil {
+        t.Fatal(err)
+    }
+    return createTestWorkspace(t, "Home", 1, map[uint]string{2: models.RoleAdmin, 3: models.RoleMember, 4: models.RoleViewer})
+}
+
+func createTestWorkspace(t *testing.T, name string, ownerID uint, members map[uint]string) *models.Workspace {
+    t.Helper()
+
+    workspace := models.Workspace{Name: name}
+    if err := services.CreateWorkspace(db, &workspace, ownerID); err != nil {
+        t.Fatal(err)
+    }
+    for userID, role := range members {
+        member := models.WorkspaceMember{WorkspaceID: workspace.ID, UserID: userID, Role: role}
+        if err := db.Create(&member).Error; err != nil {
+            t.Fatal(err)
+        }
+    }
+    return &workspace
+}
+
+// workspaceTestRouter serves the task and label routes of taskTestRouter
+// along with the workspace member routes.
+func workspaceTestRouter(userID uint) *gin.Engine {
+    r := taskTestRouter(userID)
+    r.POST("/api/workspaces/:id/members", AddMember)
+    r.PUT("/api/workspaces/:id/members/:user_id", UpdateMember)
+    r.DELETE("/api/workspaces/:id/members/:user_id", RemoveMember)
+    return r
+}
+
+func TestViewerCantChangeTasks(t *testing.T) {
+    workspace := newWorkspaceTest(t)
+    r := workspaceTestRouter(4)
+    in := map[string]string{middleware.WorkspaceHeader: strconv.Itoa(int(workspace.ID))}
+
+    task := createTestTask(t, models.Task{UserID: 1, WorkspaceID: &workspace.ID, Title: "Fix the sink"})
+    other := createTestTask(t, models.Task{UserID: 1, WorkspaceID: &workspace.ID, Title: "Buy a wrench"})
+    label := models.Label{UserID: 1, WorkspaceID: &workspace.ID, Name: "chores", Color: defaultColor}
+    if err := db.Create(&label).Error; err != nil {
+        t.Fatal(err)
+    }
+    path := fmt.Sprintf("/api/tasks/%d", task.ID)
+
+    if w := serveWith(r, http.MethodGet, path, "", in); w.Code != http.StatusOK {
+        t.Fatalf("GET %s: got %d, want 200: %s", path, w.Code, w.Body)
+    }
+
+    for _, tc := range []struct {
+        method, path, body string
+    }{
+        {http.MethodPut, path, `{"title": "Fix the tap"}`},
+        {http.MethodPatch, path, `{"title": "Fix the tap"}`},
+        {http.MethodDelete, path, ""},
+        {http.MethodPost, path + "/move", `{"status": "in_progress"}`},
+        {http.MethodPut, path + "/labels", fmt.Sprintf(`{"label_ids": [%d]}`, label.ID)},
+        {http.MethodPost, fmt.Sprintf("%s/labels/%d", path, label.ID), ""},
+        {http.MethodPost, path + "/dependencies", fmt.Sprintf(`{"blocker_id": %d}`, other.ID)},
+        {http.MethodDelete, fmt.Sprintf("%s/dependencies/%d", path, other.ID), ""},
+        {http.MethodPost, "/api/tasks", `{"title": "Call a plumber"}`},
+    } {
+        if w := serveWith(r, tc.method, tc.path, tc.body, in); w.Code != http.StatusForbidden {
+            t.Errorf("%s %s: got %d, want 403: %s", tc.method, tc.path, w.Code, w.Body)
+        }
+    }
+
+    var stored models.Task
+    if err := db.First(&stored, task.ID).Error; err != nil {
+        t.Fatal(err)
+    }
+    if stored.Title != task.Title || stored.Version != task.Version {
+        t.Errorf("got %q version %d, want the task unchanged", stored.Title, stored.Version)
+    }
+}
+
+func TestMemberRoles(t *testing.T) {
+    workspace := newWorkspaceTest(t)
+    members := fmt.Sprintf("/api/workspaces/%d/members", workspace.ID)
+
+    for _, tc := range []struct {
+        name               string
+        userID             uint
+        method, path, body string
+        want               int
+    }{
+        {"member adds a member", 3, http.MethodPost, members, `{"email": "eva@example.com"}`, http.StatusForbidden},
+        {"member changes a role", 3, http.MethodPut, members + "/4", `{"role": "member"}`, http.StatusForbidden},
+        {"member removes a member", 3, http.MethodDelete, members + "/4", "", http.StatusForbidden},
+        {"viewer removes a member", 4, http.MethodDelete, members + "/3", "", http.StatusForbidden},
+        {"admin promotes to admin", 2, http.MethodPut, members + "/3", `{"role": "admin"}`, http.StatusForbidden},
+        {"admin demotes the owner", 2, http.MethodPut, members + "/1", `{"role": "member"}`, http.StatusUnprocessableEntity},
+        {"admin makes themselves owner", 2, http.MethodPut, members + "/2", `{"role": "owner"}`, http.StatusForbidden},
+        {"admin removes the owner", 2, http.MethodDelete, members + "/1", "", http.StatusUnprocessableEntity},
+        {"owner leaves", 1, http.MethodDelete, members + "/1", "", http.StatusUnprocessableEntity},
+        {"owner demotes themselves", 1, http.MethodPut, members + "/1", `{"role": "admin"}`, http.StatusUnprocessableEntity},
+        {"admin makes a member viewer", 2, http.MethodPut, members + "/3", `{"role": "viewer"}`, http.StatusOK},
+        {"viewer leaves", 4, http.MethodDelete, members + "/4", "", http.StatusOK},
+    } {
+        w := serve(workspaceTestRouter(tc.userID), tc.method, tc.path, tc.body)
+        if w.Code != tc.want {
+            t.Errorf("%s: got %d, want %d: %s", tc.name, w.Code, tc.want, w.Body)
+        }
+    }
+
+    var roles []models.WorkspaceMember
+    if err := db.Where("workspace_id = ?", workspace.ID).Order("user_id").Find(&roles).Error; err != nil {
+        t.Fatal(err)
+    }
+    got := make([]string, len(roles))
+    for i, member := range roles {
+        got[i] = fmt.Sprintf("%d:%s", member.UserID, member.Role)
+    }
+    if fmt.Sprint(got) != "[1:owner 2:admin 3:viewer]" {
+        t.Errorf("got members %v", got)
+    }
+}
+
+func TestNonMemberGets404(t *testing.T) {
+    newWorkspaceTest(t)
+    if err := db.Create(&models.User{ID: 5, Email: "eva@example.com"}).Error; err != nil {
+        t.Fatal(err)
+    }
+    theirs := createTestWorkspace(t, "Office", 5, nil)
+    task := createTestTask(t, models.Task{UserID: 5, WorkspaceID: &theirs.ID, Title: "Quarterly report"})
+    path := fmt.Sprintf("/api/tasks/%d", task.ID)
+
+    token, err := auth.GenerateWorkspaceJWT(1, theirs.ID)
+    if err != nil {
+        t.Fatal(err)
+    }
+    gin.SetMode(gin.TestMode)
+    withToken := gin.New()
+    withToken.Use(middleware.AuthMiddleware(), middleware.Workspace(db))
+    withToken.GET("/api/tasks/:id", GetTask)
+    withToken.PUT("/api/tasks/:id", UpdateTask)
+
+    header := map[string]string{middleware.WorkspaceHeader: strconv.Itoa(int(theirs.ID))}
+    bearer := map[string]string{"Authorization": "Bearer " + token}
+    for _, tc := range []struct {
+        name    string
+        r       *gin.Engine
+        method  string
+        body    string
+        headers map[string]string
+    }{
+        {"header", taskTestRouter(1), http.MethodGet, "", header},
+        {"header", taskTestRouter(1), http.MethodPut, `{"title": "Mine now"}`, header},
+        {"token", withToken, http.MethodGet, "", bearer},
+        {"token", withToken, http.MethodPut, `{"title": "Mine now"}`, bearer},
+        {"own tasks", taskTestRouter(1), http.MethodGet, "", nil},
+    } {
+        if w := serveWith(tc.r, tc.method, path, tc.body, tc.headers); w.Code != http.StatusNotFound {
+            t.Errorf("%s %s with the %s: got %d, want 404: %s", tc.method, path, tc.name, w.Code, w.Body)
+        }
+    }
+
+    var stored models.Task
+    if err := db.First(&stored, task.ID).Error; err != nil {
+        t.Fatal(err)
+    }
+    if stored.Title != task.Title {
+        t.Errorf("got title %q, want the task unchanged", stored.Title)
+    }
+}
@@ -0,0 +1,360 @@
+// Package ical reads and writes the subset of iCalendar (RFC 5545) that
+// TaskFlow exchanges with calendar servers and clients.
+package ical
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+    "time"
+)
+
+const (
+    dateLayout        = "20060102"
+    dateTimeLayout    = "20060102T150405"
+    utcDateTimeLayout = "20060102T150405Z"
+)
+
+// maxLineOctets is the longest content line allowed before folding.
+const maxLineOctets = 75
+
+var ErrMalformed = errors.New("malformed iCalendar data")
+
+type Property struct {
+    Name   string
+    Params map[string]string
+    Value  string
+}
+
+type Component struct {
+    Name       string
+    Props      []Property
+    Components []*Component
+}
+
+func NewComponent(name string) *Component {
+    return &Component{Name: name}
+}
+
+// NewCalendar returns a VCALENDAR with the mandatory properties set.
+func NewCalendar() *Component {
+    cal := NewComponent("VCALENDAR")
+    cal.Set("VERSION", "2.0")
+    cal.Set("PRODID", "-//TaskFlow//TaskFlow//EN")
+    cal.Set("CALSCALE", "GREGORIAN")
+    return cal
+}
+
+// Set replaces every property with the given name.
+func (c *Component) Set(name, value string) {
+    c.Remove(name)
+    c.Props = append(c.Props, Property{Name: name, Value: value})
+}
+
+// SetText sets a TEXT property, escaping its value.
+func (c *Component) SetText(name, value string) {
+    c.Set(name, EscapeText(value))
+}
+
+// SetTime sets a DATE-TIME property in UTC, or a DATE property for all-day
+// values.
+func (c *Component) SetTime(name string, t time.Time, allDay bool) {
+    c.Remove(name)
+    if allDay {
+        c.Props = append(c.Props, Property{Name: name, Params: map[string]string{"VALUE": "DATE"}, Value: t.Format(dateLayout)})
+        return
+    }
+    c.Props = append(c.Props, Property{Name: name, Value: t.UTC().Format(utcDateTimeLayout)})
+}
+
+// SetLocalTime sets a DATE-TIME property at t's local time, qualified with
+// the TZID of its location. Recurrence rules expand in the zone of DTSTART,
+// so repeating events need it for their days to be the local ones.
+func (c *Component) SetLocalTime(name string, t time.Time) {
+    if t.Location() == time.UTC {
+        c.SetTime(name, t, false)
+        return
+    }
+    c.Remove(name)
+    c.Props = append(c.Props, Property{Name: name, Params: map[string]string{"TZID": t.Location().String()}, Value: t.Format(dateTimeLayout)})
+}
+
+func (c *Component) Remove(name string) {
+    props := c.Props[:0]
+    for _, prop := range c.Props {
+        if prop.Name != name {
+            props = append(props, prop)
+        }
+    }
+    c.Props = props
+}
+
+// Get returns the first property with the given name.
+func (c *Component) Get(name string) *Property {
+    for i := range c.Props {
+        if c.Props[i].Name == name {
+            return &c.Props[i]
+        }
+    }
+    return nil
+}
+
+// Text returns the unescaped value of a TEXT property, or "".
+func (c *Component) Text(name string) string {
+    if prop := c.Get(name); prop != nil {
+        return UnescapeText(prop.Value)
+    }
+    return ""
+}
+
+// Time parses a DATE or DATE-TIME property. allDay is true for DATE values.
+func (c *Component) Time(name string) (t time.Time, allDay bool, ok bool, err error) {
+    prop := c.Get(name)
+    if prop == nil {
+        return time.Time{}, false, false, nil
+    }
+    t, allDay, err = ParseTime(prop.Value, prop.Params)
+    return t, allDay, err == nil, err
+}
+
+func (c *Component) Add(child *Component) {
+    c.Components = append(c.Components, child)
+}
+
+// Children returns the direct sub-components with the given name.
+func (c *Component) Children(name string) []*Component {
+    var children []*Component
+    for _, child := range c.Components {
+        if child.Name == name {
+            children = append(children, child)
+        }
+    }
+    return children
+}
+
+// ParseTime reads DATE, floating, UTC and TZID qualified DATE-TIME values.
+func ParseTime(value string, params map[string]string) (time.Time, bool, error) {
+    if params["VALUE"] == "DATE" || len(value) == len(dateLayout) {
+        t, err := time.Parse(dateLayout, value)
+        return t, true, err
+    }
+
+    if strings.HasSuffix(value, "Z") {
+        t, err := time.Parse(utcDateTimeLayout, value)
+        return t, false, err
+    }
+
+    loc := time.UTC
+    if tzid := params["TZID"]; tzid != "" {
+        if l, err := time.LoadLocation(tzid); err == nil {
+            loc = l
+        }
+    }
+    t, err := time.ParseInLocation(dateTimeLayout, value, loc)
+    return t, false, err
+}
+
+// FormatTime formats a DATE-TIME value in UTC.
+func FormatTime(t time.Time) string {
+    return t.UTC().Format(utcDateTimeLayout)
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func EscapeText(value string) string {
+    return textEscaper.Replace(value)
+}
+
+func UnescapeText(value string) string {
+    var b strings.Builder
+    for i := 0; i < len(value); i++ {
+        if value[i] == '\\' && i+1 < len(value) {
+            i++
+            switch value[i] {
+            case 'n', 'N':
+                b.WriteByte('\n')
+            default:
+                b.WriteByte(value[i])
+            }
+            continue
+        }
+        b.WriteByte(value[i])
+    }
+    return b.String()
+}
+
+// Encode writes the component as iCalendar text with CRLF line endings and
+// lines folded at 75 octets.
+func (c *Component) Encode(w io.Writer) error {
+    bw := bufio.NewWriter(w)
+    c.encode(bw)
+    return bw.Flush()
+}
+
+func (c *Component) String() string {
+    var b strings.Builder
+    c.Encode(&b)
+    return b.String()
+}
+
+func (c *Component) encode(w *bufio.Writer) {
+    writeLine(w, "BEGIN:"+c.Name)
+    for _, prop := range c.Props {
+        writeLine(w, prop.encode())
+    }
+    for _, child := range c.Components {
+        child.encode(w)
+    }
+    writeLine(w, "END:"+c.Name)
+}
+
+func (p Property) encode() string {
+    var b strings.Builder
+    b.WriteString(p.Name)
+
+    // Sorted so the same component always encodes to the same bytes
+    names := make([]string, 0, len(p.Params))
+    for name := range p.Params {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    for _, name := range names {
+        value := p.Params[name]
+        b.WriteString(";" + name + "=")
+        if strings.ContainsAny(value, ":;,") {
+            b.WriteString(`"` + value + `"`)
+        } else {
+            b.WriteString(value)
+        }
+    }
+    b.WriteString(":" + p.Value)
+    return b.String()
+}
+
+func writeLine(w *bufio.Writer, line string) {
+    // Fold on octet boundaries without splitting UTF-8 sequences. The
+    // leading space of continuation lines counts towards their length.
+    limit := maxLineOctets
+    for len(line) > limit {
+        cut := limit
+        for cut > 0 && line[cut]&0xC0 == 0x80 {
+            cut--
+        }
+        w.WriteString(line[:cut] + "\r\n ")
+        line = line[cut:]
+        limit = maxLineOctets - 1
+    }
+    w.WriteString(line + "\r\n")
+}
+
+// Parse reads a single top level component, usually a VCALENDAR.
+func Parse(r io.Reader) (*Component, error) {
+    lines, err := unfold(r)
+    if err != nil {
+        return nil, err
+    }
+
+    var stack []*Component
+    var root *Component
+    for _, line := range lines {
+        prop, err := parseLine(line)
+        if err != nil {
+            return nil, err
+        }
+
+        switch prop.Name {
+        case "BEGIN":
+            comp := NewComponent(strings.ToUpper(prop.Value))
+            if len(stack) > 0 {
+                stack[len(stack)-1].Add(comp)
+            } else if root == nil {
+                root = comp
+            }
+            stack = append(stack, comp)
+        case "END":
+            if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(prop.Value) {
+                return nil, ErrMalformed
+            }
+            stack = stack[:len(stack)-1]
+        default:
+            if len(stack) == 0 {
+                return nil, ErrMalformed
+            }
+            current := stack[len(stack)-1]
+            current.Props = append(current.Props, prop)
+        }
+    }
+
+    if root == nil || len(stack) != 0 {
+        return nil, ErrMalformed
+    }
+    return root, nil
+}
+
+func unfold(r io.Reader) ([]string, error) {
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+    var lines []string
+    for scanner.Scan() {
+        line := strings.TrimRight(scanner.Text(), "\r")
+        if line == "" {
+            continue
+        }
+        if (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+            lines[len(lines)-1] += line[1:]
+            continue
+        }
+        lines = append(lines, line)
+    }
+    return lines, scanner.Err()
+}
+
+func parseLine(line string) (Property, error) {
+    // The value starts at the first colon outside a quoted parameter
+    inQuotes := false
+    colon := -1
+    for i, r := range line {
+        if r == '"' {
+            inQuotes = !inQuotes
+        } else if r == ':' && !inQuotes {
+            colon = i
+            break
+        }
+    }
+    if colon <= 0 {
+        return Property{}, fmt.Errorf("%w: %q", ErrMalformed, line)
+    }
+
+    prop := Property{Value: line[colon+1:]}
+    parts := splitParams(line[:colon])
+    prop.Name = strings.ToUpper(parts[0])
+    for _, param := range parts[1:] {
+        name, value, _ := strings.Cut(param, "=")
+        if prop.Params == nil {
+            prop.Params = make(map[string]string)
+        }
+        prop.Params[strings.ToUpper(name)] = strings.Trim(value, `"`)
+    }
+    return prop, nil
+}
+
+func splitParams(s string) []string {
+    var parts []string
+    inQuotes := false
+    start := 0
+    for i, r := range s {
+        switch {
+        case r == '"':
+            inQuotes = !inQuotes
+        case r == ';' && !inQuotes:
+            parts = append(parts, s[start:i])
+            start = i + 1
+        }
+    }
+    return append(parts, s[start:])
+}
@@ -0,0 +1,355 @@
+package ical
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Recurrence frequencies TaskFlow supports. Sub-daily rules make no sense
+// for tasks.
+const (
+    FreqDaily   = "DAILY"
+    FreqWeekly  = "WEEKLY"
+    FreqMonthly = "MONTHLY"
+    FreqYearly  = "YEARLY"
+)
+
+// maxRulePeriods bounds the search for the next occurrence, so rules that
+// never match (BYMONTH=2;BYMONTHDAY=30) end.
+const maxRulePeriods = 1000
+
+var weekdayCodes = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// RuleDay is a BYDAY entry: a weekday, and for monthly and yearly rules
+// optionally which one in the month or year (1 the first, -1 the last).
+type RuleDay struct {
+    N   int
+    Day time.Weekday
+}
+
+// RRule is a recurrence rule (RFC 5545 section 3.3.10) limited to the
+// daily, weekly, monthly and yearly frequencies with the INTERVAL, COUNT,
+// UNTIL, BYDAY, BYMONTHDAY and BYMONTH parts. Weeks start on Monday. A
+// zero Until means the rule doesn't end by date.
+type RRule struct {
+    Freq       string
+    Interval   int
+    Count      int
+    Until      time.Time
+    UntilDate  bool
+    ByDay      []RuleDay
+    ByMonthDay []int
+    ByMonth    []time.Month
+}
+
+// ParseRRule reads an RRULE value, with or without the "RRULE:" prefix.
+func ParseRRule(value string) (*RRule, error) {
+    value = strings.TrimSpace(value)
+    if len(value) > 6 && strings.EqualFold(value[:6], "RRULE:") {
+        value = value[6:]
+    }
+    if value == "" {
+        return nil, fmt.Errorf("empty recurrence rule")
+    }
+
+    rule := &RRule{Interval: 1}
+    seen := make(map[string]bool)
+    for _, part := range strings.Split(value, ";") {
+        name, val, ok := strings.Cut(part, "=")
+        name = strings.ToUpper(strings.TrimSpace(name))
+        val = strings.ToUpper(strings.TrimSpace(val))
+        if !ok || val == "" {
+            return nil, fmt.Errorf("invalid recurrence rule part %q", part)
+        }
+        if seen[name] {
+            return nil, fmt.Errorf("%s is repeated", name)
+        }
+        seen[name] = true
+
+        var err error
+        switch name {
+        case "FREQ":
+            switch val {
+            case FreqDaily, FreqWeekly, FreqMonthly, FreqYearly:
+                rule.Freq = val
+            default:
+                err = fmt.Errorf("FREQ must be DAILY, WEEKLY, MONTHLY or YEARLY")
+            }
+        case "INTERVAL":
+            rule.Interval, err = ruleNumber(name, val, 1, 1000)
+        case "COUNT":
+            rule.Count, err = ruleNumber(name, val, 1, 10000)
+        case "UNTIL":
+            rule.Until, rule.UntilDate, err = ParseTime(val, nil)
+            if err != nil {
+                err = fmt.Errorf("invalid UNTIL %q", val)
+            }
+        case "BYDAY":
+            rule.ByDay, err = parseRuleDays(val)
+        case "BYMONTHDAY":
+            for _, v := range strings.Split(val, ",") {
+                var day int
+                if day, err = ruleNumber(name, v, -31, 31); err == nil && day == 0 {
+                    err = fmt.Errorf("BYMONTHDAY can't be 0")
+                }
+                if err != nil {
+                    break
+                }
+                rule.ByMonthDay = append(rule.ByMonthDay, day)
+            }
+        case "BYMONTH":
+            for _, v := range strings.Split(val, ",") {
+                var month int
+                if month, err = ruleNumber(name, v, 1, 12); err != nil {
+                    break
+                }
+                rule.ByMonth = append(rule.ByMonth, time.Month(month))
+            }
+        case "WKST":
+            if val != "MO" {
+                err = fmt.Errorf("only WKST=MO is supported")
+            }
+        default:
+            err = fmt.Errorf("%s is not supported", name)
+        }
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    if rule.Freq == "" {
+        return nil, fmt.Errorf("FREQ is required")
+    }
+    if rule.Count > 0 && !rule.Until.IsZero() {
+        return nil, fmt.Errorf("COUNT and UNTIL can't both be set")
+    }
+    if rule.Freq == FreqWeekly && len(rule.ByMonthDay) > 0 {
+        return nil, fmt.Errorf("BYMONTHDAY can't be used with WEEKLY")
+    }
+    for _, day := range rule.ByDay {
+        if day.N != 0 && rule.Freq != FreqMonthly && rule.Freq != FreqYearly {
+            return nil, fmt.Errorf("numbered BYDAY is only allowed with MONTHLY or YEARLY")
+        }
+    }
+    return rule, nil
+}
+
+func ruleNumber(name, value string, min, max int) (int, error) {
+    n, err := strconv.Atoi(strings.TrimSpace(value))
+    if err != nil || n < min || n > max {
+        return 0, fmt.Errorf("%s must be between %d and %d", name, min, max)
+    }
+    return n, nil
+}
+
+func parseRuleDays(value string) ([]RuleDay, error) {
+    var days []RuleDay
+    for _, v := range strings.Split(value, ",") {
+        v = strings.TrimSpace(v)
+        if len(v) < 2 {
+            return nil, fmt.Errorf("invalid BYDAY %q", v)
+        }
+
+        day := RuleDay{Day: -1}
+        code := v[len(v)-2:]
+        for i, c := range weekdayCodes {
+            if c == code {
+                day.Day = time.Weekday(i)
+            }
+        }
+        if day.Day < 0 {
+            return nil, fmt.Errorf("invalid BYDAY %q", v)
+        }
+        if n := v[:len(v)-2]; n != "" {
+            var err error
+            if day.N, err = ruleNumber("BYDAY", strings.TrimPrefix(n, "+"), -53, 53); err != nil || day.N == 0 {
+                return nil, fmt.Errorf("invalid BYDAY %q", v)
+            }
+        }
+        days = append(days, day)
+    }
+    return days, nil
+}
+
+// String renders the rule as an RRULE value, without the "RRULE:" prefix.
+func (r *RRule) String() string {
+    parts := []string{"FREQ=" + r.Freq}
+    if r.Interval > 1 {
+        parts = append(parts, fmt.Sprintf("INTERVAL=%d", r.Interval))
+    }
+    if r.Count > 0 {
+        parts = append(parts, fmt.Sprintf("COUNT=%d", r.Count))
+    }
+    if !r.Until.IsZero() {
+        if r.UntilDate {
+            parts = append(parts, "UNTIL="+r.Until.Format(dateLayout))
+        } else {
+            parts = append(parts, "UNTIL="+FormatTime(r.Until))
+        }
+    }
+    if len(r.ByMonth) > 0 {
+        months := make([]string, len(r.ByMonth))
+        for i, month := range r.ByMonth {
+            months[i] = strconv.Itoa(int(month))
+        }
+        parts = append(parts, "BYMONTH="+strings.Join(months, ","))
+    }
+    if len(r.ByMonthDay) > 0 {
+        days := make([]string, len(r.ByMonthDay))
+        for i, day := range r.ByMonthDay {
+            days[i] = strconv.Itoa(day)
+        }
+        parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+    }
+    if len(r.ByDay) > 0 {
+        days := make([]string, len(r.ByDay))
+        for i, day := range r.ByDay {
+            days[i] = weekdayCodes[day.Day]
+            if day.N != 0 {
+                days[i] = strconv.Itoa(day.N) + days[i]
+            }
+        }
+        parts = append(parts, "BYDAY="+strings.Join(days, ","))
+    }
+    return strings.Join(parts, ";")
+}
+
+// Next returns the first occurrence of the series starting at dtstart that
+// comes after after, at dtstart's time of day and in its location. COUNT is
+// left to the caller, who knows how many occurrences came before; false
+// means the rule ended by UNTIL or has no further occurrence. Dates a period
+// doesn't have, like the 31st of a 30 day month or February 29 outside leap
+// years, are skipped rather than moved, as RFC 5545 says.
+func (r *RRule) Next(dtstart, after time.Time) (time.Time, bool) {
+    for n := 0; n < maxRulePeriods; n++ {
+        for _, day := range r.periodDays(dtstart, n) {
+            t := time.Date(day.Year(), day.Month(), day.Day(), dtstart.Hour(), dtstart.Minute(), dtstart.Second(), 0, dtstart.Location())
+            if t.Before(dtstart) || !t.After(after) || !r.matches(day, dtstart) {
+                continue
+            }
+            if r.ended(t) {
+                return time.Time{}, false
+            }
+            return t, true
+        }
+    }
+    return time.Time{}, false
+}
+
+// ended reports whether t comes after UNTIL. A date UNTIL includes the
+// whole day.
+func (r *RRule) ended(t time.Time) bool {
+    if r.Until.IsZero() {
+        return false
+    }
+    if r.UntilDate {
+        return t.Format(dateLayout) > r.Until.Format(dateLayout)
+    }
+    return t.After(r.Until)
+}
+
+// periodDays lists the days of the n-th period of the rule after the one
+// holding dtstart. They are dtstart's calendar days labelled UTC, so the
+// arithmetic doesn't meet DST changes; Next puts them back in dtstart's
+// location.
+func (r *RRule) periodDays(dtstart time.Time, n int) []time.Time {
+    start := time.Date(dtstart.Year(), dtstart.Month(), dtstart.Day(), 0, 0, 0, 0, time.UTC)
+    step := n * r.Interval
+
+    var first, end time.Time
+    switch r.Freq {
+    case FreqDaily:
+        first = start.AddDate(0, 0, step)
+        end = first.AddDate(0, 0, 1)
+    case FreqWeekly:
+        monday := start.AddDate(0, 0, -(int(start.Weekday())+6)%7)
+        first = monday.AddDate(0, 0, 7*step)
+        end = first.AddDate(0, 0, 7)
+    case FreqMonthly:
+        first = time.Date(start.Year(), start.Month()+time.Month(step), 1, 0, 0, 0, 0, time.UTC)
+        end = first.AddDate(0, 1, 0)
+    default:
+        first = time.Date(start.Year()+step, time.January, 1, 0, 0, 0, 0, time.UTC)
+        end = first.AddDate(1, 0, 0)
+    }
+
+    var days []time.Time
+    for day := first; day.Before(end); day = day.AddDate(0, 0, 1) {
+        days = append(days, day)
+    }
+    return days
+}
+
+// matches reports whether day is one of the rule's days. Parts left out
+// default to dtstart's: its weekday for weekly rules, its day of the month
+// for monthly ones and its date for yearly ones.
+func (r *RRule) matches(day, dtstart time.Time) bool {
+    if len(r.ByMonth) > 0 && !containsMonth(r.ByMonth, day.Month()) {
+        return false
+    }
+    if len(r.ByMonthDay) > 0 && !r.matchesMonthDay(day) {
+        return false
+    }
+    if len(r.ByDay) > 0 && !r.matchesDay(day) {
+        return false
+    }
+
+    explicitDays := len(r.ByDay) > 0 || len(r.ByMonthDay) > 0
+    switch r.Freq {
+    case FreqWeekly:
+        return explicitDays || day.Weekday() == dtstart.Weekday()
+    case FreqMonthly:
+        return explicitDays || day.Day() == dtstart.Day()
+    case FreqYearly:
+        if explicitDays {
+            return true
+        }
+        if len(r.ByMonth) == 0 && day.Month() != dtstart.Month() {
+            return false
+        }
+        return day.Day() == dtstart.Day()
+    }
+    return true
+}
+
+func (r *RRule) matchesMonthDay(day time.Time) bool {
+    last := daysIn(day.Year(), day.Month())
+    for _, d := range r.ByMonthDay {
+        if d == day.Day() || d < 0 && last+d+1 == day.Day() {
+            return true
+        }
+    }
+    return false
+}
+
+// matchesDay checks BYDAY. Numbered days count within the month, or within
+// the year for yearly rules without BYMONTH.
+func (r *RRule) matchesDay(day time.Time) bool {
+    index, fromEnd := (day.Day()-1)/7+1, -((daysIn(day.Year(), day.Month())-day.Day())/7 + 1)
+    if r.Freq == FreqYearly && len(r.ByMonth) == 0 {
+        daysInYear := time.Date(day.Year(), time.December, 31, 0, 0, 0, 0, time.UTC).YearDay()
+        index, fromEnd = (day.YearDay()-1)/7+1, -((daysInYear-day.YearDay())/7 + 1)
+    }
+
+    for _, d := range r.ByDay {
+        if d.Day == day.Weekday() && (d.N == 0 || d.N == index || d.N == fromEnd) {
+            return true
+        }
+    }
+    return false
+}
+
+func daysIn(year int, month time.Month) int {
+    return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func containsMonth(months []time.Month, month time.Month) bool {
+    for _, m := range months {
+        if m == month {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,174 @@
+package ical
+
+import (
+    "strings"
+    "testing"
+    "time"
+    _ "time/tzdata"
+)
+
+func TestParseRRule(t *testing.T) {
+    for _, tc := range []struct {
+        value string
+        want  string
+    }{
+        {"FREQ=DAILY", "FREQ=DAILY"},
+        {"RRULE:freq=weekly;byday=mo,we", "FREQ=WEEKLY;BYDAY=MO,WE"},
+        {"FREQ=WEEKLY;INTERVAL=1;WKST=MO", "FREQ=WEEKLY"},
+        {"FREQ=MONTHLY;BYMONTHDAY=-1", "FREQ=MONTHLY;BYMONTHDAY=-1"},
+        {"FREQ=MONTHLY;BYDAY=2TU,-1FR", "FREQ=MONTHLY;BYDAY=2TU,-1FR"},
+        {"FREQ=MONTHLY;BYDAY=+1MO", "FREQ=MONTHLY;BYDAY=1MO"},
+        {"FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29", "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29"},
+        {"FREQ=DAILY;UNTIL=20261021", "FREQ=DAILY;UNTIL=20261021"},
+        {"FREQ=DAILY;UNTIL=20261021T080000Z", "FREQ=DAILY;UNTIL=20261021T080000Z"},
+        {"FREQ=WEEKLY;INTERVAL=2;COUNT=10", "FREQ=WEEKLY;INTERVAL=2;COUNT=10"},
+    } {
+        rule, err := ParseRRule(tc.value)
+        if err != nil {
+            t.Errorf("%s: %v", tc.value, err)
+            continue
+        }
+        if got := rule.String(); got != tc.want {
+            t.Errorf("%s: got %s, want %s", tc.value, got, tc.want)
+        }
+    }
+}
+
+func TestParseRRuleRefusesInvalidRules(t *testing.T) {
+    for _, tc := range []struct {
+        value string
+        want  string
+    }{
+        {"", "empty"},
+        {"INTERVAL=2", "FREQ is required"},
+        {"FREQ=HOURLY", "FREQ must be"},
+        {"FREQ=DAILY;FREQ=WEEKLY", "repeated"},
+        {"FREQ=DAILY;INTERVAL=0", "INTERVAL must be"},
+        {"FREQ=DAILY;COUNT=2;UNTIL=20261021", "COUNT and UNTIL"},
+        {"FREQ=DAILY;UNTIL=tomorrow", "invalid UNTIL"},
+        {"FREQ=WEEKLY;BYMONTHDAY=1", "can't be used with WEEKLY"},
+        {"FREQ=WEEKLY;BYDAY=2MO", "numbered BYDAY"},
+        {"FREQ=MONTHLY;BYDAY=0MO", "invalid BYDAY"},
+        {"FREQ=MONTHLY;BYDAY=XX", "invalid BYDAY"},
+        {"FREQ=MONTHLY;BYMONTHDAY=0", "can't be 0"},
+        {"FREQ=MONTHLY;BYMONTHDAY=32", "BYMONTHDAY must be"},
+        {"FREQ=YEARLY;BYMONTH=13", "BYMONTH must be"},
+        {"FREQ=DAILY;WKST=SU", "WKST"},
+        {"FREQ=DAILY;BYHOUR=9", "not supported"},
+        {"FREQ=DAILY;COUNT", "invalid recurrence rule part"},
+    } {
+        if _, err := ParseRRule(tc.value); err == nil || !strings.Contains(err.Error(), tc.want) {
+            t.Errorf("%q: got %v, want %q", tc.value, err, tc.want)
+        }
+    }
+}
+
+// occurrences lists up to n occurrences of rule from dtstart, dtstart
+// included when it matches.
+func occurrences(t *testing.T, rule string, dtstart time.Time, n int) string {
+    t.Helper()
+
+    parsed, err := ParseRRule(rule)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var got []string
+    after := dtstart.Add(-time.Second)
+    for len(got) < n {
+        next, ok := parsed.Next(dtstart, after)
+        if !ok {
+            got = append(got, "end")
+            break
+        }
+        got = append(got, next.Format("2006-01-02 15:04 -0700"))
+        after = next
+    }
+    return strings.Join(got, ", ")
+}
+
+func TestRRuleNext(t *testing.T) {
+    berlin, err := time.LoadLocation("Europe/Berlin")
+    if err != nil {
+        t.Fatal(err)
+    }
+    at := func(year int, month time.Month, day int) time.Time {
+        return time.Date(year, month, day, 9, 0, 0, 0, time.UTC)
+    }
+
+    for _, tc := range []struct {
+        name    string
+        rule    string
+        dtstart time.Time
+        want    string
+    }{
+        {
+            "weekly on two days", "FREQ=WEEKLY;BYDAY=MO,WE", at(2026, 10, 19),
+            "2026-10-19 09:00 +0000, 2026-10-21 09:00 +0000, 2026-10-26 09:00 +0000, 2026-10-28 09:00 +0000",
+        },
+        {
+            "weekly from a day not in BYDAY", "FREQ=WEEKLY;BYDAY=MO", at(2026, 10, 21),
+            "2026-10-26 09:00 +0000, 2026-11-02 09:00 +0000",
+        },
+        {
+            "last day of the month", "FREQ=MONTHLY;BYMONTHDAY=-1", at(2026, 1, 31),
+            "2026-01-31 09:00 +0000, 2026-02-28 09:00 +0000, 2026-03-31 09:00 +0000, 2026-04-30 09:00 +0000",
+        },
+        {
+            "second Tuesday", "FREQ=MONTHLY;BYDAY=2TU", at(2026, 1, 13),
+            "2026-01-13 09:00 +0000, 2026-02-10 09:00 +0000, 2026-03-10 09:00 +0000",
+        },
+        {
+            "last Friday", "FREQ=MONTHLY;BYDAY=-1FR", at(2026, 1, 30),
+            "2026-01-30 09:00 +0000, 2026-02-27 09:00 +0000, 2026-03-27 09:00 +0000, 2026-04-24 09:00 +0000",
+        },
+        {
+            // RFC 5545 drops dates that don't exist rather than moving them
+            "the 31st skips shorter months", "FREQ=MONTHLY", at(2026, 1, 31),
+            "2026-01-31 09:00 +0000, 2026-03-31 09:00 +0000, 2026-05-31 09:00 +0000, 2026-07-31 09:00 +0000",
+        },
+        {
+            "February 29 skips to the next leap year", "FREQ=YEARLY", at(2024, 2, 29),
+            "2024-02-29 09:00 +0000, 2028-02-29 09:00 +0000, 2032-02-29 09:00 +0000",
+        },
+        {
+            "UNTIL as a date includes the day", "FREQ=DAILY;UNTIL=20261021", at(2026, 10, 19),
+            "2026-10-19 09:00 +0000, 2026-10-20 09:00 +0000, 2026-10-21 09:00 +0000, end",
+        },
+        {
+            "UNTIL as a date-time", "FREQ=DAILY;UNTIL=20261021T080000Z", at(2026, 10, 19),
+            "2026-10-19 09:00 +0000, 2026-10-20 09:00 +0000, end",
+        },
+        {
+            "every other week", "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH", at(2026, 10, 20),
+            "2026-10-20 09:00 +0000, 2026-10-22 09:00 +0000, 2026-11-03 09:00 +0000, 2026-11-05 09:00 +0000",
+        },
+        {
+            "every quarter", "FREQ=MONTHLY;INTERVAL=3", at(2026, 1, 15),
+            "2026-01-15 09:00 +0000, 2026-04-15 09:00 +0000, 2026-07-15 09:00 +0000",
+        },
+        {
+            "every other day", "FREQ=DAILY;INTERVAL=2", at(2026, 12, 30),
+            "2026-12-30 09:00 +0000, 2027-01-01 09:00 +0000, 2027-01-03 09:00 +0000",
+        },
+        {
+            // The time of day stays 9:00 in Berlin when summer time ends
+            "across a DST change", "FREQ=DAILY", time.Date(2026, 10, 24, 9, 0, 0, 0, berlin),
+            "2026-10-24 09:00 +0200, 2026-10-25 09:00 +0100, 2026-10-26 09:00 +0100",
+        },
+        {
+            // Days are the ones of dtstart's location, not of UTC
+            "weekday in dtstart's location", "FREQ=WEEKLY;BYDAY=MO", time.Date(2026, 3, 23, 0, 30, 0, 0, berlin),
+            "2026-03-23 00:30 +0100, 2026-03-30 00:30 +0200",
+        },
+        {
+            "no date matches", "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30", at(2026, 1, 1),
+            "end",
+        },
+    } {
+        n := strings.Count(tc.want, ", ") + 1
+        if got := occurrences(t, tc.rule, tc.dtstart, n); got != tc.want {
+            t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+        }
+    }
+}
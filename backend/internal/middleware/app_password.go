@@ -0,0 +1,48 @@
+package middleware
+
+import (
+    "net/http"
+    "time"
+    "taskflow/internal/auth"
+    "taskflow/internal/models"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+)
+
+// AppPasswordAuth authenticates HTTP Basic requests with the user's email
+// and one of their app passwords, for clients that can't send a JWT.
+func AppPasswordAuth(db *gorm.DB) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        email, password, ok := c.Request.BasicAuth()
+        if !ok || email == "" || password == "" {
+            basicAuthChallenge(c)
+            return
+        }
+
+        var user models.User
+        if err := db.Where("email = ?", email).First(&user).Error; err != nil {
+            basicAuthChallenge(c)
+            return
+        }
+
+        var appPassword models.AppPassword
+        err := db.Where("user_id = ? AND password_hash = ?", user.ID, auth.HashSecretToken(password)).
+            First(&appPassword).Error
+        if err != nil {
+            basicAuthChallenge(c)
+            return
+        }
+
+        // Best effort, only shown to the user
+        db.Model(&appPassword).UpdateColumn("last_used_at", time.Now())
+
+        c.Set("user_id", user.ID)
+        c.Next()
+    }
+}
+
+func basicAuthChallenge(c *gin.Context) {
+    c.Header("WWW-Authenticate", `Basic realm="TaskFlow", charset="UTF-8"`)
+    c.AbortWithStatus(http.StatusUnauthorized)
+}
@@ -32,6 +32,7 @@ func AuthMiddleware() gin.HandlerFunc {
         }
 
         c.Set("user_id", claims.UserID)
+        c.Set("workspace_id", claims.WorkspaceID)
         c.Next()
     }
 }
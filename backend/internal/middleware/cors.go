@@ -1,15 +1,21 @@
 package middleware
 
-import "github.com/gin-gonic/gin"
+import (
+    "strings"
+
+    "github.com/gin-gonic/gin"
+)
 
 func CORS() gin.HandlerFunc {
     return func(c *gin.Context) {
         c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
         c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-        c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-        c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+        c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, If-Match, If-None-Match, accept, origin, Cache-Control, X-Requested-With, "+WorkspaceHeader)
+        c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
+        c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Next-Cursor, Link, ETag")
 
-        if c.Request.Method == "OPTIONS" {
+        // CalDAV clients use OPTIONS to discover DAV support, not CORS
+        if c.Request.Method == "OPTIONS" && !strings.HasPrefix(c.Request.URL.Path, "/dav/") {
             c.AbortWithStatus(204)
             return
         }
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+    "net/http"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+)
+
+// DeprecatedUserParam guards legacy routes that take the user ID in the
+// path. The ID must match the authenticated user; handlers always act on
+// the user from the JWT. Must run after AuthMiddleware.
+func DeprecatedUserParam(param string) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        c.Header("Deprecation", "true")
+
+        userID, err := strconv.ParseUint(c.Param(param), 10, 64)
+        if err != nil || uint(userID) != c.GetUint("user_id") {
+            c.JSON(http.StatusForbidden, gin.H{"error": "Cannot access another user's data"})
+            c.Abort()
+            return
+        }
+
+        c.Next()
+    }
+}
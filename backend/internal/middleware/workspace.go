@@ -0,0 +1,57 @@
+package middleware
+
+import (
+    "errors"
+    "net/http"
+    "strconv"
+    "taskflow/internal/services"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+)
+
+// WorkspaceHeader picks the workspace a request works in, overriding the
+// one in the token. "personal" picks the user's own tasks.
+const WorkspaceHeader = "X-Workspace-ID"
+
+// Workspace resolves the workspace a request works in, from the
+// X-Workspace-ID header or else the token, and checks the user is a member.
+// Non-members get 404 like for any workspace they can't see. It sets access
+// to the user's services.Access there. Must run after AuthMiddleware.
+func Workspace(db *gorm.DB) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        workspaceID := c.GetUint("workspace_id")
+        if header := c.GetHeader(WorkspaceHeader); header != "" {
+            workspaceID = 0
+            if header != "personal" {
+                id, err := strconv.ParseUint(header, 10, 64)
+                if err != nil {
+                    c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + WorkspaceHeader + " header"})
+                    c.Abort()
+                    return
+                }
+                workspaceID = uint(id)
+            }
+        }
+
+        if workspaceID == 0 {
+            c.Set("access", services.PersonalAccess(c.GetUint("user_id")))
+            c.Next()
+            return
+        }
+
+        access, err := services.WorkspaceAccess(db, c.GetUint("user_id"), workspaceID)
+        if err != nil {
+            if errors.Is(err, services.ErrNotMember) {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+            } else {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check workspace"})
+            }
+            c.Abort()
+            return
+        }
+
+        c.Set("access", access)
+        c.Next()
+    }
+}
@@ -1,34 +1,416 @@
 package models
 
 import (
+    "database/sql/driver"
+    "encoding/json"
+    "errors"
     "time"
     "gorm.io/gorm"
 )
 
 type User struct {
-    ID           uint           `json:"id" gorm:"primaryKey"`
-    Name         string         `json:"name" gorm:"not null"`
-    Email        string         `json:"email" gorm:"uniqueIndex;not null"`
-    Password     string         `json:"-" gorm:"not null"`
-    GoogleToken  string         `json:"-" gorm:"type:text"`
-    CalendarSync bool           `json:"calendar_sync" gorm:"default:false"`
-    Tasks        []Task         `json:"tasks,omitempty"`
-    CreatedAt    time.Time      `json:"created_at"`
-    UpdatedAt    time.Time      `json:"updated_at"`
-    DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+    ID                  uint                `json:"id" gorm:"primaryKey"`
+    Name                string              `json:"name" gorm:"not null"`
+    Email               string              `json:"email" gorm:"uniqueIndex;not null"`
+    Password            string              `json:"-" gorm:"not null"`
+    Timezone            string              `json:"timezone" gorm:"size:64;default:America/Sao_Paulo"`
+    CalendarPreferences CalendarPreferences `json:"calendar_preferences" gorm:"embedded;embeddedPrefix:calendar_"`
+    Tasks               []Task              `json:"tasks,omitempty"`
+    CreatedAt           time.Time           `json:"created_at"`
+    UpdatedAt           time.Time           `json:"updated_at"`
+    DeletedAt           gorm.DeletedAt      `json:"-" gorm:"index"`
 }
 
+// CalendarPreferences controls how tasks are rendered as calendar events.
+type CalendarPreferences struct {
+    // CalendarID is the target calendar, "primary" for the account's main one
+    CalendarID string `json:"calendar_id" gorm:"size:255;default:primary"`
+    // DefaultDuration is the event length in minutes for timed due dates
+    DefaultDuration int `json:"default_duration" gorm:"default:60"`
+    // Reminders overrides the event reminders; nil keeps TaskFlow's defaults
+    // and an empty list disables reminders
+    Reminders *EventReminders `json:"reminders" gorm:"type:text"`
+    // AllDayEvents renders date-only due dates as all-day events
+    AllDayEvents bool `json:"all_day_events" gorm:"default:true"`
+}
+
+type EventReminder struct {
+    Method  string `json:"method"`
+    Minutes int64  `json:"minutes"`
+}
+
+// EventReminders is stored as a JSON column.
+type EventReminders []EventReminder
+
+func (r EventReminders) Value() (driver.Value, error) {
+    data, err := json.Marshal(r)
+    if err != nil {
+        return nil, err
+    }
+    return string(data), nil
+}
+
+func (r *EventReminders) Scan(value interface{}) error {
+    switch v := value.(type) {
+    case nil:
+        *r = nil
+        return nil
+    case string:
+        return json.Unmarshal([]byte(v), r)
+    case []byte:
+        return json.Unmarshal(v, r)
+    default:
+        return errors.New("unsupported type for EventReminders")
+    }
+}
+
+// Task is a user's to-do. Version is incremented on every change and backs
+// the task's ETag. A task with a ParentID is a subtask; when
+// CompleteWithSubtasks is set, the task is completed once all its subtasks
+// are. Progress, BlockedBy, Labels and Watchers are only filled in for API
+// responses.
+//
+// A task with a Recurrence (an RRULE) repeats: completing it creates the
+// next occurrence, due on the rule's next date counted from the due date or
+// from the completion, as RecurFrom says. Later occurrences point to the
+// first one through SeriesID and are numbered by Occurrence.
+//
+// Position orders a task within its status column on the board, see
+// services.PositionBetween.
+//
+// A task with a WorkspaceID is shared with the workspace's members, UserID
+// is then just who created it, and AssigneeID who works on it. Other tasks
+// are their user's own.
 type Task struct {
-    ID            uint           `json:"id" gorm:"primaryKey"`
-    Title         string         `json:"title" gorm:"not null"`
-    Description   string         `json:"description"`
-    Status        string         `json:"status" gorm:"default:pending"`
-    Priority      string         `json:"priority" gorm:"default:medium"`
-    DueDate       *time.Time     `json:"due_date"`
-    UserID        uint           `json:"user_id" gorm:"not null;index"`
-    User          User           `json:"-" gorm:"foreignKey:UserID"`
-    GoogleEventID string         `json:"google_event_id" gorm:"size:255"`
-    CreatedAt     time.Time      `json:"created_at"`
-    UpdatedAt     time.Time      `json:"updated_at"`
-    DeletedAt     gorm.DeletedAt `json:"-" gorm:"index"`
+    ID                   uint           `json:"id" gorm:"primaryKey"`
+    Title                string         `json:"title" gorm:"not null"`
+    Description          string         `json:"description"`
+    Status               string         `json:"status" gorm:"default:pending"`
+    Position             string         `json:"position" gorm:"size:64;not null;default:'';index"`
+    Priority             string         `json:"priority" gorm:"default:medium"`
+    DueDate              *time.Time     `json:"due_date"`
+    DueDateAllDay        bool           `json:"due_date_all_day" gorm:"default:false"`
+    ParentID             *uint          `json:"parent_id" gorm:"index"`
+    ProjectID            *uint          `json:"project_id" gorm:"index"`
+    WorkspaceID          *uint          `json:"workspace_id" gorm:"index"`
+    AssigneeID           *uint          `json:"assignee_id" gorm:"index"`
+    CompleteWithSubtasks bool           `json:"complete_with_subtasks" gorm:"default:false"`
+    Recurrence           string         `json:"recurrence" gorm:"size:512"`
+    RecurFrom            string         `json:"recur_from" gorm:"size:20;default:due"`
+    SeriesID             *uint          `json:"series_id" gorm:"index"`
+    Occurrence           int            `json:"occurrence" gorm:"not null;default:1"`
+    Progress             *TaskProgress  `json:"progress,omitempty" gorm:"-"`
+    BlockedBy            []TaskRef      `json:"blocked_by,omitempty" gorm:"-"`
+    Labels               []LabelRef     `json:"labels,omitempty" gorm:"-"`
+    Watchers             []UserRef      `json:"watchers,omitempty" gorm:"-"`
+    UserID               uint           `json:"user_id" gorm:"not null;index"`
+    User                 User           `json:"-" gorm:"foreignKey:UserID"`
+    Version              uint           `json:"version" gorm:"not null;default:1"`
+    CreatedAt            time.Time      `json:"created_at"`
+    UpdatedAt            time.Time      `json:"updated_at"`
+    DeletedAt            gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// Project groups a user's tasks; subtasks are in their parent's project.
+// The tasks of an archived project are left out of task listings unless
+// asked for.
+type Project struct {
+    ID          uint           `json:"id" gorm:"primaryKey"`
+    UserID      uint           `json:"user_id" gorm:"not null;index"`
+    WorkspaceID *uint          `json:"workspace_id" gorm:"index"`
+    Name        string         `json:"name" gorm:"size:255;not null"`
+    Description string         `json:"description" gorm:"type:text"`
+    Color       string         `json:"color" gorm:"size:7;not null"`
+    Archived    bool           `json:"archived" gorm:"not null;default:false"`
+    CreatedAt   time.Time      `json:"created_at"`
+    UpdatedAt   time.Time      `json:"updated_at"`
+    DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// TaskProgress rolls up the direct subtasks and checklist items of a task.
+// Percent counts both alike.
+type TaskProgress struct {
+    Subtasks          int `json:"subtasks"`
+    SubtasksCompleted int `json:"subtasks_completed"`
+    Checklist         int `json:"checklist"`
+    ChecklistDone     int `json:"checklist_done"`
+    Percent           int `json:"percent"`
+}
+
+// TaskRef is a short reference to another task in a response.
+type TaskRef struct {
+    ID     uint   `json:"id"`
+    Title  string `json:"title"`
+    Status string `json:"status"`
+}
+
+// UserRef is a short reference to a user in a response.
+type UserRef struct {
+    ID   uint   `json:"id"`
+    Name string `json:"name"`
+}
+
+// TaskWatcher subscribes a user to a task. Assignees watch their tasks.
+type TaskWatcher struct {
+    TaskID    uint      `json:"task_id" gorm:"primaryKey"`
+    UserID    uint      `json:"user_id" gorm:"primaryKey;index"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// AssignmentChange records a task changing assignee, from FromUserID to
+// ToUserID, either nil for nobody, so the users involved can be notified.
+// NotifiedAt is set once they have been.
+type AssignmentChange struct {
+    ID          uint       `json:"id" gorm:"primaryKey"`
+    TaskID      uint       `json:"task_id" gorm:"not null;index"`
+    FromUserID  *uint      `json:"from_user_id"`
+    ToUserID    *uint      `json:"to_user_id" gorm:"index"`
+    ChangedByID uint       `json:"changed_by_id" gorm:"not null"`
+    NotifiedAt  *time.Time `json:"notified_at" gorm:"index"`
+    CreatedAt   time.Time  `json:"created_at"`
+}
+
+// TaskDependency records that the blocker task has to be completed before
+// work on the blocked task can start.
+type TaskDependency struct {
+    ID        uint      `json:"id" gorm:"primaryKey"`
+    BlockerID uint      `json:"blocker_id" gorm:"not null;uniqueIndex:idx_task_dependencies_pair;index"`
+    BlockedID uint      `json:"blocked_id" gorm:"not null;uniqueIndex:idx_task_dependencies_pair;index"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// Label is a user defined tag, attached to tasks through TaskLabel. Names
+// are unique per user, or per workspace for a workspace's labels,
+// regardless of case; Color is a #rrggbb hex colour.
+type Label struct {
+    ID          uint      `json:"id" gorm:"primaryKey"`
+    UserID      uint      `json:"user_id" gorm:"not null;index"`
+    WorkspaceID *uint     `json:"workspace_id" gorm:"index"`
+    Name        string    `json:"name" gorm:"size:64;not null"`
+    Color       string    `json:"color" gorm:"size:7;not null"`
+    CreatedAt   time.Time `json:"created_at"`
+    UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TaskLabel attaches a label to a task.
+type TaskLabel struct {
+    TaskID    uint      `json:"task_id" gorm:"primaryKey"`
+    LabelID   uint      `json:"label_id" gorm:"primaryKey;index"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// LabelRef is a label as shown on the tasks it is attached to.
+type LabelRef struct {
+    ID    uint   `json:"id"`
+    Name  string `json:"name"`
+    Color string `json:"color"`
+}
+
+// ChecklistItem is a step of a task too small to be a subtask. Items are
+// listed by Position.
+type ChecklistItem struct {
+    ID        uint      `json:"id" gorm:"primaryKey"`
+    TaskID    uint      `json:"task_id" gorm:"not null;index"`
+    Title     string    `json:"title" gorm:"not null"`
+    Done      bool      `json:"done" gorm:"default:false"`
+    Position  int       `json:"position" gorm:"not null;default:0"`
+    CreatedAt time.Time `json:"created_at"`
+    UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Workspace shares its tasks, projects and labels among its members. What
+// a member may do depends on their role; a workspace has one owner.
+type Workspace struct {
+    ID        uint           `json:"id" gorm:"primaryKey"`
+    Name      string         `json:"name" gorm:"size:255;not null"`
+    CreatedAt time.Time      `json:"created_at"`
+    UpdatedAt time.Time      `json:"updated_at"`
+    DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// WorkspaceMember gives a user a role in a workspace.
+type WorkspaceMember struct {
+    WorkspaceID uint      `json:"workspace_id" gorm:"primaryKey"`
+    UserID      uint      `json:"user_id" gorm:"primaryKey;index"`
+    Role        string    `json:"role" gorm:"size:20;not null"`
+    CreatedAt   time.Time `json:"created_at"`
+    UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Workspace roles, from most to least allowed.
+const (
+    RoleOwner  = "owner"
+    RoleAdmin  = "admin"
+    RoleMember = "member"
+    RoleViewer = "viewer"
+)
+
+var WorkspaceRoles = []string{RoleOwner, RoleAdmin, RoleMember, RoleViewer}
+
+// Task statuses and priorities, the only values Task.Status and
+// Task.Priority may hold.
+const (
+    StatusPending    = "pending"
+    StatusInProgress = "in_progress"
+    StatusCompleted  = "completed"
+
+    PriorityLow    = "low"
+    PriorityMedium = "medium"
+    PriorityHigh   = "high"
+)
+
+// Where the next occurrence of a recurring task is counted from.
+const (
+    RecurFromDue        = "due"
+    RecurFromCompletion = "completion"
+)
+
+var (
+    TaskStatuses   = []string{StatusPending, StatusInProgress, StatusCompleted}
+    TaskPriorities = []string{PriorityLow, PriorityMedium, PriorityHigh}
+)
+
+func ValidTaskStatus(status string) bool {
+    return containsString(TaskStatuses, status)
+}
+
+func ValidTaskPriority(priority string) bool {
+    return containsString(TaskPriorities, priority)
+}
+
+func containsString(values []string, value string) bool {
+    for _, v := range values {
+        if v == value {
+            return true
+        }
+    }
+    return false
+}
+
+// SyncJob is an outbox entry asking the sync worker to reconcile a task
+// with the owner's calendar. It is written in the same transaction as the
+// task change so no update is lost if the process dies.
+type SyncJob struct {
+    ID        uint       `json:"id" gorm:"primaryKey"`
+    TaskID    uint       `json:"task_id" gorm:"not null;index"`
+    UserID    uint       `json:"user_id" gorm:"not null;index"`
+    Status    string     `json:"status" gorm:"size:20;default:pending;index:idx_sync_jobs_status_next_run"`
+    Attempts  int        `json:"attempts" gorm:"default:0"`
+    NextRunAt time.Time  `json:"next_run_at" gorm:"index:idx_sync_jobs_status_next_run"`
+    LockedAt  *time.Time `json:"locked_at"`
+    LastError string     `json:"last_error" gorm:"type:text"`
+    CreatedAt time.Time  `json:"created_at"`
+    UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// OAuthState tracks issued OAuth states so each one can be used only once.
+type OAuthState struct {
+    Nonce     string    `gorm:"primaryKey;size:64"`
+    UserID    uint      `gorm:"not null;index"`
+    Provider  string    `gorm:"size:32;not null;default:google"`
+    ExpiresAt time.Time `gorm:"not null;index"`
+    CreatedAt time.Time
+}
+
+// CalendarConnection links a user to an external calendar account. Each
+// user has at most one connection per provider. SyncToken continues the
+// provider's incremental listing of SyncCalendarID, the calendar it was
+// issued for; the Channel fields describe an active push channel.
+type CalendarConnection struct {
+    ID                uint       `json:"id" gorm:"primaryKey"`
+    UserID            uint       `json:"user_id" gorm:"not null;uniqueIndex:idx_calendar_connections_user_provider"`
+    Provider          string     `json:"provider" gorm:"size:20;not null;uniqueIndex:idx_calendar_connections_user_provider"`
+    Credentials       string     `json:"-" gorm:"type:text"`
+    CalendarID        string     `json:"calendar_id" gorm:"size:1024"`
+    SyncEnabled       bool       `json:"sync_enabled" gorm:"default:true"`
+    DisabledReason    string     `json:"disabled_reason,omitempty"`
+    DisabledAt        *time.Time `json:"disabled_at,omitempty"`
+    SyncToken         string     `json:"-" gorm:"type:text"`
+    SyncCalendarID    string     `json:"-" gorm:"size:1024"`
+    NextPullAt        *time.Time `json:"-" gorm:"index"`
+    LastPulledAt      *time.Time `json:"last_pulled_at,omitempty"`
+    ChannelID         string     `json:"-" gorm:"size:64;index"`
+    ChannelToken      string     `json:"-" gorm:"size:64"`
+    ChannelResourceID string     `json:"-" gorm:"size:255"`
+    ChannelExpiresAt  *time.Time `json:"-"`
+    CreatedAt         time.Time  `json:"created_at"`
+    UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// TaskEventMapping records the event a task was rendered to on one
+// calendar connection. SyncedAt is when the task and the event last
+// matched.
+type TaskEventMapping struct {
+    ID              uint       `json:"id" gorm:"primaryKey"`
+    TaskID          uint       `json:"task_id" gorm:"not null;uniqueIndex:idx_task_event_mappings_task_connection"`
+    ConnectionID    uint       `json:"connection_id" gorm:"not null;uniqueIndex:idx_task_event_mappings_task_connection;index"`
+    ExternalEventID string     `json:"external_event_id" gorm:"size:1024;not null"`
+    CalendarID      string     `json:"calendar_id" gorm:"size:1024"`
+    ETag            string     `json:"etag" gorm:"column:etag;size:255"`
+    SyncedAt        *time.Time `json:"synced_at,omitempty"`
+    CreatedAt       time.Time  `json:"created_at"`
+    UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// StringList is stored as a JSON column.
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+    data, err := json.Marshal(l)
+    if err != nil {
+        return nil, err
+    }
+    return string(data), nil
+}
+
+func (l *StringList) Scan(value interface{}) error {
+    switch v := value.(type) {
+    case nil:
+        *l = nil
+        return nil
+    case string:
+        return json.Unmarshal([]byte(v), l)
+    case []byte:
+        return json.Unmarshal(v, l)
+    default:
+        return errors.New("unsupported type for StringList")
+    }
+}
+
+// CalendarFeed is a read-only iCalendar subscription to a user's tasks.
+// Only a hash of the secret token in the feed URL is stored. Empty
+// Statuses or Priorities include every value.
+type CalendarFeed struct {
+    ID         uint       `json:"id" gorm:"primaryKey"`
+    UserID     uint       `json:"user_id" gorm:"not null;index"`
+    Name       string     `json:"name" gorm:"size:255"`
+    TokenHash  string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+    ItemType   string     `json:"item_type" gorm:"size:10;default:event"`
+    Statuses   StringList `json:"statuses" gorm:"type:text"`
+    Priorities StringList `json:"priorities" gorm:"type:text"`
+    CreatedAt  time.Time  `json:"created_at"`
+    UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// AppPassword lets CalDAV clients, which only speak HTTP Basic, sign in
+// without the account password. Only a hash of the password is stored.
+type AppPassword struct {
+    ID           uint       `json:"id" gorm:"primaryKey"`
+    UserID       uint       `json:"user_id" gorm:"not null;index"`
+    Name         string     `json:"name" gorm:"size:255"`
+    PasswordHash string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+    LastUsedAt   *time.Time `json:"last_used_at"`
+    CreatedAt    time.Time  `json:"created_at"`
+}
+
+// CalDAVObject remembers the resource name and UID a CalDAV client chose
+// for a task it created, so the client finds the task where it put it.
+// Tasks without one are served as task-<id>.ics.
+type CalDAVObject struct {
+    ID        uint   `gorm:"primaryKey"`
+    UserID    uint   `gorm:"not null;uniqueIndex:idx_caldav_objects_user_name"`
+    TaskID    uint   `gorm:"not null;uniqueIndex"`
+    Name      string `gorm:"size:255;not null;uniqueIndex:idx_caldav_objects_user_name"`
+    UID       string `gorm:"size:255;not null"`
+    CreatedAt time.Time
 }
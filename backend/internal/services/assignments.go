@@ -0,0 +1,134 @@
+package services
+
+import (
+    "errors"
+    "taskflow/internal/models"
+
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+)
+
+var ErrAssigneeNotAllowed = errors.New("tasks can only be assigned to members of their workspace who can edit them")
+
+// ValidateAssignee checks that a user may be assigned a task: a member of
+// its workspace allowed to edit tasks, or for a personal task its owner.
+func ValidateAssignee(db *gorm.DB, task *models.Task, userID uint) error {
+    allowed, err := CanEditTask(db, userID, task)
+    if err != nil {
+        return err
+    }
+    if !allowed {
+        return ErrAssigneeNotAllowed
+    }
+    return nil
+}
+
+// AssignTask hands a task to a user, or to nobody when assigneeID is nil,
+// and records the change made by changedBy. The new assignee starts
+// watching the task and its events move to their calendars. Like SaveTask,
+// it fails with ErrTaskVersionConflict if the task changed since it was
+// read.
+func AssignTask(tx *gorm.DB, task *models.Task, assigneeID *uint, changedBy uint) error {
+    if sameID(task.AssigneeID, assigneeID) {
+        return nil
+    }
+
+    from := task.AssigneeID
+    task.AssigneeID = assigneeID
+    if err := SaveTask(tx, task); err != nil {
+        task.AssigneeID = from
+        return err
+    }
+    if err := EnqueueTaskSync(tx, task); err != nil {
+        return err
+    }
+
+    if assigneeID != nil {
+        if err := WatchTask(tx, task, *assigneeID); err != nil {
+            return err
+        }
+    }
+    return tx.Create(&models.AssignmentChange{
+        TaskID:      task.ID,
+        FromUserID:  from,
+        ToUserID:    assigneeID,
+        ChangedByID: changedBy,
+    }).Error
+}
+
+// WatchTask subscribes a user to a task. Watching it again does nothing.
+func WatchTask(db *gorm.DB, task *models.Task, userID uint) error {
+    watcher := models.TaskWatcher{TaskID: task.ID, UserID: userID}
+    return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&watcher).Error
+}
+
+// UnwatchTask unsubscribes a user from a task.
+func UnwatchTask(db *gorm.DB, task *models.Task, userID uint) error {
+    return db.Where("task_id = ? AND user_id = ?", task.ID, userID).Delete(&models.TaskWatcher{}).Error
+}
+
+// unassignMember unassigns the tasks of a workspace from a user leaving it,
+// stops them watching any and takes the tasks off their calendars.
+func unassignMember(tx *gorm.DB, workspaceID, userID, changedBy uint) error {
+    var tasks []models.Task
+    if err := tx.Where("workspace_id = ? AND assignee_id = ?", workspaceID, userID).Find(&tasks).Error; err != nil {
+        return err
+    }
+    for i := range tasks {
+        if err := AssignTask(tx, &tasks[i], nil, changedBy); err != nil {
+            return err
+        }
+    }
+
+    connections := tx.Model(&models.CalendarConnection{}).Select("id").Where("user_id = ?", userID)
+    var synced []models.Task
+    err := tx.Where("workspace_id = ? AND id IN (?)", workspaceID, tx.Model(&models.TaskEventMapping{}).Select("task_id").Where("connection_id IN (?)", connections)).
+        Find(&synced).Error
+    if err != nil {
+        return err
+    }
+    for i := range synced {
+        if err := EnqueueTaskSync(tx, &synced[i]); err != nil {
+            return err
+        }
+    }
+
+    workspaceTasks := tx.Model(&models.Task{}).Select("id").Where("workspace_id = ?", workspaceID)
+    return tx.Where("user_id = ? AND task_id IN (?)", userID, workspaceTasks).Delete(&models.TaskWatcher{}).Error
+}
+
+// LoadTaskWatchers fills in the Watchers of tasks, sorted by name.
+func LoadTaskWatchers(db *gorm.DB, tasks []models.Task) error {
+    if len(tasks) == 0 {
+        return nil
+    }
+
+    ids := make([]uint, len(tasks))
+    for i := range tasks {
+        ids[i] = tasks[i].ID
+    }
+
+    var rows []struct {
+        TaskID uint
+        ID     uint
+        Name   string
+    }
+    err := db.Table("task_watchers").
+        Select("task_watchers.task_id, users.id, users.name").
+        Joins("JOIN users ON users.id = task_watchers.user_id").
+        Where("task_watchers.task_id IN ?", ids).
+        Order("users.name, users.id").
+        Scan(&rows).Error
+    if err != nil {
+        return err
+    }
+
+    watchers := make(map[uint][]models.UserRef)
+    for _, row := range rows {
+        watchers[row.TaskID] = append(watchers[row.TaskID], models.UserRef{ID: row.ID, Name: row.Name})
+    }
+    for i := range tasks {
+        tasks[i].Watchers = watchers[tasks[i].ID]
+    }
+    return nil
+}
@@ -0,0 +1,322 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+    "taskflow/internal/models"
+
+    "gorm.io/gorm"
+)
+
+// A task's Position orders it within its status column on the board. It is
+// a fractional index: base 36 digits read as the fraction 0.d1d2d3..., so
+// positions compare like the fractions and a task can always be put between
+// two others without renumbering the column. Positions never end in '0',
+// which keeps every fraction to a single spelling.
+const (
+    positionDigits = "0123456789abcdefghijklmnopqrstuvwxyz"
+    // maxPositionLength is how long positions may grow from repeated moves
+    // to the same spot before their column is rebalanced.
+    maxPositionLength = 16
+    rebalanceInterval = time.Hour
+)
+
+var (
+    ErrNeighbourNotFound = errors.New("task to move next to not found in the column")
+    ErrNeighbourOrder    = errors.New("tasks to move between are out of order")
+)
+
+var (
+    // errPositionsCrowded means there is no usable position between two
+    // tasks until their column is rebalanced.
+    errPositionsCrowded = errors.New("no room between positions")
+    // errInvalidPositions means positions aren't base 36 fractions in
+    // order, which rebalancing their column also mends.
+    errInvalidPositions = errors.New("invalid positions")
+)
+
+// PositionBetween returns a position sorting after before and ahead of
+// after, which must be valid positions in that order. An empty before is
+// the top of the column, an empty after its bottom.
+func PositionBetween(before, after string) (string, error) {
+    if !validPosition(before) || !validPosition(after) || (after != "" && before >= after) {
+        return "", fmt.Errorf("%w: %q and %q", errInvalidPositions, before, after)
+    }
+
+    base := len(positionDigits)
+    var position []byte
+    bounded := after != ""
+    for i := 0; ; i++ {
+        low := 0
+        if i < len(before) {
+            low = strings.IndexByte(positionDigits, before[i])
+        }
+        high := base
+        if bounded {
+            high = 0
+            if i < len(after) {
+                high = strings.IndexByte(positionDigits, after[i])
+            }
+        }
+
+        switch {
+        case high-low > 1:
+            return string(append(position, positionDigits[(low+high)/2])), nil
+        case high-low == 1:
+            // Anything longer starting with low's digit is below after
+            bounded = false
+        }
+        position = append(position, positionDigits[low])
+    }
+}
+
+// validPosition reports whether position is spelled with base 36 digits
+// and doesn't end in '0'. With both, comparing positions as strings
+// compares their fractions.
+func validPosition(position string) bool {
+    for i := 0; i < len(position); i++ {
+        if strings.IndexByte(positionDigits, position[i]) < 0 {
+            return false
+        }
+    }
+    return !strings.HasSuffix(position, "0")
+}
+
+// AppendPosition is the position at the bottom of a status column of a
+// space's board.
+func AppendPosition(tx *gorm.DB, space Space, status string) (string, error) {
+    last, err := lastPosition(tx, space, status)
+    if err != nil {
+        return "", err
+    }
+    position, err := PositionBetween(last, "")
+    if err == nil && len(position) <= maxPositionLength {
+        return position, nil
+    }
+
+    if err := RebalancePositions(tx, space, status); err != nil {
+        return "", err
+    }
+    if last, err = lastPosition(tx, space, status); err != nil {
+        return "", err
+    }
+    return PositionBetween(last, "")
+}
+
+// MovePosition is the position of task moved to a status column, right
+// after the task afterID and before the task beforeID. With only one of
+// them the task goes next to it; with neither, to the bottom of the column.
+// The column is rebalanced first when the neighbours leave no room.
+func MovePosition(tx *gorm.DB, task *models.Task, status string, afterID, beforeID *uint) (string, error) {
+    position, err := movePosition(tx, task, status, afterID, beforeID)
+    if !errors.Is(err, errPositionsCrowded) {
+        return position, err
+    }
+
+    if err := RebalancePositions(tx, TaskSpace(task), status); err != nil {
+        return "", err
+    }
+    position, err = movePosition(tx, task, status, afterID, beforeID)
+    if errors.Is(err, errPositionsCrowded) {
+        return "", ErrNeighbourOrder
+    }
+    return position, err
+}
+
+func movePosition(tx *gorm.DB, task *models.Task, status string, afterID, beforeID *uint) (string, error) {
+    column := TaskSpace(task).Scope(tx.Model(&models.Task{})).
+        Where("status = ? AND id <> ?", status, task.ID).
+        Session(&gorm.Session{})
+
+    var after, before *models.Task
+    var err error
+    if afterID != nil {
+        if after, err = neighbour(column, *afterID); err != nil {
+            return "", err
+        }
+    }
+    if beforeID != nil {
+        if before, err = neighbour(column, *beforeID); err != nil {
+            return "", err
+        }
+    }
+
+    switch {
+    case after == nil && before == nil:
+        var last models.Task
+        err = column.Select("id", "position").Order("position DESC, id DESC").Take(&last).Error
+        if err == nil {
+            after = &last
+        }
+    case before == nil:
+        var next models.Task
+        err = column.Select("id", "position").
+            Where("position > ?", after.Position).
+            Order("position, id").
+            Take(&next).Error
+        if err == nil {
+            before = &next
+        }
+    case after == nil:
+        var previous models.Task
+        err = column.Select("id", "position").
+            Where("position < ?", before.Position).
+            Order("position DESC, id DESC").
+            Take(&previous).Error
+        if err == nil {
+            after = &previous
+        }
+    }
+    if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+        return "", err
+    }
+
+    var low, high string
+    if after != nil {
+        low = after.Position
+    }
+    if before != nil {
+        high = before.Position
+    }
+    if (after != nil && low == "") || (before != nil && high == "") {
+        return "", errPositionsCrowded
+    }
+    if high != "" && low >= high {
+        if low > high {
+            return "", ErrNeighbourOrder
+        }
+        return "", errPositionsCrowded
+    }
+
+    position, err := PositionBetween(low, high)
+    if errors.Is(err, errInvalidPositions) || len(position) > maxPositionLength {
+        return "", errPositionsCrowded
+    }
+    return position, err
+}
+
+func neighbour(column *gorm.DB, id uint) (*models.Task, error) {
+    var task models.Task
+    err := column.Select("id", "position").Where("id = ?", id).Take(&task).Error
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, ErrNeighbourNotFound
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &task, nil
+}
+
+func lastPosition(tx *gorm.DB, space Space, status string) (string, error) {
+    var positions []string
+    err := space.Scope(tx.Model(&models.Task{})).
+        Where("status = ?", status).
+        Order("position DESC").
+        Limit(1).
+        Pluck("position", &positions).Error
+    if err != nil || len(positions) == 0 {
+        return "", err
+    }
+    return positions[0], nil
+}
+
+// RebalancePositions spaces the positions of a status column evenly again,
+// keeping its order. Tasks without a position go to the bottom, oldest
+// first. Positions are board layout, not task content, so versions are
+// left alone.
+func RebalancePositions(tx *gorm.DB, space Space, status string) error {
+    var tasks []models.Task
+    err := space.Scope(tx.Select("id", "position")).
+        Where("status = ?", status).
+        Order("position = '', position, created_at, id").
+        Find(&tasks).Error
+    if err != nil {
+        return err
+    }
+
+    positions := spacedPositions(len(tasks))
+    for i := range tasks {
+        if tasks[i].Position == positions[i] {
+            continue
+        }
+        err := tx.Model(&tasks[i]).UpdateColumn("position", positions[i]).Error
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// spacedPositions returns n increasing positions spread over the whole
+// range, with room for a few inserts between any two of them.
+func spacedPositions(n int) []string {
+    base := len(positionDigits)
+    width, span := 1, base
+    for span < (n+1)*base {
+        width++
+        span *= base
+    }
+    step := span / (n + 1)
+
+    positions := make([]string, n)
+    digits := make([]byte, width)
+    for i := range positions {
+        value := (i + 1) * step
+        for d := width - 1; d >= 0; d-- {
+            digits[d] = positionDigits[value%base]
+            value /= base
+        }
+        positions[i] = strings.TrimRight(string(digits), "0")
+    }
+    return positions
+}
+
+// StartRebalancer rebalances the board columns that have tasks without a
+// position or positions grown too long, once now and then periodically,
+// until ctx is cancelled.
+func StartRebalancer(ctx context.Context, db *gorm.DB) {
+    go func() {
+        rebalanceColumns(db)
+
+        ticker := time.NewTicker(rebalanceInterval)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+                rebalanceColumns(db)
+            }
+        }
+    }()
+}
+
+func rebalanceColumns(db *gorm.DB) {
+    // The tasks of a workspace share its columns whoever created them
+    var columns []struct {
+        UserID      uint
+        WorkspaceID *uint
+        Status      string
+    }
+    err := db.Model(&models.Task{}).
+        Distinct("CASE WHEN workspace_id IS NULL THEN user_id ELSE 0 END AS user_id", "workspace_id", "status").
+        Where("position = '' OR LENGTH(position) > ?", maxPositionLength).
+        Scan(&columns).Error
+    if err != nil {
+        log.Printf("rebalancer: failed to find columns: %v", err)
+        return
+    }
+
+    for _, column := range columns {
+        err := db.Transaction(func(tx *gorm.DB) error {
+            return RebalancePositions(tx, Space{UserID: column.UserID, WorkspaceID: column.WorkspaceID}, column.Status)
+        })
+        if err != nil {
+            log.Printf("rebalancer: failed to rebalance %s tasks of user %d, workspace %v: %v", column.Status, column.UserID, column.WorkspaceID, err)
+        }
+    }
+}
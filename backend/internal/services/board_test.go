@@ -0,0 +1,213 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+    "testing"
+    "taskflow/internal/models"
+)
+
+// checkBetween fails the test unless position is a valid position strictly
+// between before and after.
+func checkBetween(t *testing.T, position, before, after string) {
+    t.Helper()
+
+    if position == "" || !validPosition(position) {
+        t.Fatalf("between %q and %q: got invalid position %q", before, after, position)
+    }
+    if position <= before || (after != "" && position >= after) {
+        t.Fatalf("got %q, want it between %q and %q", position, before, after)
+    }
+}
+
+func TestPositionBetween(t *testing.T) {
+    for _, tc := range []struct {
+        before, after, want string
+    }{
+        {"", "", "i"},
+        {"", "i", "9"},
+        {"", "1", "0i"},
+        {"", "01", "00i"},
+        {"i", "", "r"},
+        {"z", "", "zi"},
+        {"zz", "", "zzi"},
+        {"a", "b", "ai"},
+        {"a", "c", "b"},
+        {"a", "a1", "a0i"},
+        {"az", "b", "azi"},
+        {"a1", "a2", "a1i"},
+        {"abc", "b", "an"},
+    } {
+        got, err := PositionBetween(tc.before, tc.after)
+        if err != nil {
+            t.Errorf("%q, %q: %v", tc.before, tc.after, err)
+            continue
+        }
+        if got != tc.want {
+            t.Errorf("%q, %q: got %q, want %q", tc.before, tc.after, got, tc.want)
+        }
+        checkBetween(t, got, tc.before, tc.after)
+    }
+}
+
+func TestPositionBetweenRefusesInvalidPositions(t *testing.T) {
+    for _, tc := range []struct {
+        before, after string
+    }{
+        {"a", "a"},
+        {"b", "a"},
+        {"a1", "a"},
+        {"1", "10"},
+        {"a0", ""},
+        {"", "0"},
+        {"A", ""},
+        {"", "a-b"},
+    } {
+        if got, err := PositionBetween(tc.before, tc.after); !errors.Is(err, errInvalidPositions) {
+            t.Errorf("%q, %q: got %q, %v, want errInvalidPositions", tc.before, tc.after, got, err)
+        }
+    }
+}
+
+func TestPositionBetweenRepeatedInserts(t *testing.T) {
+    for _, tc := range []struct {
+        name          string
+        before, after string
+        next          func(before, after, position string) (string, string)
+    }{
+        {
+            "at the top", "", "i",
+            func(before, _, position string) (string, string) { return before, position },
+        },
+        {
+            "at the bottom", "i", "",
+            func(_, after, position string) (string, string) { return position, after },
+        },
+        {
+            "right after a task", "a", "b",
+            func(before, _, position string) (string, string) { return before, position },
+        },
+        {
+            "right before a task", "a", "b",
+            func(_, after, position string) (string, string) { return position, after },
+        },
+    } {
+        before, after := tc.before, tc.after
+        inserts := 0
+        for {
+            position, err := PositionBetween(before, after)
+            if err != nil {
+                t.Fatalf("%s: %v", tc.name, err)
+            }
+            checkBetween(t, position, before, after)
+            if len(position) > maxPositionLength {
+                break
+            }
+            inserts++
+            before, after = tc.next(before, after, position)
+        }
+
+        // Every digit halves the room, so a spot takes a few inserts per
+        // digit before the column needs rebalancing
+        if inserts < 3*maxPositionLength {
+            t.Errorf("%s: only %d inserts before positions grow past %d digits", tc.name, inserts, maxPositionLength)
+        }
+    }
+}
+
+func TestSpacedPositions(t *testing.T) {
+    for _, n := range []int{0, 1, 2, 34, 35, 36, 100, 1295, 1296, 5000} {
+        positions := spacedPositions(n)
+        if len(positions) != n {
+            t.Fatalf("%d: got %d positions", n, len(positions))
+        }
+
+        width := 0
+        for _, position := range positions {
+            if len(position) > width {
+                width = len(position)
+            }
+        }
+
+        previous := ""
+        for i, position := range positions {
+            if position == "" || !validPosition(position) {
+                t.Fatalf("%d: got invalid position %q at %d", n, position, i)
+            }
+            if position <= previous {
+                t.Fatalf("%d: got %q after %q at %d", n, position, previous, i)
+            }
+
+            // There is room for an insert without growing much
+            next, err := PositionBetween(previous, position)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if len(next) > width+1 {
+                t.Errorf("%d: inserting between %q and %q takes %q", n, previous, position, next)
+            }
+            previous = position
+        }
+    }
+}
+
+func TestMovePositionRebalancesCrowdedColumn(t *testing.T) {
+    db := newSubtaskTest(t)
+    crowded := "a" + strings.Repeat("0", maxPositionLength-2) + "1"
+    first := createTask(t, db, models.Task{Title: "First", Position: "a"})
+    second := createTask(t, db, models.Task{Title: "Second", Position: crowded})
+    createTask(t, db, models.Task{Title: "Third", Position: "b"})
+    moved := createTask(t, db, models.Task{Title: "Moved", Position: "c"})
+
+    if _, err := movePosition(db, moved, models.StatusPending, &first.ID, &second.ID); !errors.Is(err, errPositionsCrowded) {
+        t.Fatalf("got %v, want errPositionsCrowded", err)
+    }
+
+    position, err := MovePosition(db, moved, models.StatusPending, &first.ID, &second.ID)
+    if err != nil {
+        t.Fatal(err)
+    }
+    moved.Position = position
+    if err := db.Model(moved).UpdateColumn("position", position).Error; err != nil {
+        t.Fatal(err)
+    }
+
+    var tasks []models.Task
+    if err := db.Order("position").Find(&tasks).Error; err != nil {
+        t.Fatal(err)
+    }
+    var order []string
+    for _, task := range tasks {
+        if len(task.Position) > 2 {
+            t.Errorf("%s: got position %q, want a rebalanced one", task.Title, task.Position)
+        }
+        order = append(order, task.Title)
+    }
+    if got := fmt.Sprint(order); got != "[First Moved Second Third]" {
+        t.Errorf("got order %s", got)
+    }
+}
+
+func TestMovePositionRefusesNeighboursOutOfOrder(t *testing.T) {
+    db := newSubtaskTest(t)
+    first := createTask(t, db, models.Task{Title: "First", Position: "a"})
+    second := createTask(t, db, models.Task{Title: "Second", Position: "b"})
+    moved := createTask(t, db, models.Task{Title: "Moved", Position: "c"})
+    other := createTask(t, db, models.Task{Title: "Done", Status: models.StatusCompleted, Position: "i"})
+
+    for _, tc := range []struct {
+        name              string
+        afterID, beforeID *uint
+        want              error
+    }{
+        {"swapped", &second.ID, &first.ID, ErrNeighbourOrder},
+        {"other column", &other.ID, nil, ErrNeighbourNotFound},
+        {"after only", &first.ID, nil, nil},
+        {"before only", nil, &first.ID, nil},
+    } {
+        if _, err := MovePosition(db, moved, models.StatusPending, tc.afterID, tc.beforeID); !errors.Is(err, tc.want) {
+            t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+        }
+    }
+}
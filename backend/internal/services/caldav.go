@@ -0,0 +1,665 @@
+package services
+
+import (
+    "bytes"
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "encoding/xml"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "net/url"
+    "os"
+    "path"
+    "strings"
+    "time"
+    "taskflow/internal/ical"
+    "taskflow/internal/models"
+)
+
+// CalDAVProvider writes events to a CalDAV calendar collection (Nextcloud,
+// Radicale, iCloud, ...). The connection's CalendarID is the collection URL
+// and external event IDs are the resource paths inside it.
+type CalDAVProvider struct {
+    client *http.Client
+}
+
+var (
+    ErrCalDAVInsecureURL = errors.New("CalDAV server URL must use https")
+    ErrCalDAVHostBlocked = errors.New("CalDAV server address is not allowed")
+)
+
+// caldavAllowedHosts are the hosts, from CALDAV_ALLOWED_HOSTS, that may be
+// reached over plain http or on private addresses, such as a self-hosted
+// server on the internal network.
+var caldavAllowedHosts = parseHostList(os.Getenv("CALDAV_ALLOWED_HOSTS"))
+
+func NewCalDAVProvider() *CalDAVProvider {
+    transport := http.DefaultTransport.(*http.Transport).Clone()
+    // A proxy would dial on our behalf, past the address checks
+    transport.Proxy = nil
+    transport.DialContext = dialPublic(&net.Dialer{Timeout: calendarRequestTimeout})
+
+    return &CalDAVProvider{
+        client: &http.Client{Timeout: calendarRequestTimeout, Transport: transport},
+    }
+}
+
+func parseHostList(value string) map[string]bool {
+    hosts := make(map[string]bool)
+    for _, host := range strings.Split(value, ",") {
+        if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+            hosts[host] = true
+        }
+    }
+    return hosts
+}
+
+// checkCalDAVURL only lets user supplied server URLs use https, unless
+// their host is allowed.
+func checkCalDAVURL(raw string) error {
+    u, err := url.Parse(raw)
+    if err != nil {
+        return fmt.Errorf("invalid CalDAV server URL %q", raw)
+    }
+    if u.Scheme != "https" && !(u.Scheme == "http" && caldavAllowedHosts[strings.ToLower(u.Hostname())]) {
+        return ErrCalDAVInsecureURL
+    }
+    if u.Host == "" {
+        return fmt.Errorf("invalid CalDAV server URL %q", raw)
+    }
+    return nil
+}
+
+// dialPublic resolves the host itself and refuses loopback, private,
+// link-local and other internal addresses, so user supplied server URLs,
+// the hrefs they return and their redirects can't reach the server's own
+// network. The checked address is the one dialed.
+func dialPublic(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+    return func(ctx context.Context, network, addr string) (net.Conn, error) {
+        host, port, err := net.SplitHostPort(addr)
+        if err != nil {
+            return nil, err
+        }
+        if caldavAllowedHosts[strings.ToLower(host)] {
+            return dialer.DialContext(ctx, network, addr)
+        }
+
+        ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+        if err != nil {
+            return nil, err
+        }
+        for _, ip := range ips {
+            if !publicIP(ip.IP) {
+                return nil, ErrCalDAVHostBlocked
+            }
+        }
+        return dialer.DialContext(ctx, network, net.JoinHostPort(ips[0].IP.String(), port))
+    }
+}
+
+func publicIP(ip net.IP) bool {
+    return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+        ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+        ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+type caldavCredentials struct {
+    ServerURL string `json:"server_url"`
+    Username  string `json:"username"`
+    Password  string `json:"password"`
+}
+
+func (p *CalDAVProvider) Name() string {
+    return ProviderCalDAV
+}
+
+// AuthURL is empty, CalDAV connects with server credentials.
+func (p *CalDAVProvider) AuthURL(state string) string {
+    return ""
+}
+
+// Connect checks the credentials against the server and, when no calendar
+// was given, picks the first collection that accepts events.
+func (p *CalDAVProvider) Connect(ctx context.Context, params ConnectParams) (string, string, error) {
+    if params.ServerURL == "" || params.Username == "" || params.Password == "" {
+        return "", "", errors.New("server URL, username and password are required")
+    }
+    if err := checkCalDAVURL(params.ServerURL); err != nil {
+        return "", "", err
+    }
+
+    creds := &caldavCredentials{
+        ServerURL: params.ServerURL,
+        Username:  params.Username,
+        Password:  params.Password,
+    }
+
+    calendarID := params.CalendarID
+    if calendarID == "" {
+        discovered, err := p.discoverCalendar(ctx, creds)
+        if err != nil {
+            return "", "", err
+        }
+        calendarID = discovered
+    } else if _, err := p.propfind(ctx, creds, calendarID, "0", `<d:prop><d:resourcetype/></d:prop>`); err != nil {
+        return "", "", err
+    }
+
+    data, err := json.Marshal(creds)
+    if err != nil {
+        return "", "", err
+    }
+    return string(data), calendarID, nil
+}
+
+func (p *CalDAVProvider) credentials(conn *models.CalendarConnection) (*caldavCredentials, error) {
+    data, err := DecryptCredentials(conn)
+    if err != nil {
+        return nil, fmt.Errorf("unable to decrypt credentials: %w", err)
+    }
+
+    creds := &caldavCredentials{}
+    if err := json.Unmarshal([]byte(data), creds); err != nil {
+        return nil, err
+    }
+    return creds, nil
+}
+
+// CreateEvent PUTs a new resource named after the event UID. With
+// If-None-Match a retried create finds the resource and updates it instead.
+func (p *CalDAVProvider) CreateEvent(ctx context.Context, conn *models.CalendarConnection, opts EventOptions, event *CalendarEvent) (*CalendarEvent, error) {
+    creds, err := p.credentials(conn)
+    if err != nil {
+        return nil, err
+    }
+
+    uid := event.ID
+    if uid == "" {
+        uid = randomUID()
+    }
+
+    collection, err := p.resolve(creds, event.CalendarID)
+    if err != nil {
+        return nil, err
+    }
+    href := strings.TrimSuffix(collection.Path, "/") + "/" + url.PathEscape(uid) + ".ics"
+
+    resp, err := p.put(ctx, creds, href, uid, opts, event, map[string]string{"If-None-Match": "*"})
+    if err != nil {
+        return nil, err
+    }
+    if resp.StatusCode == http.StatusPreconditionFailed {
+        updated := *event
+        updated.ID = href
+        return p.UpdateEvent(ctx, conn, opts, &updated)
+    }
+    if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("unable to create event: %s", resp.Status)
+    }
+
+    result := *event
+    result.ID = href
+    result.ETag = resp.Header.Get("ETag")
+    return &result, nil
+}
+
+func (p *CalDAVProvider) UpdateEvent(ctx context.Context, conn *models.CalendarConnection, opts EventOptions, event *CalendarEvent) (*CalendarEvent, error) {
+    creds, err := p.credentials(conn)
+    if err != nil {
+        return nil, err
+    }
+
+    // The UID of a resource can't change, ours are named after it
+    uid, _ := url.PathUnescape(strings.TrimSuffix(path.Base(event.ID), ".ics"))
+
+    resp, err := p.put(ctx, creds, event.ID, uid, opts, event, nil)
+    if err != nil {
+        return nil, err
+    }
+    if resp.StatusCode == http.StatusNotFound {
+        return nil, ErrEventNotFound
+    }
+    if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("unable to update event: %s", resp.Status)
+    }
+
+    result := *event
+    result.ETag = resp.Header.Get("ETag")
+    return &result, nil
+}
+
+func (p *CalDAVProvider) DeleteEvent(ctx context.Context, conn *models.CalendarConnection, calendarID, eventID string) error {
+    creds, err := p.credentials(conn)
+    if err != nil {
+        return err
+    }
+
+    resp, err := p.do(ctx, creds, http.MethodDelete, eventID, nil, nil)
+    if err != nil {
+        return err
+    }
+    resp.Body.Close()
+
+    // Already gone on the server, nothing left to do
+    if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+        return nil
+    }
+    if resp.StatusCode >= 300 {
+        return fmt.Errorf("unable to delete event: %s", resp.Status)
+    }
+    return nil
+}
+
+// ListChanges uses the WebDAV sync-collection report (RFC 6578), which
+// returns changed resources with their data and removed ones as 404s.
+func (p *CalDAVProvider) ListChanges(ctx context.Context, conn *models.CalendarConnection, calendarID, syncToken string) (*EventChanges, error) {
+    creds, err := p.credentials(conn)
+    if err != nil {
+        return nil, err
+    }
+
+    body := `<?xml version="1.0" encoding="utf-8"?>` +
+        `<d:sync-collection xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">` +
+        `<d:sync-token>` + xmlEscape(syncToken) + `</d:sync-token>` +
+        `<d:sync-level>1</d:sync-level>` +
+        `<d:prop><d:getetag/><c:calendar-data/></d:prop>` +
+        `</d:sync-collection>`
+
+    resp, err := p.do(ctx, creds, "REPORT", calendarID, strings.NewReader(body), map[string]string{
+        "Content-Type": "application/xml; charset=utf-8",
+        "Depth":        "1",
+    })
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    // Servers answer an invalidated token with a valid-sync-token error
+    if syncToken != "" && (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusConflict) {
+        return nil, ErrSyncTokenExpired
+    }
+    if resp.StatusCode != http.StatusMultiStatus {
+        return nil, fmt.Errorf("unable to list changes: %s", resp.Status)
+    }
+
+    var ms davMultistatus
+    if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+        return nil, fmt.Errorf("unable to parse changes: %w", err)
+    }
+
+    return &EventChanges{
+        Events:        multistatusEvents(&ms, calendarID),
+        NextSyncToken: ms.SyncToken,
+    }, nil
+}
+
+func (p *CalDAVProvider) GetEvent(ctx context.Context, conn *models.CalendarConnection, calendarID, eventID string) (*CalendarEvent, error) {
+    creds, err := p.credentials(conn)
+    if err != nil {
+        return nil, err
+    }
+
+    resp, err := p.do(ctx, creds, http.MethodGet, eventID, nil, nil)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+        return nil, ErrEventNotFound
+    }
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("unable to get event: %s", resp.Status)
+    }
+
+    data, err := io.ReadAll(resp.Body)
+    if err != nil {
+        return nil, err
+    }
+    event, ok := parseCalDAVEvent(string(data))
+    if !ok {
+        return nil, ErrEventNotFound
+    }
+    event.ID = hrefPath(eventID)
+    event.CalendarID = calendarID
+    event.ETag = resp.Header.Get("ETag")
+    return &event, nil
+}
+
+// ListEvents runs a calendar-query report with a time-range filter
+// (RFC 4791 section 7.8).
+func (p *CalDAVProvider) ListEvents(ctx context.Context, conn *models.CalendarConnection, calendarID string, start, end time.Time) ([]CalendarEvent, error) {
+    creds, err := p.credentials(conn)
+    if err != nil {
+        return nil, err
+    }
+
+    body := `<?xml version="1.0" encoding="utf-8"?>` +
+        `<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">` +
+        `<d:prop><d:getetag/><c:calendar-data/></d:prop>` +
+        `<c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VEVENT">` +
+        `<c:time-range start="` + ical.FormatTime(start) + `" end="` + ical.FormatTime(end) + `"/>` +
+        `</c:comp-filter></c:comp-filter></c:filter>` +
+        `</c:calendar-query>`
+
+    resp, err := p.do(ctx, creds, "REPORT", calendarID, strings.NewReader(body), map[string]string{
+        "Content-Type": "application/xml; charset=utf-8",
+        "Depth":        "1",
+    })
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusMultiStatus {
+        return nil, fmt.Errorf("unable to list events: %s", resp.Status)
+    }
+
+    var ms davMultistatus
+    if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+        return nil, fmt.Errorf("unable to parse events: %w", err)
+    }
+
+    return multistatusEvents(&ms, calendarID), nil
+}
+
+// multistatusEvents reads the events of a REPORT response. Resources
+// reported as 404 are returned as deleted events.
+func multistatusEvents(ms *davMultistatus, calendarID string) []CalendarEvent {
+    var events []CalendarEvent
+    for _, r := range ms.Responses {
+        href := hrefPath(r.Href)
+        if strings.Contains(r.Status, " 404 ") {
+            events = append(events, CalendarEvent{ID: href, CalendarID: calendarID, Deleted: true})
+            continue
+        }
+
+        for _, ps := range r.Propstats {
+            if !strings.Contains(ps.Status, " 200 ") || ps.Prop.CalendarData == "" {
+                continue
+            }
+            event, ok := parseCalDAVEvent(ps.Prop.CalendarData)
+            if !ok {
+                continue
+            }
+            event.ID = href
+            event.CalendarID = calendarID
+            event.ETag = ps.Prop.ETag
+            events = append(events, event)
+        }
+    }
+    return events
+}
+
+func (p *CalDAVProvider) put(ctx context.Context, creds *caldavCredentials, href, uid string, opts EventOptions, event *CalendarEvent, headers map[string]string) (*http.Response, error) {
+    if headers == nil {
+        headers = map[string]string{}
+    }
+    headers["Content-Type"] = "text/calendar; charset=utf-8"
+
+    resp, err := p.do(ctx, creds, http.MethodPut, href, strings.NewReader(renderCalDAVEvent(uid, opts, event)), headers)
+    if err != nil {
+        return nil, err
+    }
+    resp.Body.Close()
+    return resp, nil
+}
+
+func renderCalDAVEvent(uid string, opts EventOptions, event *CalendarEvent) string {
+    vevent := ical.NewComponent("VEVENT")
+    vevent.Set("UID", uid)
+    vevent.Set("DTSTAMP", ical.FormatTime(time.Now()))
+    setEventTimes(vevent, opts, event)
+    vevent.SetText("SUMMARY", event.Title)
+    if event.Description != "" {
+        vevent.SetText("DESCRIPTION", event.Description)
+    }
+
+    for _, reminder := range eventReminders(opts) {
+        alarm := ical.NewComponent("VALARM")
+        alarm.Set("ACTION", "DISPLAY")
+        alarm.SetText("DESCRIPTION", event.Title)
+        alarm.Set("TRIGGER", fmt.Sprintf("-PT%dM", reminder.Minutes))
+        vevent.Add(alarm)
+    }
+
+    cal := ical.NewCalendar()
+    cal.Add(vevent)
+    return cal.String()
+}
+
+// setEventTimes sets the DTSTART, DTEND and RRULE of a VEVENT. Repeating
+// timed events are written in the user's time zone, so the rule's weekdays
+// aren't taken as UTC ones.
+func setEventTimes(vevent *ical.Component, opts EventOptions, event *CalendarEvent) {
+    vevent.SetTime("DTSTART", event.Start, event.AllDay)
+    vevent.SetTime("DTEND", event.End, event.AllDay)
+    if len(event.Recurrence) == 0 {
+        return
+    }
+
+    if loc, err := time.LoadLocation(opts.TimeZone); !event.AllDay && err == nil {
+        vevent.SetLocalTime("DTSTART", event.Start.In(loc))
+        vevent.SetLocalTime("DTEND", event.End.In(loc))
+    }
+    for _, rule := range event.Recurrence {
+        vevent.Set("RRULE", strings.TrimPrefix(rule, "RRULE:"))
+    }
+}
+
+func parseCalDAVEvent(data string) (CalendarEvent, bool) {
+    cal, err := ical.Parse(strings.NewReader(data))
+    if err != nil {
+        return CalendarEvent{}, false
+    }
+
+    vevents := cal.Children("VEVENT")
+    if len(vevents) == 0 {
+        return CalendarEvent{}, false
+    }
+
+    // Recurrence overrides share the UID, the master comes first
+    vevent := vevents[0]
+    event := CalendarEvent{
+        Title:       vevent.Text("SUMMARY"),
+        Description: vevent.Text("DESCRIPTION"),
+    }
+    event.Start, event.AllDay, _, _ = vevent.Time("DTSTART")
+    event.End, _, _, _ = vevent.Time("DTEND")
+    event.Updated, _, _, _ = vevent.Time("LAST-MODIFIED")
+    return event, true
+}
+
+// discoverCalendar follows current-user-principal and calendar-home-set
+// (RFC 6764/4791) to the first calendar that supports VEVENT.
+func (p *CalDAVProvider) discoverCalendar(ctx context.Context, creds *caldavCredentials) (string, error) {
+    ms, err := p.propfind(ctx, creds, creds.ServerURL, "0", `<d:prop><d:current-user-principal/></d:prop>`)
+    if err != nil {
+        return "", err
+    }
+    principal := ms.firstProp(func(prop davProp) string { return prop.CurrentUserPrincipal.Href })
+    if principal == "" {
+        principal = creds.ServerURL
+    }
+
+    ms, err = p.propfind(ctx, creds, principal, "0", `<d:prop><c:calendar-home-set/></d:prop>`)
+    if err != nil {
+        return "", err
+    }
+    home := ms.firstProp(func(prop davProp) string { return prop.CalendarHomeSet.Href })
+    if home == "" {
+        return "", errors.New("no calendar home found on the CalDAV server")
+    }
+
+    ms, err = p.propfind(ctx, creds, home, "1", `<d:prop><d:resourcetype/><c:supported-calendar-component-set/></d:prop>`)
+    if err != nil {
+        return "", err
+    }
+    for _, r := range ms.Responses {
+        for _, ps := range r.Propstats {
+            if ps.Prop.ResourceType.Calendar != nil && ps.Prop.SupportedComponents.supports("VEVENT") {
+                return p.absoluteURL(creds, r.Href)
+            }
+        }
+    }
+
+    return "", errors.New("no calendar supporting events found on the CalDAV server")
+}
+
+func (p *CalDAVProvider) propfind(ctx context.Context, creds *caldavCredentials, target, depth, prop string) (*davMultistatus, error) {
+    body := `<?xml version="1.0" encoding="utf-8"?>` +
+        `<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">` + prop + `</d:propfind>`
+
+    resp, err := p.do(ctx, creds, "PROPFIND", target, strings.NewReader(body), map[string]string{
+        "Content-Type": "application/xml; charset=utf-8",
+        "Depth":        depth,
+    })
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode == http.StatusUnauthorized {
+        return nil, errors.New("CalDAV server rejected the credentials")
+    }
+    if resp.StatusCode != http.StatusMultiStatus {
+        return nil, fmt.Errorf("unexpected CalDAV response: %s", resp.Status)
+    }
+
+    var ms davMultistatus
+    if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+        return nil, fmt.Errorf("unable to parse CalDAV response: %w", err)
+    }
+    return &ms, nil
+}
+
+func (p *CalDAVProvider) do(ctx context.Context, creds *caldavCredentials, method, target string, body io.Reader, headers map[string]string) (*http.Response, error) {
+    u, err := p.resolve(creds, target)
+    if err != nil {
+        return nil, err
+    }
+
+    req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+    if err != nil {
+        return nil, err
+    }
+    req.SetBasicAuth(creds.Username, creds.Password)
+    for name, value := range headers {
+        req.Header.Set(name, value)
+    }
+
+    return p.client.Do(req)
+}
+
+// resolve turns hrefs returned by the server, which are usually paths, into
+// URLs on the configured server.
+func (p *CalDAVProvider) resolve(creds *caldavCredentials, target string) (*url.URL, error) {
+    base, err := url.Parse(creds.ServerURL)
+    if err != nil {
+        return nil, fmt.Errorf("invalid CalDAV server URL: %w", err)
+    }
+    ref, err := url.Parse(target)
+    if err != nil {
+        return nil, err
+    }
+    return base.ResolveReference(ref), nil
+}
+
+func (p *CalDAVProvider) absoluteURL(creds *caldavCredentials, href string) (string, error) {
+    u, err := p.resolve(creds, href)
+    if err != nil {
+        return "", err
+    }
+    return u.String(), nil
+}
+
+// hrefPath normalizes an href to its path so IDs stay stable whether the
+// server answers with absolute URLs or paths.
+func hrefPath(href string) string {
+    if u, err := url.Parse(href); err == nil && u.Path != "" {
+        return u.EscapedPath()
+    }
+    return href
+}
+
+func randomUID() string {
+    b := make([]byte, 16)
+    rand.Read(b)
+    return hex.EncodeToString(b)
+}
+
+func xmlEscape(s string) string {
+    var b bytes.Buffer
+    xml.EscapeText(&b, []byte(s))
+    return b.String()
+}
+
+type davMultistatus struct {
+    XMLName   xml.Name      `xml:"DAV: multistatus"`
+    Responses []davResponse `xml:"response"`
+    SyncToken string        `xml:"sync-token"`
+}
+
+type davResponse struct {
+    Href      string        `xml:"href"`
+    Status    string        `xml:"status"`
+    Propstats []davPropstat `xml:"propstat"`
+}
+
+type davPropstat struct {
+    Status string  `xml:"status"`
+    Prop   davProp `xml:"prop"`
+}
+
+type davProp struct {
+    ETag                 string           `xml:"getetag"`
+    CalendarData         string           `xml:"calendar-data"`
+    CurrentUserPrincipal davHref          `xml:"current-user-principal"`
+    CalendarHomeSet      davHref          `xml:"calendar-home-set"`
+    ResourceType         davResourceType  `xml:"resourcetype"`
+    SupportedComponents  davComponentSet  `xml:"supported-calendar-component-set"`
+}
+
+type davHref struct {
+    Href string `xml:"href"`
+}
+
+type davResourceType struct {
+    Calendar *struct{} `xml:"calendar"`
+}
+
+type davComponentSet struct {
+    Components []struct {
+        Name string `xml:"name,attr"`
+    } `xml:"comp"`
+}
+
+// supports treats a missing component set as "everything", as RFC 4791
+// specifies.
+func (s davComponentSet) supports(name string) bool {
+    if len(s.Components) == 0 {
+        return true
+    }
+    for _, comp := range s.Components {
+        if strings.EqualFold(comp.Name, name) {
+            return true
+        }
+    }
+    return false
+}
+
+func (ms *davMultistatus) firstProp(get func(davProp) string) string {
+    for _, r := range ms.Responses {
+        for _, ps := range r.Propstats {
+            if value := get(ps.Prop); value != "" {
+                return value
+            }
+        }
+    }
+    return ""
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestCalDAVConnectRefusesInternalServers(t *testing.T) {
+    reached := false
+    server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        reached = true
+    }))
+    defer server.Close()
+
+    for _, tc := range []struct {
+        url  string
+        want error
+    }{
+        {server.URL, ErrCalDAVHostBlocked},
+        {"https://169.254.169.254/latest/meta-data/", ErrCalDAVHostBlocked},
+        {"https://[::1]/dav/", ErrCalDAVHostBlocked},
+        {"http://calendar.example.com/dav/", ErrCalDAVInsecureURL},
+        {"file:///etc/passwd", ErrCalDAVInsecureURL},
+    } {
+        _, _, err := NewCalDAVProvider().Connect(context.Background(), ConnectParams{
+            ServerURL: tc.url,
+            Username:  "user",
+            Password:  "secret",
+        })
+        if !errors.Is(err, tc.want) {
+            t.Errorf("%s: got %v, want %v", tc.url, err, tc.want)
+        }
+    }
+
+    if reached {
+        t.Error("the internal server was reached")
+    }
+}
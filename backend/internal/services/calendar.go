@@ -2,15 +2,19 @@ package services
 
 import (
     "context"
-    "encoding/json"
+    "errors"
     "fmt"
+    "net/http"
     "os"
     "time"
+    "taskflow/internal/models"
 
     "golang.org/x/oauth2"
     "golang.org/x/oauth2/google"
     "google.golang.org/api/calendar/v3"
+    "google.golang.org/api/googleapi"
     "google.golang.org/api/option"
+    "gorm.io/gorm"
 )
 
 var (
@@ -25,118 +29,390 @@ var (
     }
 )
 
+const (
+    DefaultCalendarID = "primary"
+    DefaultTimezone   = "America/Sao_Paulo"
+)
+
+// calendarRequestTimeout bounds every call to a calendar provider so a slow
+// upstream cannot pin a sync goroutine forever.
+const calendarRequestTimeout = 30 * time.Second
+
 type GoogleCalendarService struct {
     config *oauth2.Config
+    db     *gorm.DB
 }
 
-func NewGoogleCalendarService() *GoogleCalendarService {
+func NewGoogleCalendarService(db *gorm.DB) *GoogleCalendarService {
     return &GoogleCalendarService{
         config: googleOAuthConfig,
+        db:     db,
     }
 }
 
-func (s *GoogleCalendarService) GetAuthURL(state string) string {
+func (s *GoogleCalendarService) Name() string {
+    return ProviderGoogle
+}
+
+func (s *GoogleCalendarService) AuthURL(state string) string {
     return s.config.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce)
 }
 
-func (s *GoogleCalendarService) ExchangeCode(code string) (*oauth2.Token, error) {
-    return s.config.Exchange(context.Background(), code)
+func (s *GoogleCalendarService) Connect(ctx context.Context, params ConnectParams) (string, string, error) {
+    token, err := s.config.Exchange(ctx, params.Code)
+    if err != nil {
+        return "", "", fmt.Errorf("unable to exchange code: %w", err)
+    }
+
+    credentials, err := oauthTokenJSON(token)
+    return credentials, params.CalendarID, err
 }
 
-func (s *GoogleCalendarService) CreateEvent(token *oauth2.Token, taskTitle, taskDescription string, dueDate time.Time) (*calendar.Event, error) {
-    client := s.config.Client(context.Background(), token)
-    
-    srv, err := calendar.NewService(context.Background(), option.WithHTTPClient(client))
+func (s *GoogleCalendarService) newService(ctx context.Context, conn *models.CalendarConnection) (*calendar.Service, error) {
+    tokenSource, err := newConnectionTokenSource(s.db, s.config, conn)
     if err != nil {
-        return nil, fmt.Errorf("unable to create Calendar service: %v", err)
+        return nil, err
     }
 
-    event := &calendar.Event{
-        Summary:     taskTitle,
-        Description: taskDescription,
-        Start: &calendar.EventDateTime{
-            DateTime: dueDate.Format(time.RFC3339),
-            TimeZone: "America/Sao_Paulo",
-        },
-        End: &calendar.EventDateTime{
-            DateTime: dueDate.Add(1 * time.Hour).Format(time.RFC3339),
-            TimeZone: "America/Sao_Paulo",
-        },
-        Reminders: &calendar.EventReminders{
-            UseDefault: false,
-            Overrides: []*calendar.EventReminder{
-                {Method: "email", Minutes: 24 * 60},
-                {Method: "popup", Minutes: 30},
-            },
-        },
+    client := oauth2.NewClient(ctx, tokenSource)
+    client.Timeout = calendarRequestTimeout
+
+    return calendar.NewService(ctx, option.WithHTTPClient(client))
+}
+
+// EventOptions are the user's calendar preferences applied to an event.
+type EventOptions struct {
+    CalendarID string
+    TimeZone   string
+    Duration   time.Duration
+    AllDay     bool
+    // Reminders nil keeps the default email/popup reminders
+    Reminders *models.EventReminders
+}
+
+// EventOptionsFor resolves the event options for a task from its owner's
+// preferences, falling back to the historical defaults.
+func EventOptionsFor(user *models.User, task *models.Task) EventOptions {
+    prefs := user.CalendarPreferences
+
+    opts := EventOptions{
+        CalendarID: prefs.CalendarID,
+        TimeZone:   user.Timezone,
+        Duration:   time.Duration(prefs.DefaultDuration) * time.Minute,
+        AllDay:     prefs.AllDayEvents && task.DueDateAllDay,
+        Reminders:  prefs.Reminders,
     }
 
-    createdEvent, err := srv.Events.Insert("primary", event).Do()
+    if _, err := time.LoadLocation(opts.TimeZone); opts.TimeZone == "" || err != nil {
+        opts.TimeZone = DefaultTimezone
+    }
+    if opts.Duration <= 0 {
+        opts.Duration = time.Hour
+    }
+
+    return opts
+}
+
+// UserLocation is the user's time zone, DefaultTimezone when unset or
+// unknown.
+func UserLocation(user *models.User) *time.Location {
+    if loc, err := time.LoadLocation(user.Timezone); user.Timezone != "" && err == nil {
+        return loc
+    }
+    loc, err := time.LoadLocation(DefaultTimezone)
     if err != nil {
-        return nil, fmt.Errorf("unable to create event: %v", err)
+        return time.UTC
+    }
+    return loc
+}
+
+func googleCalendarID(calendarID string) string {
+    if calendarID == "" {
+        return DefaultCalendarID
+    }
+    return calendarID
+}
+
+func buildGoogleEvent(opts EventOptions, event *CalendarEvent) *calendar.Event {
+    googleEvent := &calendar.Event{
+        Summary:     event.Title,
+        Description: event.Description,
+        Recurrence:  event.Recurrence,
+    }
+
+    if event.AllDay {
+        // All-day events use exclusive end dates
+        googleEvent.Start = &calendar.EventDateTime{Date: event.Start.Format("2006-01-02")}
+        googleEvent.End = &calendar.EventDateTime{Date: event.End.Format("2006-01-02")}
+    } else {
+        loc, _ := time.LoadLocation(opts.TimeZone)
+        googleEvent.Start = &calendar.EventDateTime{
+            DateTime: event.Start.In(loc).Format(time.RFC3339),
+            TimeZone: opts.TimeZone,
+        }
+        googleEvent.End = &calendar.EventDateTime{
+            DateTime: event.End.In(loc).Format(time.RFC3339),
+            TimeZone: opts.TimeZone,
+        }
+    }
+
+    googleEvent.Reminders = &calendar.EventReminders{
+        UseDefault:      false,
+        ForceSendFields: []string{"UseDefault"},
+    }
+    for _, reminder := range eventReminders(opts) {
+        googleEvent.Reminders.Overrides = append(googleEvent.Reminders.Overrides, &calendar.EventReminder{
+            Method:          reminder.Method,
+            Minutes:         reminder.Minutes,
+            ForceSendFields: []string{"Minutes"},
+        })
+    }
+
+    return googleEvent
+}
+
+// eventReminders resolves the reminders for an event, TaskFlow's defaults
+// unless the user overrode them.
+func eventReminders(opts EventOptions) models.EventReminders {
+    if opts.Reminders == nil {
+        return models.EventReminders{
+            {Method: "email", Minutes: 24 * 60},
+            {Method: "popup", Minutes: 30},
+        }
+    }
+    return *opts.Reminders
+}
+
+func fromGoogleEvent(calendarID string, googleEvent *calendar.Event) CalendarEvent {
+    event := CalendarEvent{
+        ID:          googleEvent.Id,
+        CalendarID:  calendarID,
+        Title:       googleEvent.Summary,
+        Description: googleEvent.Description,
+        ETag:        googleEvent.Etag,
+        Deleted:     googleEvent.Status == "cancelled",
     }
 
-    return createdEvent, nil
+    if googleEvent.Start != nil {
+        event.Start, event.AllDay = parseGoogleEventTime(googleEvent.Start)
+    }
+    if googleEvent.End != nil {
+        event.End, _ = parseGoogleEventTime(googleEvent.End)
+    }
+    event.Updated, _ = time.Parse(time.RFC3339, googleEvent.Updated)
+
+    return event
+}
+
+func parseGoogleEventTime(value *calendar.EventDateTime) (time.Time, bool) {
+    if value.Date != "" {
+        t, _ := time.Parse("2006-01-02", value.Date)
+        return t, true
+    }
+    t, _ := time.Parse(time.RFC3339, value.DateTime)
+    return t, false
 }
 
-func (s *GoogleCalendarService) UpdateEvent(token *oauth2.Token, eventID, taskTitle, taskDescription string, dueDate time.Time) (*calendar.Event, error) {
-    client := s.config.Client(context.Background(), token)
-    
-    srv, err := calendar.NewService(context.Background(), option.WithHTTPClient(client))
+// CreateEvent inserts a new event. When event.ID is set it is used as the
+// Google event ID, which makes retries idempotent: if a previous attempt
+// already created the event, it is updated instead of duplicated.
+func (s *GoogleCalendarService) CreateEvent(ctx context.Context, conn *models.CalendarConnection, opts EventOptions, event *CalendarEvent) (*CalendarEvent, error) {
+    srv, err := s.newService(ctx, conn)
     if err != nil {
-        return nil, fmt.Errorf("unable to create Calendar service: %v", err)
+        return nil, fmt.Errorf("unable to create Calendar service: %w", err)
     }
 
-    event := &calendar.Event{
-        Summary:     taskTitle,
-        Description: taskDescription,
-        Start: &calendar.EventDateTime{
-            DateTime: dueDate.Format(time.RFC3339),
-            TimeZone: "America/Sao_Paulo",
-        },
-        End: &calendar.EventDateTime{
-            DateTime: dueDate.Add(1 * time.Hour).Format(time.RFC3339),
-            TimeZone: "America/Sao_Paulo",
-        },
+    calendarID := googleCalendarID(event.CalendarID)
+    googleEvent := buildGoogleEvent(opts, event)
+    googleEvent.Id = event.ID
+
+    createdEvent, err := srv.Events.Insert(calendarID, googleEvent).Context(ctx).Do()
+    if err != nil {
+        if event.ID != "" && isGoogleAPIStatus(err, http.StatusConflict) {
+            return s.UpdateEvent(ctx, conn, opts, event)
+        }
+        return nil, fmt.Errorf("unable to create event: %w", err)
+    }
+
+    result := fromGoogleEvent(calendarID, createdEvent)
+    return &result, nil
+}
+
+func (s *GoogleCalendarService) UpdateEvent(ctx context.Context, conn *models.CalendarConnection, opts EventOptions, event *CalendarEvent) (*CalendarEvent, error) {
+    srv, err := s.newService(ctx, conn)
+    if err != nil {
+        return nil, fmt.Errorf("unable to create Calendar service: %w", err)
     }
 
-    updatedEvent, err := srv.Events.Update("primary", eventID, event).Do()
+    calendarID := googleCalendarID(event.CalendarID)
+    googleEvent := buildGoogleEvent(opts, event)
+
+    updatedEvent, err := srv.Events.Update(calendarID, event.ID, googleEvent).Context(ctx).Do()
     if err != nil {
-        return nil, fmt.Errorf("unable to update event: %v", err)
+        if isGoogleAPIStatus(err, http.StatusNotFound) || isGoogleAPIStatus(err, http.StatusGone) {
+            return nil, ErrEventNotFound
+        }
+        return nil, fmt.Errorf("unable to update event: %w", err)
     }
 
-    return updatedEvent, nil
+    result := fromGoogleEvent(calendarID, updatedEvent)
+    return &result, nil
 }
 
-func (s *GoogleCalendarService) DeleteEvent(token *oauth2.Token, eventID string) error {
-    client := s.config.Client(context.Background(), token)
-    
-    srv, err := calendar.NewService(context.Background(), option.WithHTTPClient(client))
+func (s *GoogleCalendarService) DeleteEvent(ctx context.Context, conn *models.CalendarConnection, calendarID, eventID string) error {
+    srv, err := s.newService(ctx, conn)
     if err != nil {
-        return fmt.Errorf("unable to create Calendar service: %v", err)
+        return fmt.Errorf("unable to create Calendar service: %w", err)
     }
 
-    err = srv.Events.Delete("primary", eventID).Do()
+    err = srv.Events.Delete(googleCalendarID(calendarID), eventID).Context(ctx).Do()
     if err != nil {
-        return fmt.Errorf("unable to delete event: %v", err)
+        // Already gone on Google's side, nothing left to do
+        if isGoogleAPIStatus(err, http.StatusNotFound) || isGoogleAPIStatus(err, http.StatusGone) {
+            return nil
+        }
+        return fmt.Errorf("unable to delete event: %w", err)
     }
 
     return nil
 }
 
-func (s *GoogleCalendarService) GetTokenFromJSON(tokenJSON string) (*oauth2.Token, error) {
-    token := &oauth2.Token{}
-    err := json.Unmarshal([]byte(tokenJSON), token)
+func (s *GoogleCalendarService) GetEvent(ctx context.Context, conn *models.CalendarConnection, calendarID, eventID string) (*CalendarEvent, error) {
+    srv, err := s.newService(ctx, conn)
     if err != nil {
-        return nil, err
+        return nil, fmt.Errorf("unable to create Calendar service: %w", err)
+    }
+
+    calendarID = googleCalendarID(calendarID)
+    googleEvent, err := srv.Events.Get(calendarID, eventID).Context(ctx).Do()
+    if err != nil {
+        if isGoogleAPIStatus(err, http.StatusNotFound) || isGoogleAPIStatus(err, http.StatusGone) {
+            return nil, ErrEventNotFound
+        }
+        return nil, fmt.Errorf("unable to get event: %w", err)
+    }
+    if googleEvent.Status == "cancelled" {
+        return nil, ErrEventNotFound
     }
-    return token, nil
+
+    event := fromGoogleEvent(calendarID, googleEvent)
+    return &event, nil
 }
 
-func (s *GoogleCalendarService) TokenToJSON(token *oauth2.Token) (string, error) {
-    data, err := json.Marshal(token)
+func (s *GoogleCalendarService) ListEvents(ctx context.Context, conn *models.CalendarConnection, calendarID string, start, end time.Time) ([]CalendarEvent, error) {
+    srv, err := s.newService(ctx, conn)
     if err != nil {
-        return "", err
+        return nil, fmt.Errorf("unable to create Calendar service: %w", err)
+    }
+
+    calendarID = googleCalendarID(calendarID)
+    var events []CalendarEvent
+    pageToken := ""
+    for {
+        call := srv.Events.List(calendarID).
+            TimeMin(start.Format(time.RFC3339)).
+            TimeMax(end.Format(time.RFC3339)).
+            SingleEvents(true).
+            OrderBy("startTime").
+            MaxResults(250).
+            Context(ctx)
+        if pageToken != "" {
+            call = call.PageToken(pageToken)
+        }
+
+        page, err := call.Do()
+        if err != nil {
+            return nil, fmt.Errorf("unable to list events: %w", err)
+        }
+
+        for _, item := range page.Items {
+            events = append(events, fromGoogleEvent(calendarID, item))
+        }
+
+        if page.NextPageToken == "" {
+            return events, nil
+        }
+        pageToken = page.NextPageToken
     }
-    return string(data), nil
+}
+
+// ListChanges pages through Google's incremental listing. Without a sync
+// token it returns every event and the token to continue from.
+func (s *GoogleCalendarService) ListChanges(ctx context.Context, conn *models.CalendarConnection, calendarID, syncToken string) (*EventChanges, error) {
+    srv, err := s.newService(ctx, conn)
+    if err != nil {
+        return nil, fmt.Errorf("unable to create Calendar service: %w", err)
+    }
+
+    calendarID = googleCalendarID(calendarID)
+    changes := &EventChanges{}
+    pageToken := ""
+    for {
+        call := srv.Events.List(calendarID).ShowDeleted(true).MaxResults(250).Context(ctx)
+        if syncToken != "" {
+            call = call.SyncToken(syncToken)
+        }
+        if pageToken != "" {
+            call = call.PageToken(pageToken)
+        }
+
+        page, err := call.Do()
+        if err != nil {
+            // Google expires sync tokens, a full listing is needed
+            if isGoogleAPIStatus(err, http.StatusGone) {
+                return nil, ErrSyncTokenExpired
+            }
+            return nil, fmt.Errorf("unable to list events: %w", err)
+        }
+
+        for _, item := range page.Items {
+            changes.Events = append(changes.Events, fromGoogleEvent(calendarID, item))
+        }
+
+        if page.NextPageToken == "" {
+            changes.NextSyncToken = page.NextSyncToken
+            return changes, nil
+        }
+        pageToken = page.NextPageToken
+    }
+}
+
+// Watch opens a push channel for the calendar's events. Google calls
+// address whenever an event changes; the notification carries no data, it
+// only signals that ListChanges has something new.
+func (s *GoogleCalendarService) Watch(ctx context.Context, conn *models.CalendarConnection, calendarID, address, channelID, token string) (string, time.Time, error) {
+    srv, err := s.newService(ctx, conn)
+    if err != nil {
+        return "", time.Time{}, fmt.Errorf("unable to create Calendar service: %w", err)
+    }
+
+    channel, err := srv.Events.Watch(googleCalendarID(calendarID), &calendar.Channel{
+        Id:      channelID,
+        Type:    "web_hook",
+        Address: address,
+        Token:   token,
+    }).Context(ctx).Do()
+    if err != nil {
+        return "", time.Time{}, fmt.Errorf("unable to watch calendar: %w", err)
+    }
+
+    return channel.ResourceId, time.UnixMilli(channel.Expiration), nil
+}
+
+func (s *GoogleCalendarService) StopWatch(ctx context.Context, conn *models.CalendarConnection, channelID, resourceID string) error {
+    srv, err := s.newService(ctx, conn)
+    if err != nil {
+        return fmt.Errorf("unable to create Calendar service: %w", err)
+    }
+
+    err = srv.Channels.Stop(&calendar.Channel{Id: channelID, ResourceId: resourceID}).Context(ctx).Do()
+    if err != nil && !isGoogleAPIStatus(err, http.StatusNotFound) {
+        return fmt.Errorf("unable to stop channel: %w", err)
+    }
+    return nil
+}
+
+func isGoogleAPIStatus(err error, code int) bool {
+    var apiErr *googleapi.Error
+    return errors.As(err, &apiErr) && apiErr.Code == code
 }
@@ -0,0 +1,210 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "log"
+    "sort"
+    "time"
+    "taskflow/internal/models"
+
+    "gorm.io/gorm"
+)
+
+var ErrNoCalendarConnection = errors.New("no connected calendar")
+
+// CalendarEventService reads and writes events in the user's connected
+// calendars for the calendar view, next to the events derived from tasks.
+type CalendarEventService struct {
+    db *gorm.DB
+}
+
+func NewCalendarEventService(db *gorm.DB) *CalendarEventService {
+    return &CalendarEventService{
+        db: db,
+    }
+}
+
+// ListEvents returns the user's events overlapping [start, end): one per
+// open task due in the range plus the events of every connected calendar.
+// Events TaskFlow wrote for a task are folded into the task's event. A
+// calendar that fails to load is logged and left out.
+func (s *CalendarEventService) ListEvents(ctx context.Context, user *models.User, start, end time.Time) ([]CalendarEvent, error) {
+    var tasks []models.Task
+    err := CalendarTasks(s.db, user.ID).
+        Where("status <> ? AND due_date >= ? AND due_date < ?", models.StatusCompleted, start, end).
+        Find(&tasks).Error
+    if err != nil {
+        return nil, err
+    }
+
+    events := make([]CalendarEvent, 0, len(tasks))
+    listed := make(map[uint]bool, len(tasks))
+    for i := range tasks {
+        events = append(events, TaskCalendarEvent(user, &tasks[i]))
+        listed[tasks[i].ID] = true
+    }
+
+    var connections []models.CalendarConnection
+    if err := s.db.Where("user_id = ? AND credentials <> ''", user.ID).Order("id").Find(&connections).Error; err != nil {
+        return nil, err
+    }
+
+    for i := range connections {
+        conn := &connections[i]
+        external, err := s.connectionEvents(ctx, conn, user, start, end)
+        if err != nil {
+            log.Printf("failed to list %s events for user %d: %v", conn.Provider, user.ID, err)
+            continue
+        }
+
+        for _, event := range external {
+            if event.TaskID != nil && listed[*event.TaskID] {
+                continue
+            }
+            events = append(events, event)
+        }
+    }
+
+    sort.SliceStable(events, func(i, j int) bool {
+        return events[i].Start.Before(events[j].Start)
+    })
+    return events, nil
+}
+
+func (s *CalendarEventService) connectionEvents(ctx context.Context, conn *models.CalendarConnection, user *models.User, start, end time.Time) ([]CalendarEvent, error) {
+    provider, err := NewCalendarProvider(conn.Provider, s.db)
+    if err != nil {
+        return nil, err
+    }
+
+    external, err := provider.ListEvents(ctx, conn, connectionCalendarID(conn, user), start, end)
+    if err != nil {
+        return nil, err
+    }
+
+    var mappings []models.TaskEventMapping
+    if err := s.db.Where("connection_id = ?", conn.ID).Find(&mappings).Error; err != nil {
+        return nil, err
+    }
+    taskIDs := make(map[string]uint, len(mappings))
+    for _, mapping := range mappings {
+        taskIDs[mapping.ExternalEventID] = mapping.TaskID
+    }
+
+    events := external[:0]
+    for _, event := range external {
+        if event.Deleted {
+            continue
+        }
+        event.Provider = conn.Provider
+        if taskID, ok := taskIDs[event.ID]; ok {
+            event.TaskID = &taskID
+        }
+        events = append(events, event)
+    }
+    return events, nil
+}
+
+// Connection returns the user's connection for a provider, or the oldest
+// connected one when provider is empty.
+func (s *CalendarEventService) Connection(userID uint, provider string) (*models.CalendarConnection, error) {
+    query := s.db.Where("user_id = ? AND credentials <> ''", userID)
+    if provider != "" {
+        query = query.Where("provider = ?", provider)
+    }
+
+    var conn models.CalendarConnection
+    err := query.Order("id").First(&conn).Error
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, ErrNoCalendarConnection
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &conn, nil
+}
+
+// GetEvent loads an event, linking it to the task it was written for.
+func (s *CalendarEventService) GetEvent(ctx context.Context, conn *models.CalendarConnection, user *models.User, eventID string) (*CalendarEvent, error) {
+    provider, err := NewCalendarProvider(conn.Provider, s.db)
+    if err != nil {
+        return nil, err
+    }
+
+    event, err := provider.GetEvent(ctx, conn, connectionCalendarID(conn, user), eventID)
+    if err != nil {
+        return nil, err
+    }
+    event.Provider = conn.Provider
+
+    var mapping models.TaskEventMapping
+    err = s.db.Where("connection_id = ? AND external_event_id = ?", conn.ID, eventID).First(&mapping).Error
+    if err == nil {
+        event.TaskID = &mapping.TaskID
+    } else if !errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, err
+    }
+
+    return event, nil
+}
+
+func (s *CalendarEventService) CreateEvent(ctx context.Context, conn *models.CalendarConnection, user *models.User, event *CalendarEvent) (*CalendarEvent, error) {
+    provider, err := NewCalendarProvider(conn.Provider, s.db)
+    if err != nil {
+        return nil, err
+    }
+
+    opts := userEventOptions(conn, user, event.AllDay)
+    event.ID = ""
+    event.CalendarID = opts.CalendarID
+
+    created, err := provider.CreateEvent(ctx, conn, opts, event)
+    if err != nil {
+        return nil, err
+    }
+    created.Provider = conn.Provider
+    return created, nil
+}
+
+func (s *CalendarEventService) UpdateEvent(ctx context.Context, conn *models.CalendarConnection, user *models.User, event *CalendarEvent) (*CalendarEvent, error) {
+    provider, err := NewCalendarProvider(conn.Provider, s.db)
+    if err != nil {
+        return nil, err
+    }
+
+    opts := userEventOptions(conn, user, event.AllDay)
+    event.CalendarID = opts.CalendarID
+
+    updated, err := provider.UpdateEvent(ctx, conn, opts, event)
+    if err != nil {
+        return nil, err
+    }
+    updated.Provider = conn.Provider
+    return updated, nil
+}
+
+func (s *CalendarEventService) DeleteEvent(ctx context.Context, conn *models.CalendarConnection, user *models.User, eventID string) error {
+    provider, err := NewCalendarProvider(conn.Provider, s.db)
+    if err != nil {
+        return err
+    }
+
+    return provider.DeleteEvent(ctx, conn, connectionCalendarID(conn, user), eventID)
+}
+
+// TaskCalendarEvent renders a dated task as a calendar event linked to it.
+func TaskCalendarEvent(user *models.User, task *models.Task) CalendarEvent {
+    event := *taskEvent(task, EventOptionsFor(user, task))
+    event.CalendarID = ""
+    event.TaskID = &task.ID
+    return event
+}
+
+// userEventOptions are the event options for events not derived from a
+// task, written to the connection's calendar.
+func userEventOptions(conn *models.CalendarConnection, user *models.User, allDay bool) EventOptions {
+    opts := connectionEventOptions(conn, user, &models.Task{DueDateAllDay: allDay})
+    opts.AllDay = allDay
+    return opts
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "time"
+    "taskflow/internal/auth"
+    "taskflow/internal/models"
+
+    "gorm.io/gorm"
+)
+
+const (
+    ProviderGoogle    = "google"
+    ProviderCalDAV    = "caldav"
+    ProviderMicrosoft = "microsoft"
+)
+
+var (
+    ErrUnknownProvider = errors.New("unknown calendar provider")
+    // ErrCredentialsRevoked is returned when the provider rejects the stored
+    // credentials for good; the connection has been disabled.
+    ErrCredentialsRevoked = errors.New("calendar credentials revoked")
+    // ErrEventNotFound is returned when updating an event that no longer
+    // exists on the provider side.
+    ErrEventNotFound = errors.New("calendar event not found")
+    // ErrSyncTokenExpired asks the caller to start over with a full listing.
+    ErrSyncTokenExpired = errors.New("calendar sync token expired")
+)
+
+// ConnectParams carries what a provider needs to establish a connection:
+// an OAuth authorization code, or server credentials for CalDAV.
+type ConnectParams struct {
+    Code       string
+    ServerURL  string
+    Username   string
+    Password   string
+    CalendarID string
+}
+
+// CalendarEvent is the provider independent view of an external event.
+type CalendarEvent struct {
+    ID          string    `json:"id"`
+    CalendarID  string    `json:"calendar_id"`
+    Title       string    `json:"title"`
+    Description string    `json:"description"`
+    Start       time.Time `json:"start"`
+    End         time.Time `json:"end"`
+    AllDay      bool      `json:"all_day"`
+    ETag        string    `json:"-"`
+    Updated     time.Time `json:"-"`
+    // Deleted marks events removed on the provider side in a change list
+    Deleted bool `json:"-"`
+    // Provider is the connection the event lives in, "" for events derived
+    // from a task that no calendar holds
+    Provider string `json:"provider,omitempty"`
+    // TaskID links the event to the task it renders
+    TaskID *uint `json:"task_id,omitempty,string"`
+    // Recurrence holds the RRULE lines of a repeating event
+    Recurrence []string `json:"recurrence,omitempty"`
+}
+
+// EventChanges is one page of changes since a sync token. An empty
+// SyncToken in the request asks for a full listing.
+type EventChanges struct {
+    Events        []CalendarEvent
+    NextSyncToken string
+}
+
+// CalendarProvider is implemented by every external calendar backend.
+// Credentials are kept encrypted on the CalendarConnection, bound to the
+// connection row (see EncryptCredentials); providers that refresh them write
+// the new value back to the connection.
+type CalendarProvider interface {
+    Name() string
+    // AuthURL returns the consent URL for OAuth providers, "" otherwise.
+    AuthURL(state string) string
+    // Connect validates params and returns the credentials to store along
+    // with the calendar to write to ("" for the account's default). The
+    // credentials are not encrypted yet, that needs the saved connection.
+    Connect(ctx context.Context, params ConnectParams) (credentials, calendarID string, err error)
+    CreateEvent(ctx context.Context, conn *models.CalendarConnection, opts EventOptions, event *CalendarEvent) (*CalendarEvent, error)
+    UpdateEvent(ctx context.Context, conn *models.CalendarConnection, opts EventOptions, event *CalendarEvent) (*CalendarEvent, error)
+    DeleteEvent(ctx context.Context, conn *models.CalendarConnection, calendarID, eventID string) error
+    // GetEvent returns ErrEventNotFound when the event does not exist.
+    GetEvent(ctx context.Context, conn *models.CalendarConnection, calendarID, eventID string) (*CalendarEvent, error)
+    // ListEvents returns the events overlapping [start, end).
+    ListEvents(ctx context.Context, conn *models.CalendarConnection, calendarID string, start, end time.Time) ([]CalendarEvent, error)
+    ListChanges(ctx context.Context, conn *models.CalendarConnection, calendarID, syncToken string) (*EventChanges, error)
+}
+
+// ChangeWatcher is implemented by providers that can push a notification
+// when a calendar changes, so it does not have to be polled as often.
+type ChangeWatcher interface {
+    // Watch opens a notification channel delivering to address. The
+    // provider echoes token back with every notification.
+    Watch(ctx context.Context, conn *models.CalendarConnection, calendarID, address, channelID, token string) (resourceID string, expiresAt time.Time, err error)
+    StopWatch(ctx context.Context, conn *models.CalendarConnection, channelID, resourceID string) error
+}
+
+// NewCalendarProvider returns the implementation for a provider name.
+func NewCalendarProvider(name string, db *gorm.DB) (CalendarProvider, error) {
+    switch name {
+    case ProviderGoogle:
+        return NewGoogleCalendarService(db), nil
+    case ProviderCalDAV:
+        return NewCalDAVProvider(), nil
+    case ProviderMicrosoft:
+        return NewMicrosoftCalendarProvider(db), nil
+    default:
+        return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+    }
+}
+
+// IsOAuthProvider reports whether connecting goes through a consent screen.
+func IsOAuthProvider(name string) bool {
+    return name == ProviderGoogle || name == ProviderMicrosoft
+}
+
+// taskEvent renders a task as the event sent to providers.
+func taskEvent(task *models.Task, opts EventOptions) *CalendarEvent {
+    start := *task.DueDate
+    end := start.Add(opts.Duration)
+    if opts.AllDay {
+        start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+        end = start.AddDate(0, 0, 1)
+    }
+
+    return &CalendarEvent{
+        CalendarID:  opts.CalendarID,
+        Title:       task.Title,
+        Description: task.Description,
+        Start:       start,
+        End:         end,
+        AllDay:      opts.AllDay,
+        Recurrence:  eventRecurrence(task),
+    }
+}
+
+// credentialsAAD is the additional data encrypted credentials are bound to,
+// so a value copied to another connection row does not decrypt.
+func credentialsAAD(conn *models.CalendarConnection) string {
+    return fmt.Sprintf("calendar_connection:%d:%s", conn.ID, conn.Provider)
+}
+
+// EncryptCredentials seals credentials for storage on conn, which must have
+// been saved already.
+func EncryptCredentials(conn *models.CalendarConnection, plaintext string) (string, error) {
+    if conn.ID == 0 {
+        return "", errors.New("calendar connection must be saved before encrypting its credentials")
+    }
+    return auth.EncryptToken(plaintext, credentialsAAD(conn))
+}
+
+// DecryptCredentials opens the credentials stored on conn.
+func DecryptCredentials(conn *models.CalendarConnection) (string, error) {
+    return auth.DecryptToken(conn.Credentials, credentialsAAD(conn))
+}
+
+// ReencryptCredentials moves the credentials stored on conn to the active
+// encryption key.
+func ReencryptCredentials(conn *models.CalendarConnection) (string, error) {
+    return auth.ReencryptToken(conn.Credentials, credentialsAAD(conn))
+}
+
+// disableConnection turns sync off for a connection whose credentials were
+// rejected and records why.
+func disableConnection(db *gorm.DB, conn *models.CalendarConnection, reason string) {
+    now := time.Now()
+    err := db.Model(&models.CalendarConnection{}).Where("id = ?", conn.ID).UpdateColumns(map[string]interface{}{
+        "credentials":     "",
+        "sync_enabled":    false,
+        "disabled_reason": reason,
+        "disabled_at":     now,
+    }).Error
+    if err != nil {
+        log.Printf("failed to disable calendar connection %d: %v", conn.ID, err)
+        return
+    }
+
+    conn.Credentials = ""
+    conn.SyncEnabled = false
+    conn.DisabledReason = reason
+    conn.DisabledAt = &now
+}
@@ -0,0 +1,387 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "os"
+    "time"
+    "taskflow/internal/models"
+
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+)
+
+const (
+    // calendarPullInterval is how often connections are polled for changes
+    calendarPullInterval = 5 * time.Minute
+    // calendarWatchedPullInterval is the fallback poll for connections with a
+    // push channel, in case a notification gets lost
+    calendarWatchedPullInterval = time.Hour
+    // calendarWatchRenewBefore is how long before expiry channels are renewed
+    calendarWatchRenewBefore = 24 * time.Hour
+    calendarPullPollInterval = 10 * time.Second
+)
+
+// calendarWebhookURL is the public address providers push change
+// notifications to. Push channels are only opened when it is set.
+var calendarWebhookURL = os.Getenv("GOOGLE_WEBHOOK_URL")
+
+// PullChanges applies the changes made on the connection's calendar since
+// the last pull to the tasks whose events were changed.
+//
+// Conflict policy: an event change is applied to its task unless the task
+// also changed in TaskFlow and that change has not been written to the
+// calendar yet (its sync job is still pending). In that case the most
+// recent change wins, comparing the event's modification time with the
+// task's UpdatedAt; the pending sync job then writes TaskFlow's version
+// back, or the task is updated and the job writes the merged task. When the
+// provider gives no modification time, TaskFlow wins.
+//
+// Only the title and due date are taken from the event. An event deleted
+// in the calendar unschedules its task (clears the due date) rather than
+// deleting it. Events that were not created by TaskFlow are ignored.
+func (s *TaskSyncService) PullChanges(ctx context.Context, conn *models.CalendarConnection) error {
+    provider, err := NewCalendarProvider(conn.Provider, s.db)
+    if err != nil {
+        return err
+    }
+
+    var user models.User
+    if err := s.db.First(&user, conn.UserID).Error; err != nil {
+        return fmt.Errorf("failed to load user: %w", err)
+    }
+
+    // A sync token only continues the listing of the calendar it came from
+    calendarID := connectionCalendarID(conn, &user)
+    syncToken := conn.SyncToken
+    if conn.SyncCalendarID != calendarID {
+        syncToken = ""
+        s.stopWatch(ctx, provider, conn)
+    }
+
+    changes, err := provider.ListChanges(ctx, conn, calendarID, syncToken)
+    if errors.Is(err, ErrSyncTokenExpired) {
+        changes, err = provider.ListChanges(ctx, conn, calendarID, "")
+    }
+    if err != nil {
+        return err
+    }
+
+    var errs []error
+    for i := range changes.Events {
+        if err := s.applyEventChange(conn, &user, calendarID, &changes.Events[i]); err != nil {
+            errs = append(errs, fmt.Errorf("event %s: %w", changes.Events[i].ID, err))
+        }
+    }
+
+    now := time.Now()
+    updates := map[string]interface{}{
+        "sync_calendar_id": calendarID,
+        "last_pulled_at":   now,
+    }
+    // Keep the old token when nothing new was handed out, so the next pull
+    // does not fall back to a full listing
+    if changes.NextSyncToken != "" {
+        updates["sync_token"] = changes.NextSyncToken
+    }
+    if err := s.db.Model(&models.CalendarConnection{}).Where("id = ?", conn.ID).UpdateColumns(updates).Error; err != nil {
+        errs = append(errs, err)
+    }
+
+    conn.SyncCalendarID = calendarID
+    conn.LastPulledAt = &now
+    if changes.NextSyncToken != "" {
+        conn.SyncToken = changes.NextSyncToken
+    }
+
+    return errors.Join(errs...)
+}
+
+// applyEventChange reconciles one changed event with its task following the
+// policy described on PullChanges.
+func (s *TaskSyncService) applyEventChange(conn *models.CalendarConnection, user *models.User, calendarID string, event *CalendarEvent) error {
+    return s.db.Transaction(func(tx *gorm.DB) error {
+        var mapping models.TaskEventMapping
+        err := tx.Where("connection_id = ? AND external_event_id = ? AND calendar_id = ?", conn.ID, event.ID, calendarID).
+            First(&mapping).Error
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil
+        }
+        if err != nil {
+            return err
+        }
+
+        // Our own writes come back in the listing with the ETag we stored
+        if event.ETag != "" && event.ETag == mapping.ETag && !event.Deleted {
+            return nil
+        }
+
+        // Locked so a concurrent API update cannot interleave
+        var task models.Task
+        err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&task, mapping.TaskID).Error
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            // Deleted task, its sync job removes the event
+            return nil
+        }
+        if err != nil {
+            return err
+        }
+
+        var pending int64
+        err = tx.Model(&models.SyncJob{}).
+            Where("task_id = ? AND status IN ?", task.ID, []string{SyncJobPending, SyncJobProcessing}).
+            Count(&pending).Error
+        if err != nil {
+            return err
+        }
+        // Workspace tasks only take changes from users still allowed to
+        // edit them
+        canEdit, err := CanEditTask(tx, conn.UserID, &task)
+        if err != nil {
+            return err
+        }
+        localWins := !canEdit || (pending > 0 && (event.Updated.IsZero() || !event.Updated.After(task.UpdatedAt)))
+
+        now := time.Now()
+
+        if event.Deleted {
+            if err := tx.Delete(&mapping).Error; err != nil {
+                return err
+            }
+            if localWins || task.DueDate == nil {
+                return nil
+            }
+            if task.Recurrence != "" {
+                // Recurring tasks keep their due date, the event comes back
+                return EnqueueTaskSync(tx, &task)
+            }
+            err := tx.Model(&task).Updates(map[string]interface{}{
+                "due_date":         nil,
+                "due_date_all_day": false,
+                "version":          gorm.Expr("version + 1"),
+            }).Error
+            if err != nil {
+                return err
+            }
+            return EnqueueTaskSync(tx, &task)
+        }
+
+        updates := map[string]interface{}{}
+        if event.Title != "" && event.Title != task.Title {
+            updates["title"] = event.Title
+        }
+        if eventMoved(event, conn, user, &task) {
+            dueDate, allDay := eventDueDate(event)
+            updates["due_date"] = dueDate
+            updates["due_date_all_day"] = allDay
+        }
+
+        if len(updates) == 0 {
+            return tx.Model(&mapping).UpdateColumns(map[string]interface{}{
+                "etag":      event.ETag,
+                "synced_at": now,
+            }).Error
+        }
+        if localWins {
+            return nil
+        }
+
+        updates["version"] = gorm.Expr("version + 1")
+        err = tx.Model(&task).Updates(updates).Error
+        if err != nil {
+            return err
+        }
+
+        err = tx.Model(&mapping).UpdateColumns(map[string]interface{}{
+            "etag":      event.ETag,
+            "synced_at": now,
+        }).Error
+        if err != nil {
+            return err
+        }
+
+        // Propagates the change to the user's other calendars
+        return EnqueueTaskSync(tx, &task)
+    })
+}
+
+// eventMoved reports whether the event no longer sits where the task would
+// render it.
+func eventMoved(event *CalendarEvent, conn *models.CalendarConnection, user *models.User, task *models.Task) bool {
+    if task.DueDate == nil {
+        return true
+    }
+
+    expected := taskEvent(task, connectionEventOptions(conn, user, task))
+    if expected.AllDay != event.AllDay {
+        return true
+    }
+    if event.AllDay {
+        return expected.Start.Format("2006-01-02") != event.Start.Format("2006-01-02")
+    }
+    return !expected.Start.Equal(event.Start)
+}
+
+// eventDueDate maps an event's start back to a due date. All-day events
+// become date-only due dates, stored at midnight UTC like dates sent to the
+// API.
+func eventDueDate(event *CalendarEvent) (time.Time, bool) {
+    if event.AllDay {
+        start := event.Start
+        return time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC), true
+    }
+    return event.Start, false
+}
+
+// ensureWatch opens or renews the connection's push channel when the
+// provider supports one and a webhook address is configured.
+func (s *TaskSyncService) ensureWatch(ctx context.Context, conn *models.CalendarConnection) error {
+    if calendarWebhookURL == "" {
+        return nil
+    }
+
+    provider, err := NewCalendarProvider(conn.Provider, s.db)
+    if err != nil {
+        return err
+    }
+    watcher, ok := provider.(ChangeWatcher)
+    if !ok {
+        return nil
+    }
+
+    if conn.ChannelID != "" && conn.ChannelExpiresAt != nil && time.Until(*conn.ChannelExpiresAt) > calendarWatchRenewBefore {
+        return nil
+    }
+
+    channelID, token := randomUID(), randomUID()
+    resourceID, expiresAt, err := watcher.Watch(ctx, conn, conn.SyncCalendarID, calendarWebhookURL, channelID, token)
+    if err != nil {
+        return err
+    }
+
+    // The old channel overlaps the new one until it is stopped
+    s.stopWatch(ctx, provider, conn)
+
+    err = s.db.Model(&models.CalendarConnection{}).Where("id = ?", conn.ID).UpdateColumns(map[string]interface{}{
+        "channel_id":          channelID,
+        "channel_token":       token,
+        "channel_resource_id": resourceID,
+        "channel_expires_at":  expiresAt,
+    }).Error
+    if err != nil {
+        return err
+    }
+
+    conn.ChannelID = channelID
+    conn.ChannelToken = token
+    conn.ChannelResourceID = resourceID
+    conn.ChannelExpiresAt = &expiresAt
+    return nil
+}
+
+// stopWatch closes the connection's push channel, if any. Failing to stop
+// it is only logged, the channel expires on its own.
+func (s *TaskSyncService) stopWatch(ctx context.Context, provider CalendarProvider, conn *models.CalendarConnection) {
+    watcher, ok := provider.(ChangeWatcher)
+    if !ok || conn.ChannelID == "" {
+        return
+    }
+
+    if err := watcher.StopWatch(ctx, conn, conn.ChannelID, conn.ChannelResourceID); err != nil {
+        log.Printf("failed to stop channel %s for connection %d: %v", conn.ChannelID, conn.ID, err)
+    }
+
+    err := s.db.Model(&models.CalendarConnection{}).Where("id = ?", conn.ID).UpdateColumns(map[string]interface{}{
+        "channel_id":          "",
+        "channel_token":       "",
+        "channel_resource_id": "",
+        "channel_expires_at":  nil,
+    }).Error
+    if err != nil {
+        log.Printf("failed to clear channel for connection %d: %v", conn.ID, err)
+    }
+
+    conn.ChannelID = ""
+    conn.ChannelToken = ""
+    conn.ChannelResourceID = ""
+    conn.ChannelExpiresAt = nil
+}
+
+// RequestPull schedules an immediate pull for the connection owning a push
+// channel, after checking the token the provider echoed back.
+func RequestPull(db *gorm.DB, channelID, token string) error {
+    if channelID == "" || token == "" {
+        return nil
+    }
+
+    return db.Model(&models.CalendarConnection{}).
+        Where("channel_id = ? AND channel_token = ?", channelID, token).
+        UpdateColumn("next_pull_at", time.Now()).Error
+}
+
+// runPuller pulls due connections one at a time until ctx is cancelled.
+func (w *SyncWorker) runPuller(ctx context.Context) {
+    for {
+        conn, err := w.claimPull()
+        if err != nil {
+            log.Printf("sync worker: failed to claim calendar pull: %v", err)
+        }
+
+        if conn == nil {
+            select {
+            case <-ctx.Done():
+                return
+            case <-time.After(calendarPullPollInterval):
+            }
+            continue
+        }
+
+        pullCtx, cancel := context.WithTimeout(ctx, syncStaleAfter)
+        if err := w.syncService.PullChanges(pullCtx, conn); err != nil {
+            log.Printf("sync worker: failed to pull calendar changes for connection %d: %v", conn.ID, err)
+        } else if err := w.syncService.ensureWatch(pullCtx, conn); err != nil {
+            log.Printf("sync worker: failed to watch calendar for connection %d: %v", conn.ID, err)
+        }
+        cancel()
+
+        if ctx.Err() != nil {
+            return
+        }
+    }
+}
+
+// claimPull locks the next connection due for a pull and schedules its
+// following pull, which also keeps other instances from pulling it.
+func (w *SyncWorker) claimPull() (*models.CalendarConnection, error) {
+    var conn models.CalendarConnection
+
+    err := w.db.Transaction(func(tx *gorm.DB) error {
+        now := time.Now()
+        err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+            Where("sync_enabled = ? AND credentials <> ''", true).
+            Where("next_pull_at IS NULL OR next_pull_at <= ?", now).
+            Order("next_pull_at NULLS FIRST").
+            First(&conn).Error
+        if err != nil {
+            return err
+        }
+
+        interval := calendarPullInterval
+        if conn.ChannelID != "" {
+            interval = calendarWatchedPullInterval
+        }
+        next := now.Add(interval)
+        conn.NextPullAt = &next
+        return tx.Model(&conn).UpdateColumn("next_pull_at", next).Error
+    })
+
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &conn, nil
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "taskflow/internal/models"
+
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+)
+
+var ErrDependencyCycle = errors.New("the dependency would create a cycle")
+
+// BlockedError refuses to start or complete a task while other tasks block
+// it.
+type BlockedError struct {
+    BlockedBy []models.TaskRef
+}
+
+func (e *BlockedError) Error() string {
+    return fmt.Sprintf("task is blocked by %d unfinished task(s)", len(e.BlockedBy))
+}
+
+// AddDependency records that blocker blocks blocked, unless that closes a
+// cycle: blocked already blocks blocker, directly or through other tasks.
+// Adding an existing dependency does nothing. Both tasks are locked first,
+// in ID order so concurrent calls can't deadlock, so two requests linking
+// the same tasks in opposite directions can't both pass the cycle check.
+func AddDependency(tx *gorm.DB, blockerID, blockedID uint) error {
+    if blockerID == blockedID {
+        return ErrDependencyCycle
+    }
+
+    var locked []uint
+    err := tx.Model(&models.Task{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+        Where("id IN ?", []uint{blockerID, blockedID}).
+        Order("id").
+        Pluck("id", &locked).Error
+    if err != nil {
+        return err
+    }
+
+    seen := map[uint]bool{blockedID: true}
+    level := []uint{blockedID}
+    for len(level) > 0 {
+        var next []uint
+        err := tx.Model(&models.TaskDependency{}).Where("blocker_id IN ?", level).Pluck("blocked_id", &next).Error
+        if err != nil {
+            return err
+        }
+
+        level = level[:0]
+        for _, id := range next {
+            if id == blockerID {
+                return ErrDependencyCycle
+            }
+            if !seen[id] {
+                seen[id] = true
+                level = append(level, id)
+            }
+        }
+    }
+
+    dependency := models.TaskDependency{BlockerID: blockerID, BlockedID: blockedID}
+    return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&dependency).Error
+}
+
+// OpenBlockers lists the unfinished tasks blocking a task.
+func OpenBlockers(db *gorm.DB, taskID uint) ([]models.TaskRef, error) {
+    blockers, err := openBlockers(db, []uint{taskID})
+    if err != nil {
+        return nil, err
+    }
+    return blockers[taskID], nil
+}
+
+// CheckNotBlocked refuses to move a task with unfinished blockers to
+// in_progress or completed.
+func CheckNotBlocked(db *gorm.DB, task *models.Task, status string) error {
+    if task.ID == 0 || status == task.Status {
+        return nil
+    }
+    if status != models.StatusInProgress && status != models.StatusCompleted {
+        return nil
+    }
+
+    blockers, err := OpenBlockers(db, task.ID)
+    if err != nil {
+        return err
+    }
+    if len(blockers) > 0 {
+        return &BlockedError{BlockedBy: blockers}
+    }
+    return nil
+}
+
+// openBlockers maps each of the task IDs to its unfinished blockers.
+func openBlockers(db *gorm.DB, taskIDs []uint) (map[uint][]models.TaskRef, error) {
+    var rows []struct {
+        BlockedID uint
+        ID        uint
+        Title     string
+        Status    string
+    }
+    err := db.Table("task_dependencies").
+        Select("task_dependencies.blocked_id, tasks.id, tasks.title, tasks.status").
+        Joins("JOIN tasks ON tasks.id = task_dependencies.blocker_id AND tasks.deleted_at IS NULL").
+        Where("task_dependencies.blocked_id IN ? AND tasks.status <> ?", taskIDs, models.StatusCompleted).
+        Order("tasks.id").
+        Scan(&rows).Error
+    if err != nil {
+        return nil, err
+    }
+
+    blockers := make(map[uint][]models.TaskRef)
+    for _, row := range rows {
+        blockers[row.BlockedID] = append(blockers[row.BlockedID], models.TaskRef{
+            ID:     row.ID,
+            Title:  row.Title,
+            Status: row.Status,
+        })
+    }
+    return blockers, nil
+}
+
+// loadTaskBlockers fills in the BlockedBy of tasks.
+func loadTaskBlockers(db *gorm.DB, tasks []models.Task) error {
+    if len(tasks) == 0 {
+        return nil
+    }
+
+    ids := make([]uint, len(tasks))
+    for i := range tasks {
+        ids[i] = tasks[i].ID
+    }
+
+    blockers, err := openBlockers(db, ids)
+    if err != nil {
+        return err
+    }
+    for i := range tasks {
+        tasks[i].BlockedBy = blockers[tasks[i].ID]
+    }
+    return nil
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "testing"
+    "taskflow/internal/models"
+)
+
+func TestAddDependencyRefusesCycles(t *testing.T) {
+    db := newSubtaskTest(t)
+    var ids [4]uint
+    for i := range ids {
+        ids[i] = createTask(t, db, models.Task{Title: fmt.Sprintf("Task %d", i)}).ID
+    }
+    a, b, c, d := ids[0], ids[1], ids[2], ids[3]
+
+    for _, tc := range []struct {
+        name             string
+        blocker, blocked uint
+        want             error
+    }{
+        {"self", a, a, ErrDependencyCycle},
+        {"a blocks b", a, b, nil},
+        {"direct cycle", b, a, ErrDependencyCycle},
+        {"b blocks c", b, c, nil},
+        {"transitive cycle", c, a, ErrDependencyCycle},
+        {"duplicate", a, b, nil},
+        {"shortcut", a, c, nil},
+        {"unrelated", d, c, nil},
+        {"back to d", c, d, ErrDependencyCycle},
+    } {
+        if err := AddDependency(db, tc.blocker, tc.blocked); !errors.Is(err, tc.want) {
+            t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+        }
+    }
+
+    var links []models.TaskDependency
+    if err := db.Order("blocker_id, blocked_id").Find(&links).Error; err != nil {
+        t.Fatal(err)
+    }
+    got := make([]string, len(links))
+    for i, link := range links {
+        got[i] = fmt.Sprintf("%d→%d", link.BlockerID, link.BlockedID)
+    }
+    if want := fmt.Sprint([]string{
+        fmt.Sprintf("%d→%d", a, b), fmt.Sprintf("%d→%d", a, c), fmt.Sprintf("%d→%d", b, c), fmt.Sprintf("%d→%d", d, c),
+    }); fmt.Sprint(got) != want {
+        t.Errorf("got links %v, want %s", got, want)
+    }
+}
+
+func TestCheckNotBlocked(t *testing.T) {
+    db := newSubtaskTest(t)
+    open := createTask(t, db, models.Task{Title: "Get quotes", Status: models.StatusInProgress})
+    done := createTask(t, db, models.Task{Title: "Measure", Status: models.StatusCompleted})
+    deleted := createTask(t, db, models.Task{Title: "Old plan"})
+    blocked := createTask(t, db, models.Task{Title: "Order kitchen"})
+    free := createTask(t, db, models.Task{Title: "Paint"})
+    for _, blocker := range []*models.Task{open, done, deleted} {
+        if err := AddDependency(db, blocker.ID, blocked.ID); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := AddDependency(db, done.ID, free.ID); err != nil {
+        t.Fatal(err)
+    }
+    if err := db.Delete(deleted).Error; err != nil {
+        t.Fatal(err)
+    }
+
+    for _, tc := range []struct {
+        task      *models.Task
+        status    string
+        blockedBy string
+    }{
+        {blocked, models.StatusInProgress, "[Get quotes]"},
+        {blocked, models.StatusCompleted, "[Get quotes]"},
+        {blocked, models.StatusPending, ""},
+        {free, models.StatusCompleted, ""},
+        {&models.Task{Title: "New"}, models.StatusCompleted, ""},
+    } {
+        err := CheckNotBlocked(db, tc.task, tc.status)
+
+        var blockedErr *BlockedError
+        if tc.blockedBy == "" {
+            if err != nil {
+                t.Errorf("%s to %s: got %v, want allowed", tc.task.Title, tc.status, err)
+            }
+            continue
+        }
+        if !errors.As(err, &blockedErr) {
+            t.Errorf("%s to %s: got %v, want a BlockedError", tc.task.Title, tc.status, err)
+            continue
+        }
+        titles := make([]string, len(blockedErr.BlockedBy))
+        for i, ref := range blockedErr.BlockedBy {
+            titles[i] = ref.Title
+        }
+        if fmt.Sprint(titles) != tc.blockedBy {
+            t.Errorf("%s to %s: got blocked by %v, want %s", tc.task.Title, tc.status, titles, tc.blockedBy)
+        }
+    }
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+    "errors"
+    "taskflow/internal/models"
+
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+)
+
+var (
+    ErrLabelExists   = errors.New("a label with this name already exists")
+    ErrLabelNotFound = errors.New("label not found")
+)
+
+// FindLabelByName looks up a label of a space by name, ignoring case. It
+// returns nil when there is none.
+func FindLabelByName(db *gorm.DB, space Space, name string) (*models.Label, error) {
+    var label models.Label
+    err := space.Scope(db).Where("LOWER(name) = LOWER(?)", name).First(&label).Error
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &label, nil
+}
+
+// SetTaskLabels replaces the labels of a task. Every label has to be in the
+// task's space.
+func SetTaskLabels(tx *gorm.DB, task *models.Task, labelIDs []uint) error {
+    if len(labelIDs) > 0 {
+        var owned int64
+        err := TaskSpace(task).Scope(tx.Model(&models.Label{})).Where("id IN ?", labelIDs).Count(&owned).Error
+        if err != nil {
+            return err
+        }
+        if int(owned) != len(uniqueIDs(labelIDs)) {
+            return ErrLabelNotFound
+        }
+    }
+
+    query := tx.Where("task_id = ?", task.ID)
+    if len(labelIDs) > 0 {
+        query = query.Where("label_id NOT IN ?", labelIDs)
+    }
+    if err := query.Delete(&models.TaskLabel{}).Error; err != nil {
+        return err
+    }
+    return attachLabel(tx, []uint{task.ID}, labelIDs...)
+}
+
+// AddTaskLabel attaches a label of the task's space to it. Attaching it
+// again does nothing.
+func AddTaskLabel(db *gorm.DB, task *models.Task, label *models.Label) error {
+    return attachLabel(db, []uint{task.ID}, label.ID)
+}
+
+// MergeLabel moves the tasks of label from onto label into and deletes
+// from, in one go so no task is left without either.
+func MergeLabel(tx *gorm.DB, from, into *models.Label) error {
+    var taskIDs []uint
+    if err := tx.Model(&models.TaskLabel{}).Where("label_id = ?", from.ID).Pluck("task_id", &taskIDs).Error; err != nil {
+        return err
+    }
+    if err := attachLabel(tx, taskIDs, into.ID); err != nil {
+        return err
+    }
+    return DeleteLabel(tx, from)
+}
+
+// DeleteLabel deletes a label and detaches it from its tasks.
+func DeleteLabel(tx *gorm.DB, label *models.Label) error {
+    if err := tx.Where("label_id = ?", label.ID).Delete(&models.TaskLabel{}).Error; err != nil {
+        return err
+    }
+    return tx.Delete(label).Error
+}
+
+// attachLabel links every task to every label, skipping existing links.
+func attachLabel(tx *gorm.DB, taskIDs []uint, labelIDs ...uint) error {
+    var links []models.TaskLabel
+    for _, taskID := range taskIDs {
+        for _, labelID := range uniqueIDs(labelIDs) {
+            links = append(links, models.TaskLabel{TaskID: taskID, LabelID: labelID})
+        }
+    }
+    if len(links) == 0 {
+        return nil
+    }
+    return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&links).Error
+}
+
+func uniqueIDs(ids []uint) []uint {
+    seen := make(map[uint]bool, len(ids))
+    var unique []uint
+    for _, id := range ids {
+        if !seen[id] {
+            seen[id] = true
+            unique = append(unique, id)
+        }
+    }
+    return unique
+}
+
+// LoadTaskLabels fills in the Labels of tasks, sorted by name.
+func LoadTaskLabels(db *gorm.DB, tasks []models.Task) error {
+    if len(tasks) == 0 {
+        return nil
+    }
+
+    ids := make([]uint, len(tasks))
+    for i := range tasks {
+        ids[i] = tasks[i].ID
+    }
+
+    var rows []struct {
+        TaskID uint
+        ID     uint
+        Name   string
+        Color  string
+    }
+    err := db.Table("task_labels").
+        Select("task_labels.task_id, labels.id, labels.name, labels.color").
+        Joins("JOIN labels ON labels.id = task_labels.label_id").
+        Where("task_labels.task_id IN ?", ids).
+        Order("labels.name").
+        Scan(&rows).Error
+    if err != nil {
+        return err
+    }
+
+    labels := make(map[uint][]models.LabelRef)
+    for _, row := range rows {
+        labels[row.TaskID] = append(labels[row.TaskID], models.LabelRef{
+            ID:    row.ID,
+            Name:  row.Name,
+            Color: row.Color,
+        })
+    }
+    for i := range tasks {
+        tasks[i].Labels = labels[tasks[i].ID]
+    }
+    return nil
+}
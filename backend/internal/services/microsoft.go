@@ -0,0 +1,497 @@
+package services
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "os"
+    "time"
+    "taskflow/internal/ical"
+    "taskflow/internal/models"
+
+    "golang.org/x/oauth2"
+    "golang.org/x/oauth2/microsoft"
+    "gorm.io/gorm"
+)
+
+const graphBaseURL = "https://graph.microsoft.com/v1.0"
+
+var (
+    microsoftOAuthConfig = &oauth2.Config{
+        ClientID:     os.Getenv("MICROSOFT_CLIENT_ID"),
+        ClientSecret: os.Getenv("MICROSOFT_CLIENT_SECRET"),
+        RedirectURL:  os.Getenv("MICROSOFT_REDIRECT_URL"),
+        Scopes: []string{
+            "offline_access",
+            "Calendars.ReadWrite",
+        },
+        Endpoint: microsoft.AzureADEndpoint("common"),
+    }
+)
+
+// How far around now the initial Graph delta listing looks, Graph requires
+// a bounded calendar view.
+const (
+    graphDeltaPast   = 30 * 24 * time.Hour
+    graphDeltaFuture = 365 * 24 * time.Hour
+)
+
+// MicrosoftCalendarProvider writes events to Outlook / Microsoft 365
+// calendars through Microsoft Graph. An empty calendar ID means the
+// account's default calendar.
+type MicrosoftCalendarProvider struct {
+    config *oauth2.Config
+    db     *gorm.DB
+}
+
+func NewMicrosoftCalendarProvider(db *gorm.DB) *MicrosoftCalendarProvider {
+    return &MicrosoftCalendarProvider{
+        config: microsoftOAuthConfig,
+        db:     db,
+    }
+}
+
+func (p *MicrosoftCalendarProvider) Name() string {
+    return ProviderMicrosoft
+}
+
+func (p *MicrosoftCalendarProvider) AuthURL(state string) string {
+    return p.config.AuthCodeURL(state)
+}
+
+func (p *MicrosoftCalendarProvider) Connect(ctx context.Context, params ConnectParams) (string, string, error) {
+    token, err := p.config.Exchange(ctx, params.Code)
+    if err != nil {
+        return "", "", fmt.Errorf("unable to exchange code: %w", err)
+    }
+
+    credentials, err := oauthTokenJSON(token)
+    return credentials, params.CalendarID, err
+}
+
+type graphDateTime struct {
+    DateTime string `json:"dateTime"`
+    TimeZone string `json:"timeZone"`
+}
+
+type graphEvent struct {
+    ID                         string           `json:"id,omitempty"`
+    ETag                       string           `json:"@odata.etag,omitempty"`
+    TransactionID              string           `json:"transactionId,omitempty"`
+    Subject                    string           `json:"subject"`
+    Body                       *graphBody       `json:"body,omitempty"`
+    Start                      *graphDateTime   `json:"start,omitempty"`
+    End                        *graphDateTime   `json:"end,omitempty"`
+    IsAllDay                   bool             `json:"isAllDay"`
+    IsReminderOn               bool             `json:"isReminderOn"`
+    ReminderMinutesBeforeStart int64            `json:"reminderMinutesBeforeStart"`
+    Recurrence                 *graphRecurrence `json:"recurrence"`
+    LastModifiedDateTime       string           `json:"lastModifiedDateTime,omitempty"`
+    Removed                    *struct{}        `json:"@removed,omitempty"`
+}
+
+// graphRecurrence is Graph's patternedRecurrence. Recurrence is always
+// sent, null turning an event that stopped repeating back into a single
+// one.
+type graphRecurrence struct {
+    Pattern graphRecurrencePattern `json:"pattern"`
+    Range   graphRecurrenceRange   `json:"range"`
+}
+
+type graphRecurrencePattern struct {
+    Type           string   `json:"type"`
+    Interval       int      `json:"interval"`
+    DaysOfWeek     []string `json:"daysOfWeek,omitempty"`
+    DayOfMonth     int      `json:"dayOfMonth,omitempty"`
+    Month          int      `json:"month,omitempty"`
+    Index          string   `json:"index,omitempty"`
+    FirstDayOfWeek string   `json:"firstDayOfWeek,omitempty"`
+}
+
+type graphRecurrenceRange struct {
+    Type                string `json:"type"`
+    StartDate           string `json:"startDate"`
+    EndDate             string `json:"endDate,omitempty"`
+    NumberOfOccurrences int    `json:"numberOfOccurrences,omitempty"`
+    RecurrenceTimeZone  string `json:"recurrenceTimeZone,omitempty"`
+}
+
+var (
+    graphWeekdays = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+    graphIndexes  = map[int]string{1: "first", 2: "second", 3: "third", 4: "fourth", -1: "last"}
+)
+
+type graphBody struct {
+    ContentType string `json:"contentType"`
+    Content     string `json:"content"`
+}
+
+// graphLayout is Graph's dateTime format, interpreted in the sibling
+// timeZone. TaskFlow always sends UTC.
+const graphLayout = "2006-01-02T15:04:05.0000000"
+
+func buildGraphEvent(opts EventOptions, event *CalendarEvent) *graphEvent {
+    graph := &graphEvent{
+        Subject:  event.Title,
+        Body:     &graphBody{ContentType: "text", Content: event.Description},
+        Start:    &graphDateTime{DateTime: event.Start.UTC().Format(graphLayout), TimeZone: "UTC"},
+        End:      &graphDateTime{DateTime: event.End.UTC().Format(graphLayout), TimeZone: "UTC"},
+        IsAllDay: event.AllDay,
+    }
+    graph.Recurrence = buildGraphRecurrence(opts, event)
+
+    // Graph events carry a single reminder, use the earliest one
+    for _, reminder := range eventReminders(opts) {
+        if !graph.IsReminderOn || reminder.Minutes > graph.ReminderMinutesBeforeStart {
+            graph.IsReminderOn = true
+            graph.ReminderMinutesBeforeStart = reminder.Minutes
+        }
+    }
+
+    return graph
+}
+
+// buildGraphRecurrence converts the event's RRULE to a Graph pattern. Rules
+// Graph has no pattern for, several days of the month for instance, give
+// nil and the event is sent as a single one.
+func buildGraphRecurrence(opts EventOptions, event *CalendarEvent) *graphRecurrence {
+    if len(event.Recurrence) == 0 {
+        return nil
+    }
+    rule, err := ical.ParseRRule(event.Recurrence[0])
+    if err != nil {
+        return nil
+    }
+
+    // Patterns are expanded in recurrenceTimeZone, the days of timed events
+    // are the user's
+    start, timeZone := event.Start, "UTC"
+    if !event.AllDay {
+        if loc, err := time.LoadLocation(opts.TimeZone); err == nil {
+            start, timeZone = start.In(loc), opts.TimeZone
+        }
+    }
+
+    pattern := graphRecurrencePattern{Interval: rule.Interval}
+    switch rule.Freq {
+    case ical.FreqDaily:
+        if len(rule.ByDay) > 0 || len(rule.ByMonthDay) > 0 || len(rule.ByMonth) > 0 {
+            return nil
+        }
+        pattern.Type = "daily"
+    case ical.FreqWeekly:
+        if len(rule.ByMonth) > 0 {
+            return nil
+        }
+        pattern.Type = "weekly"
+        pattern.FirstDayOfWeek = "monday"
+        days := rule.ByDay
+        if len(days) == 0 {
+            days = []ical.RuleDay{{Day: start.Weekday()}}
+        }
+        for _, day := range days {
+            pattern.DaysOfWeek = append(pattern.DaysOfWeek, graphWeekdays[day.Day])
+        }
+    default:
+        kind := "Monthly"
+        if rule.Freq == ical.FreqYearly {
+            // Numbered days count within the year without BYMONTH, Graph
+            // only counts within a month
+            if len(rule.ByMonth) > 1 || len(rule.ByMonth) == 0 && len(rule.ByDay) > 0 {
+                return nil
+            }
+            kind = "Yearly"
+            pattern.Month = int(start.Month())
+            if len(rule.ByMonth) == 1 {
+                pattern.Month = int(rule.ByMonth[0])
+            }
+        } else if len(rule.ByMonth) > 0 {
+            return nil
+        }
+
+        switch {
+        case len(rule.ByDay) > 0 && len(rule.ByMonthDay) == 0:
+            n := rule.ByDay[0].N
+            if graphIndexes[n] == "" {
+                return nil
+            }
+            for _, day := range rule.ByDay {
+                if day.N != n {
+                    return nil
+                }
+                pattern.DaysOfWeek = append(pattern.DaysOfWeek, graphWeekdays[day.Day])
+            }
+            pattern.Type = "relative" + kind
+            pattern.Index = graphIndexes[n]
+        case len(rule.ByDay) == 0 && len(rule.ByMonthDay) <= 1:
+            pattern.Type = "absolute" + kind
+            pattern.DayOfMonth = start.Day()
+            if len(rule.ByMonthDay) == 1 {
+                if rule.ByMonthDay[0] < 0 {
+                    return nil
+                }
+                pattern.DayOfMonth = rule.ByMonthDay[0]
+            }
+        default:
+            return nil
+        }
+    }
+
+    recurrence := &graphRecurrence{
+        Pattern: pattern,
+        Range: graphRecurrenceRange{
+            Type:               "noEnd",
+            StartDate:          start.Format("2006-01-02"),
+            RecurrenceTimeZone: timeZone,
+        },
+    }
+    switch {
+    case rule.Count > 0:
+        recurrence.Range.Type = "numbered"
+        recurrence.Range.NumberOfOccurrences = rule.Count
+    case !rule.Until.IsZero():
+        recurrence.Range.Type = "endDate"
+        recurrence.Range.EndDate = rule.Until.In(start.Location()).Format("2006-01-02")
+        if rule.UntilDate {
+            recurrence.Range.EndDate = rule.Until.Format("2006-01-02")
+        }
+    }
+    return recurrence
+}
+
+func fromGraphEvent(calendarID string, graph *graphEvent) CalendarEvent {
+    event := CalendarEvent{
+        ID:         graph.ID,
+        CalendarID: calendarID,
+        Title:      graph.Subject,
+        AllDay:     graph.IsAllDay,
+        ETag:       graph.ETag,
+        Deleted:    graph.Removed != nil,
+    }
+    if graph.Body != nil && graph.Body.ContentType == "text" {
+        event.Description = graph.Body.Content
+    }
+    if graph.Start != nil {
+        event.Start = parseGraphTime(graph.Start)
+    }
+    if graph.End != nil {
+        event.End = parseGraphTime(graph.End)
+    }
+    event.Updated, _ = time.Parse(time.RFC3339, graph.LastModifiedDateTime)
+    return event
+}
+
+func parseGraphTime(value *graphDateTime) time.Time {
+    loc := time.UTC
+    if l, err := time.LoadLocation(value.TimeZone); err == nil {
+        loc = l
+    }
+    t, _ := time.ParseInLocation(graphLayout, value.DateTime, loc)
+    return t
+}
+
+func graphEventsPath(calendarID string) string {
+    if calendarID == "" {
+        return "/me/events"
+    }
+    return "/me/calendars/" + url.PathEscape(calendarID) + "/events"
+}
+
+// CreateEvent posts a new event. event.ID is sent as transactionId, which
+// Graph uses to drop duplicate creates on retries.
+func (p *MicrosoftCalendarProvider) CreateEvent(ctx context.Context, conn *models.CalendarConnection, opts EventOptions, event *CalendarEvent) (*CalendarEvent, error) {
+    graph := buildGraphEvent(opts, event)
+    graph.TransactionID = event.ID
+
+    var created graphEvent
+    status, err := p.request(ctx, conn, http.MethodPost, graphBaseURL+graphEventsPath(event.CalendarID), graph, &created)
+    if err != nil {
+        return nil, err
+    }
+    if status != http.StatusCreated && status != http.StatusOK {
+        return nil, fmt.Errorf("unable to create event: status %d", status)
+    }
+
+    result := fromGraphEvent(event.CalendarID, &created)
+    return &result, nil
+}
+
+func (p *MicrosoftCalendarProvider) UpdateEvent(ctx context.Context, conn *models.CalendarConnection, opts EventOptions, event *CalendarEvent) (*CalendarEvent, error) {
+    var updated graphEvent
+    status, err := p.request(ctx, conn, http.MethodPatch, graphBaseURL+"/me/events/"+url.PathEscape(event.ID), buildGraphEvent(opts, event), &updated)
+    if err != nil {
+        return nil, err
+    }
+    if status == http.StatusNotFound {
+        return nil, ErrEventNotFound
+    }
+    if status != http.StatusOK {
+        return nil, fmt.Errorf("unable to update event: status %d", status)
+    }
+
+    result := fromGraphEvent(event.CalendarID, &updated)
+    return &result, nil
+}
+
+func (p *MicrosoftCalendarProvider) DeleteEvent(ctx context.Context, conn *models.CalendarConnection, calendarID, eventID string) error {
+    status, err := p.request(ctx, conn, http.MethodDelete, graphBaseURL+"/me/events/"+url.PathEscape(eventID), nil, nil)
+    if err != nil {
+        return err
+    }
+
+    // Already gone on Microsoft's side, nothing left to do
+    if status == http.StatusNotFound {
+        return nil
+    }
+    if status != http.StatusNoContent && status != http.StatusOK {
+        return fmt.Errorf("unable to delete event: status %d", status)
+    }
+    return nil
+}
+
+func (p *MicrosoftCalendarProvider) GetEvent(ctx context.Context, conn *models.CalendarConnection, calendarID, eventID string) (*CalendarEvent, error) {
+    var graph graphEvent
+    status, err := p.request(ctx, conn, http.MethodGet, graphBaseURL+"/me/events/"+url.PathEscape(eventID), nil, &graph)
+    if err != nil {
+        return nil, err
+    }
+    if status == http.StatusNotFound {
+        return nil, ErrEventNotFound
+    }
+    if status != http.StatusOK {
+        return nil, fmt.Errorf("unable to get event: status %d", status)
+    }
+
+    event := fromGraphEvent(calendarID, &graph)
+    return &event, nil
+}
+
+func (p *MicrosoftCalendarProvider) ListEvents(ctx context.Context, conn *models.CalendarConnection, calendarID string, start, end time.Time) ([]CalendarEvent, error) {
+    base := "/me/calendarView"
+    if calendarID != "" {
+        base = "/me/calendars/" + url.PathEscape(calendarID) + "/calendarView"
+    }
+    query := url.Values{}
+    query.Set("startDateTime", start.UTC().Format(time.RFC3339))
+    query.Set("endDateTime", end.UTC().Format(time.RFC3339))
+    query.Set("$top", "250")
+
+    var events []CalendarEvent
+    next := graphBaseURL + base + "?" + query.Encode()
+    for next != "" {
+        var page struct {
+            Value    []graphEvent `json:"value"`
+            NextLink string       `json:"@odata.nextLink"`
+        }
+
+        status, err := p.request(ctx, conn, http.MethodGet, next, nil, &page)
+        if err != nil {
+            return nil, err
+        }
+        if status != http.StatusOK {
+            return nil, fmt.Errorf("unable to list events: status %d", status)
+        }
+
+        for i := range page.Value {
+            events = append(events, fromGraphEvent(calendarID, &page.Value[i]))
+        }
+        next = page.NextLink
+    }
+
+    return events, nil
+}
+
+// ListChanges follows Graph's calendarView delta query. The sync token is
+// the deltaLink returned by the previous listing.
+func (p *MicrosoftCalendarProvider) ListChanges(ctx context.Context, conn *models.CalendarConnection, calendarID, syncToken string) (*EventChanges, error) {
+    next := syncToken
+    if next == "" {
+        base := "/me/calendarView/delta"
+        if calendarID != "" {
+            base = "/me/calendars/" + url.PathEscape(calendarID) + "/calendarView/delta"
+        }
+        now := time.Now().UTC()
+        query := url.Values{}
+        query.Set("startDateTime", now.Add(-graphDeltaPast).Format(time.RFC3339))
+        query.Set("endDateTime", now.Add(graphDeltaFuture).Format(time.RFC3339))
+        next = graphBaseURL + base + "?" + query.Encode()
+    }
+
+    changes := &EventChanges{}
+    for next != "" {
+        var page struct {
+            Value     []graphEvent `json:"value"`
+            NextLink  string       `json:"@odata.nextLink"`
+            DeltaLink string       `json:"@odata.deltaLink"`
+        }
+
+        status, err := p.request(ctx, conn, http.MethodGet, next, nil, &page)
+        if err != nil {
+            return nil, err
+        }
+        // Graph expires delta tokens with 410 Gone
+        if status == http.StatusGone && syncToken != "" {
+            return nil, ErrSyncTokenExpired
+        }
+        if status != http.StatusOK {
+            return nil, fmt.Errorf("unable to list changes: status %d", status)
+        }
+
+        for i := range page.Value {
+            changes.Events = append(changes.Events, fromGraphEvent(calendarID, &page.Value[i]))
+        }
+
+        next = page.NextLink
+        if page.DeltaLink != "" {
+            changes.NextSyncToken = page.DeltaLink
+        }
+    }
+
+    return changes, nil
+}
+
+// request sends a JSON request with the connection's token and decodes a
+// successful response into out. Non 2xx statuses are returned, not errors.
+func (p *MicrosoftCalendarProvider) request(ctx context.Context, conn *models.CalendarConnection, method, target string, in, out interface{}) (int, error) {
+    tokenSource, err := newConnectionTokenSource(p.db, p.config, conn)
+    if err != nil {
+        return 0, err
+    }
+
+    client := oauth2.NewClient(ctx, tokenSource)
+    client.Timeout = calendarRequestTimeout
+
+    var body io.Reader
+    if in != nil {
+        data, err := json.Marshal(in)
+        if err != nil {
+            return 0, err
+        }
+        body = bytes.NewReader(data)
+    }
+
+    req, err := http.NewRequestWithContext(ctx, method, target, body)
+    if err != nil {
+        return 0, err
+    }
+    if in != nil {
+        req.Header.Set("Content-Type", "application/json")
+    }
+
+    resp, err := client.Do(req)
+    if err != nil {
+        return 0, err
+    }
+    defer resp.Body.Close()
+
+    if out != nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+        if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+            return 0, fmt.Errorf("unable to parse Graph response: %w", err)
+        }
+    }
+    return resp.StatusCode, nil
+}
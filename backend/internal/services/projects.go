@@ -0,0 +1,93 @@
+package services
+
+import (
+    "errors"
+    "taskflow/internal/models"
+
+    "gorm.io/gorm"
+)
+
+var (
+    ErrProjectNotFound = errors.New("project not found")
+    ErrProjectArchived = errors.New("tasks can't be added to an archived project")
+    ErrSubtaskProject  = errors.New("subtasks are in their parent's project")
+)
+
+// ValidateProject checks that tasks of a space may be put in a project: it
+// is in the same space and isn't archived.
+func ValidateProject(db *gorm.DB, space Space, projectID uint) error {
+    var project models.Project
+    err := space.Scope(db.Select("id", "archived")).Where("id = ?", projectID).First(&project).Error
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return ErrProjectNotFound
+    }
+    if err != nil {
+        return err
+    }
+    if project.Archived {
+        return ErrProjectArchived
+    }
+    return nil
+}
+
+// ParentProject is the project of a parent task, the one its subtasks are
+// in.
+func ParentProject(db *gorm.DB, parentID uint) (*uint, error) {
+    var parent models.Task
+    if err := db.Select("id", "project_id").First(&parent, parentID).Error; err != nil {
+        return nil, err
+    }
+    return parent.ProjectID, nil
+}
+
+// MoveSubtasks puts the subtasks of a task, and theirs, in the task's
+// project after it moved.
+func MoveSubtasks(tx *gorm.DB, task *models.Task) error {
+    level := []uint{task.ID}
+    for len(level) > 0 {
+        var children []models.Task
+        if err := tx.Select("id", "project_id").Where("parent_id IN ?", level).Find(&children).Error; err != nil {
+            return err
+        }
+
+        level = level[:0]
+        var moved []uint
+        for _, child := range children {
+            level = append(level, child.ID)
+            if !sameID(child.ProjectID, task.ProjectID) {
+                moved = append(moved, child.ID)
+            }
+        }
+        if len(moved) == 0 {
+            continue
+        }
+
+        err := tx.Model(&models.Task{}).Where("id IN ?", moved).Updates(map[string]interface{}{
+            "project_id": task.ProjectID,
+            "version":    gorm.Expr("version + 1"),
+        }).Error
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// DeleteProject deletes a project. Its tasks are kept, without a project.
+func DeleteProject(tx *gorm.DB, project *models.Project) error {
+    err := tx.Model(&models.Task{}).Where("project_id = ?", project.ID).Updates(map[string]interface{}{
+        "project_id": nil,
+        "version":    gorm.Expr("version + 1"),
+    }).Error
+    if err != nil {
+        return err
+    }
+    return tx.Delete(project).Error
+}
+
+func sameID(a, b *uint) bool {
+    if a == nil || b == nil {
+        return a == b
+    }
+    return *a == *b
+}
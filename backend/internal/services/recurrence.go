@@ -0,0 +1,249 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "time"
+    "taskflow/internal/ical"
+    "taskflow/internal/models"
+
+    "gorm.io/gorm"
+)
+
+var (
+    ErrRecurrenceNeedsDueDate = errors.New("recurring tasks need a due date")
+    ErrNotRecurring           = errors.New("the task doesn't repeat")
+    ErrSeriesEnded            = errors.New("this is the last occurrence of the series")
+    ErrOccurrenceCompleted    = errors.New("completed occurrences can't be skipped")
+)
+
+// RecurrenceError is a recurrence rule TaskFlow can't read.
+type RecurrenceError struct {
+    Err error
+}
+
+func (e *RecurrenceError) Error() string {
+    return fmt.Sprintf("invalid recurrence: %v", e.Err)
+}
+
+func (e *RecurrenceError) Unwrap() error {
+    return e.Err
+}
+
+// NormalizeRecurrence checks a recurrence rule and returns it in the form
+// it is stored in, without the "RRULE:" prefix. An empty rule stays empty.
+func NormalizeRecurrence(rule string) (string, error) {
+    if rule == "" {
+        return "", nil
+    }
+
+    parsed, err := ical.ParseRRule(rule)
+    if err != nil {
+        return "", &RecurrenceError{Err: err}
+    }
+    return parsed.String(), nil
+}
+
+// NextOccurrence creates the occurrence following a completed recurring
+// task in the same transaction and returns it. It returns nil when the task
+// doesn't repeat, isn't completed, the series is over or the next
+// occurrence already exists, so completing a task again after reopening it
+// doesn't repeat it twice.
+func NextOccurrence(tx *gorm.DB, task *models.Task) (*models.Task, error) {
+    if task.Status != models.StatusCompleted {
+        return nil, nil
+    }
+    return createNextOccurrence(tx, task, time.Now())
+}
+
+// SkipOccurrence creates the occurrence following a recurring task and
+// deletes the task, subtasks included, as if it had been done.
+func SkipOccurrence(tx *gorm.DB, task *models.Task) (*models.Task, error) {
+    if task.Recurrence == "" {
+        return nil, ErrNotRecurring
+    }
+    if task.Status == models.StatusCompleted {
+        return nil, ErrOccurrenceCompleted
+    }
+
+    next, err := createNextOccurrence(tx, task, time.Now())
+    if err != nil {
+        return nil, err
+    }
+    if next == nil {
+        return nil, ErrSeriesEnded
+    }
+
+    result := tx.Where("version = ?", task.Version).Delete(task)
+    if result.Error != nil {
+        return nil, result.Error
+    }
+    if result.RowsAffected == 0 {
+        return nil, ErrTaskVersionConflict
+    }
+    if err := DeleteSubtasks(tx, task); err != nil {
+        return nil, err
+    }
+    if err := EnqueueTaskSync(tx, task); err != nil {
+        return nil, err
+    }
+    return next, nil
+}
+
+func createNextOccurrence(tx *gorm.DB, task *models.Task, doneAt time.Time) (*models.Task, error) {
+    if task.Recurrence == "" || task.DueDate == nil {
+        return nil, nil
+    }
+
+    rule, err := ical.ParseRRule(task.Recurrence)
+    if err != nil {
+        return nil, &RecurrenceError{Err: err}
+    }
+    if rule.Count > 0 && task.Occurrence >= rule.Count {
+        return nil, nil
+    }
+
+    seriesID := task.ID
+    if task.SeriesID != nil {
+        seriesID = *task.SeriesID
+    }
+    var existing int64
+    err = tx.Unscoped().Model(&models.Task{}).
+        Where("series_id = ? AND occurrence = ?", seriesID, task.Occurrence+1).
+        Count(&existing).Error
+    if err != nil || existing > 0 {
+        return nil, err
+    }
+
+    var user models.User
+    if err := tx.Select("id", "timezone").First(&user, task.UserID).Error; err != nil {
+        return nil, err
+    }
+    due, ok := nextDueDate(task, rule, &user, doneAt)
+    if !ok {
+        return nil, nil
+    }
+
+    next := &models.Task{
+        Title:                task.Title,
+        Description:          task.Description,
+        Status:               TaskWorkflow().Initial,
+        Priority:             task.Priority,
+        DueDate:              &due,
+        DueDateAllDay:        task.DueDateAllDay,
+        ParentID:             task.ParentID,
+        ProjectID:            task.ProjectID,
+        WorkspaceID:          task.WorkspaceID,
+        AssigneeID:           task.AssigneeID,
+        CompleteWithSubtasks: task.CompleteWithSubtasks,
+        Recurrence:           task.Recurrence,
+        RecurFrom:            task.RecurFrom,
+        SeriesID:             &seriesID,
+        Occurrence:           task.Occurrence + 1,
+        UserID:               task.UserID,
+    }
+    if err := SaveTask(tx, next); err != nil {
+        return nil, err
+    }
+
+    // The checklist starts over on every occurrence
+    var items []models.ChecklistItem
+    if err := tx.Where("task_id = ?", task.ID).Order("position, id").Find(&items).Error; err != nil {
+        return nil, err
+    }
+    for i := range items {
+        items[i] = models.ChecklistItem{TaskID: next.ID, Title: items[i].Title, Position: items[i].Position}
+    }
+    if len(items) > 0 {
+        if err := tx.Create(&items).Error; err != nil {
+            return nil, err
+        }
+    }
+
+    // Watchers follow the series
+    var watchers []models.TaskWatcher
+    if err := tx.Where("task_id = ?", task.ID).Find(&watchers).Error; err != nil {
+        return nil, err
+    }
+    for i := range watchers {
+        watchers[i] = models.TaskWatcher{TaskID: next.ID, UserID: watchers[i].UserID}
+    }
+    if len(watchers) > 0 {
+        if err := tx.Create(&watchers).Error; err != nil {
+            return nil, err
+        }
+    }
+
+    if err := EnqueueTaskSync(tx, next); err != nil {
+        return nil, err
+    }
+    return next, nil
+}
+
+// nextDueDate finds the due date of the occurrence after task. Dates are
+// worked out in the user's time zone, or in UTC for date-only due dates,
+// so weekdays and months are the ones the user sees. Repeating from the
+// completion counts from the day doneAt falls on, at the due date's time.
+func nextDueDate(task *models.Task, rule *ical.RRule, user *models.User, doneAt time.Time) (time.Time, bool) {
+    loc := time.UTC
+    if !task.DueDateAllDay {
+        loc = UserLocation(user)
+    }
+
+    due := task.DueDate.In(loc)
+    start := due
+    if task.RecurFrom == models.RecurFromCompletion {
+        done := doneAt.In(loc)
+        start = time.Date(done.Year(), done.Month(), done.Day(), due.Hour(), due.Minute(), due.Second(), 0, loc)
+    }
+
+    next, ok := rule.Next(start, start)
+    if !ok {
+        return time.Time{}, false
+    }
+    if !task.DueDateAllDay {
+        next = next.UTC()
+    }
+    return next, true
+}
+
+// eventRecurrence is the recurrence of the events rendering task: the
+// occurrences still to come of an open task repeating from its due date.
+// Tasks repeating from their completion don't have known dates ahead, and
+// a completed task's next occurrence renders the rest of the series.
+func eventRecurrence(task *models.Task) []string {
+    if task.Recurrence == "" || task.RecurFrom == models.RecurFromCompletion || task.Status == models.StatusCompleted {
+        return nil
+    }
+
+    rule, err := ical.ParseRRule(task.Recurrence)
+    if err != nil {
+        return nil
+    }
+    if rule.Count > 0 {
+        // The task is the first of the events, occurrences before it are
+        // done
+        rule.Count -= task.Occurrence - 1
+        if rule.Count < 1 {
+            return nil
+        }
+    }
+    return []string{"RRULE:" + rule.String()}
+}
+
+// applyRecurrence sets the recurrence of task from an RRULE sent back by a
+// client, the inverse of eventRecurrence. Rules TaskFlow can't read are
+// ignored.
+func applyRecurrence(task *models.Task, value string) {
+    rule, err := ical.ParseRRule(value)
+    if err != nil {
+        return
+    }
+    if rule.Count > 0 {
+        rule.Count += task.Occurrence - 1
+    }
+    task.Recurrence = rule.String()
+    if task.RecurFrom == "" {
+        task.RecurFrom = models.RecurFromDue
+    }
+}
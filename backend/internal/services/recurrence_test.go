@@ -0,0 +1,125 @@
+package services
+
+import (
+    "errors"
+    "testing"
+    "time"
+    "taskflow/internal/ical"
+    "taskflow/internal/models"
+
+    "gorm.io/gorm"
+)
+
+func TestNextDueDate(t *testing.T) {
+    user := &models.User{Timezone: "America/Sao_Paulo"}
+    saoPaulo := UserLocation(user)
+    due := time.Date(2026, 10, 20, 9, 0, 0, 0, saoPaulo)
+    // Late on Friday in São Paulo, already Saturday in UTC
+    doneAt := time.Date(2026, 10, 23, 23, 30, 0, 0, saoPaulo)
+
+    for _, tc := range []struct {
+        name string
+        task models.Task
+        rule string
+        want time.Time
+    }{
+        {
+            "from the due date", models.Task{RecurFrom: models.RecurFromDue}, "FREQ=WEEKLY",
+            time.Date(2026, 10, 27, 9, 0, 0, 0, saoPaulo),
+        },
+        {
+            "from the completion day", models.Task{RecurFrom: models.RecurFromCompletion}, "FREQ=WEEKLY",
+            time.Date(2026, 10, 30, 9, 0, 0, 0, saoPaulo),
+        },
+        {
+            "from the completion day with an interval", models.Task{RecurFrom: models.RecurFromCompletion}, "FREQ=DAILY;INTERVAL=3",
+            time.Date(2026, 10, 26, 9, 0, 0, 0, saoPaulo),
+        },
+        {
+            "all day from the completion, in UTC", models.Task{RecurFrom: models.RecurFromCompletion, DueDateAllDay: true}, "FREQ=DAILY",
+            time.Date(2026, 10, 25, 12, 0, 0, 0, time.UTC),
+        },
+    } {
+        task := tc.task
+        taskDue := due
+        if task.DueDateAllDay {
+            taskDue = time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC)
+        }
+        task.DueDate = &taskDue
+
+        rule, err := ical.ParseRRule(tc.rule)
+        if err != nil {
+            t.Fatal(err)
+        }
+        got, ok := nextDueDate(&task, rule, user, doneAt)
+        if !ok || !got.Equal(tc.want) {
+            t.Errorf("%s: got %v, %v, want %v", tc.name, got, ok, tc.want)
+        }
+    }
+}
+
+func TestNextOccurrenceStopsAtCount(t *testing.T) {
+    db := newTestDB(t, &models.User{}, &models.Task{}, &models.SyncJob{}, &models.CalendarConnection{},
+        &models.TaskEventMapping{}, &models.WorkspaceMember{}, &models.ChecklistItem{}, &models.TaskWatcher{})
+    if err := db.Create(&models.User{ID: 1, Email: "ana@example.com", Timezone: "UTC"}).Error; err != nil {
+        t.Fatal(err)
+    }
+
+    due := time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)
+    task := createTask(t, db, models.Task{Title: "Stretch", DueDate: &due, Recurrence: "FREQ=DAILY;COUNT=3", Occurrence: 1})
+
+    var dues []string
+    for task != nil {
+        var next *models.Task
+        err := db.Transaction(func(tx *gorm.DB) error {
+            task.Status = models.StatusCompleted
+            if err := SaveTask(tx, task); err != nil {
+                return err
+            }
+            var err error
+            next, err = NextOccurrence(tx, task)
+            return err
+        })
+        if err != nil {
+            t.Fatal(err)
+        }
+        dues = append(dues, task.DueDate.Format("01-02"))
+        task = next
+    }
+
+    if got := len(dues); got != 3 {
+        t.Fatalf("got %d occurrences (%v), want 3", got, dues)
+    }
+    if dues[2] != "10-22" {
+        t.Errorf("got last occurrence on %s, want 10-22", dues[2])
+    }
+
+    var last models.Task
+    if err := db.Where("occurrence = ?", 3).First(&last).Error; err != nil {
+        t.Fatal(err)
+    }
+    last.Status = models.StatusPending
+    if _, err := SkipOccurrence(db, &last); !errors.Is(err, ErrSeriesEnded) {
+        t.Errorf("skipping the last occurrence: got %v, want ErrSeriesEnded", err)
+    }
+}
+
+func TestNextOccurrenceIsCreatedOnce(t *testing.T) {
+    db := newTestDB(t, &models.User{}, &models.Task{}, &models.SyncJob{}, &models.CalendarConnection{},
+        &models.TaskEventMapping{}, &models.WorkspaceMember{}, &models.ChecklistItem{}, &models.TaskWatcher{})
+    if err := db.Create(&models.User{ID: 1, Email: "ana@example.com", Timezone: "UTC"}).Error; err != nil {
+        t.Fatal(err)
+    }
+
+    due := time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)
+    task := createTask(t, db, models.Task{Title: "Stretch", DueDate: &due, Recurrence: "FREQ=DAILY", Status: models.StatusCompleted, Occurrence: 1})
+    for i, want := range []bool{true, false} {
+        next, err := NextOccurrence(db, task)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if (next != nil) != want {
+            t.Errorf("completion %d: got %+v, want created %v", i+1, next, want)
+        }
+    }
+}
@@ -0,0 +1,218 @@
+package services
+
+import (
+    "errors"
+    "taskflow/internal/models"
+
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+)
+
+// MaxTaskDepth is how many levels tasks may be nested, a top-level task
+// being the first.
+const MaxTaskDepth = 3
+
+var (
+    ErrParentNotFound = errors.New("parent task not found")
+    ErrTaskCycle      = errors.New("a task can't be a subtask of itself or of its subtasks")
+    ErrTaskTooDeep    = errors.New("subtasks can only be nested 3 levels deep")
+)
+
+// ValidateParent checks that task may become a subtask of parentID: the
+// parent is in the same space, isn't the task or one of its subtasks,
+// and the task with its own subtasks fits within MaxTaskDepth below it.
+func ValidateParent(db *gorm.DB, task *models.Task, parentID uint) error {
+    depth := 1
+    for id := &parentID; id != nil; depth++ {
+        if task.ID != 0 && *id == task.ID {
+            return ErrTaskCycle
+        }
+        if depth > MaxTaskDepth {
+            return ErrTaskTooDeep
+        }
+
+        var parent models.Task
+        err := TaskSpace(task).Scope(db.Select("id", "parent_id")).Where("id = ?", *id).First(&parent).Error
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return ErrParentNotFound
+        }
+        if err != nil {
+            return err
+        }
+        id = parent.ParentID
+    }
+
+    // depth is now one past the parent's level; the task's own subtasks
+    // go below it
+    height, err := subtaskHeight(db, task)
+    if err != nil {
+        return err
+    }
+    if depth-1+height > MaxTaskDepth {
+        return ErrTaskTooDeep
+    }
+    return nil
+}
+
+// subtaskHeight counts the levels of a task and its subtasks.
+func subtaskHeight(db *gorm.DB, task *models.Task) (int, error) {
+    if task.ID == 0 {
+        return 1, nil
+    }
+
+    height := 1
+    level := []uint{task.ID}
+    for len(level) > 0 && height <= MaxTaskDepth {
+        var children []uint
+        if err := db.Model(&models.Task{}).Where("parent_id IN ?", level).Pluck("id", &children).Error; err != nil {
+            return 0, err
+        }
+        if len(children) > 0 {
+            height++
+        }
+        level = children
+    }
+    return height, nil
+}
+
+// AutoCompleteParent completes the parent of a completed subtask when the
+// parent asks for it and all its subtasks are now completed, then does the
+// same for the parent's parent. Parents the workflow doesn't let complete,
+// or that are blocked, are left alone.
+func AutoCompleteParent(tx *gorm.DB, task *models.Task) error {
+    if task.ParentID == nil || task.Status != models.StatusCompleted {
+        return nil
+    }
+
+    var parent models.Task
+    err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&parent, *task.ParentID).Error
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    if !parent.CompleteWithSubtasks || parent.Status == models.StatusCompleted {
+        return nil
+    }
+
+    var open int64
+    err = tx.Model(&models.Task{}).
+        Where("parent_id = ? AND status <> ?", parent.ID, models.StatusCompleted).
+        Count(&open).Error
+    if err != nil || open > 0 {
+        return err
+    }
+    if TaskWorkflow().CanTransition(parent.Status, models.StatusCompleted) != nil {
+        return nil
+    }
+    if err := CheckNotBlocked(tx, &parent, models.StatusCompleted); err != nil {
+        var blocked *BlockedError
+        if errors.As(err, &blocked) {
+            return nil
+        }
+        return err
+    }
+
+    parent.Status = models.StatusCompleted
+    if err := SaveTask(tx, &parent); err != nil {
+        return err
+    }
+    if err := EnqueueTaskSync(tx, &parent); err != nil {
+        return err
+    }
+    if err := AutoCompleteParent(tx, &parent); err != nil {
+        return err
+    }
+    _, err = NextOccurrence(tx, &parent)
+    return err
+}
+
+// DeleteSubtasks deletes the subtasks of a task being deleted, and theirs.
+func DeleteSubtasks(tx *gorm.DB, task *models.Task) error {
+    var children []models.Task
+    if err := tx.Where("parent_id = ?", task.ID).Find(&children).Error; err != nil {
+        return err
+    }
+
+    for i := range children {
+        child := &children[i]
+        if err := DeleteSubtasks(tx, child); err != nil {
+            return err
+        }
+        if err := tx.Delete(child).Error; err != nil {
+            return err
+        }
+        if err := EnqueueTaskSync(tx, child); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// LoadTaskProgress fills in the Progress of the tasks that have subtasks or
+// checklist items.
+func LoadTaskProgress(db *gorm.DB, tasks []models.Task) error {
+    if len(tasks) == 0 {
+        return nil
+    }
+
+    ids := make([]uint, len(tasks))
+    for i := range tasks {
+        ids[i] = tasks[i].ID
+    }
+
+    var subtasks []struct {
+        ParentID  uint
+        Total     int
+        Completed int
+    }
+    err := db.Model(&models.Task{}).
+        Select("parent_id, COUNT(*) AS total, SUM(CASE WHEN status = ? THEN 1 ELSE 0 END) AS completed", models.StatusCompleted).
+        Where("parent_id IN ?", ids).
+        Group("parent_id").
+        Scan(&subtasks).Error
+    if err != nil {
+        return err
+    }
+
+    var checklists []struct {
+        TaskID uint
+        Total  int
+        Done   int
+    }
+    err = db.Model(&models.ChecklistItem{}).
+        Select("task_id, COUNT(*) AS total, SUM(CASE WHEN done THEN 1 ELSE 0 END) AS done").
+        Where("task_id IN ?", ids).
+        Group("task_id").
+        Scan(&checklists).Error
+    if err != nil {
+        return err
+    }
+
+    progress := make(map[uint]*models.TaskProgress)
+    get := func(id uint) *models.TaskProgress {
+        if progress[id] == nil {
+            progress[id] = &models.TaskProgress{}
+        }
+        return progress[id]
+    }
+    for _, row := range subtasks {
+        p := get(row.ParentID)
+        p.Subtasks, p.SubtasksCompleted = row.Total, row.Completed
+    }
+    for _, row := range checklists {
+        p := get(row.TaskID)
+        p.Checklist, p.ChecklistDone = row.Total, row.Done
+    }
+
+    for i := range tasks {
+        p := progress[tasks[i].ID]
+        if p == nil {
+            continue
+        }
+        p.Percent = (p.SubtasksCompleted + p.ChecklistDone) * 100 / (p.Subtasks + p.Checklist)
+        tasks[i].Progress = p
+    }
+    return nil
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+    "testing"
+    "taskflow/internal/models"
+
+    "gorm.io/gorm"
+)
+
+func newSubtaskTest(t *testing.T) *gorm.DB {
+    return newTestDB(t, &models.User{}, &models.Task{}, &models.SyncJob{}, &models.CalendarConnection{},
+        &models.TaskEventMapping{}, &models.WorkspaceMember{}, &models.TaskDependency{}, &models.ChecklistItem{})
+}
+
+func createTask(t *testing.T, db *gorm.DB, task models.Task) *models.Task {
+    t.Helper()
+
+    if task.UserID == 0 {
+        task.UserID = 1
+    }
+    if task.Status == "" {
+        task.Status = models.StatusPending
+    }
+    if err := SaveTask(db, &task); err != nil {
+        t.Fatal(err)
+    }
+    return &task
+}
+
+// completeTask completes a task the way the handlers write it.
+func completeTask(t *testing.T, db *gorm.DB, task *models.Task) {
+    t.Helper()
+
+    err := db.Transaction(func(tx *gorm.DB) error {
+        task.Status = models.StatusCompleted
+        if err := SaveTask(tx, task); err != nil {
+            return err
+        }
+        return AutoCompleteParent(tx, task)
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+}
+
+func storedStatus(t *testing.T, db *gorm.DB, task *models.Task) string {
+    t.Helper()
+
+    var stored models.Task
+    if err := db.First(&stored, task.ID).Error; err != nil {
+        t.Fatal(err)
+    }
+    return stored.Status
+}
+
+func TestParentCompletesWithItsLastSubtask(t *testing.T) {
+    db := newSubtaskTest(t)
+    grandparent := createTask(t, db, models.Task{Title: "Move house", CompleteWithSubtasks: true})
+    parent := createTask(t, db, models.Task{Title: "Pack", ParentID: &grandparent.ID, CompleteWithSubtasks: true})
+    manual := createTask(t, db, models.Task{Title: "Clean", ParentID: &grandparent.ID})
+    books := createTask(t, db, models.Task{Title: "Books", ParentID: &parent.ID})
+    dishes := createTask(t, db, models.Task{Title: "Dishes", ParentID: &parent.ID})
+    mop := createTask(t, db, models.Task{Title: "Mop", ParentID: &manual.ID})
+
+    completeTask(t, db, books)
+    if got := storedStatus(t, db, parent); got != models.StatusPending {
+        t.Errorf("one subtask left: got parent %s, want pending", got)
+    }
+
+    completeTask(t, db, dishes)
+    if got := storedStatus(t, db, parent); got != models.StatusCompleted {
+        t.Errorf("all subtasks done: got parent %s, want completed", got)
+    }
+    if got := storedStatus(t, db, grandparent); got != models.StatusPending {
+        t.Errorf("got grandparent %s, want pending while Clean is open", got)
+    }
+
+    // Clean doesn't complete with its subtasks, so it holds the grandparent
+    completeTask(t, db, mop)
+    if got := storedStatus(t, db, manual); got != models.StatusPending {
+        t.Errorf("got %s for a parent not completing with its subtasks", got)
+    }
+
+    completeTask(t, db, manual)
+    if got := storedStatus(t, db, grandparent); got != models.StatusCompleted {
+        t.Errorf("got grandparent %s, want completed", got)
+    }
+}
+
+func TestParentTheWorkflowKeepsOpen(t *testing.T) {
+    strict, err := LoadWorkflow("../../workflows/strict.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+    useWorkflow(t, strict)
+
+    db := newSubtaskTest(t)
+    pending := createTask(t, db, models.Task{Title: "Not started", CompleteWithSubtasks: true})
+    started := createTask(t, db, models.Task{Title: "Started", Status: models.StatusInProgress, CompleteWithSubtasks: true})
+    for _, parent := range []*models.Task{pending, started} {
+        subtask := createTask(t, db, models.Task{Title: "Subtask", ParentID: &parent.ID, Status: models.StatusInProgress})
+        completeTask(t, db, subtask)
+    }
+
+    if got := storedStatus(t, db, pending); got != models.StatusPending {
+        t.Errorf("got %s, want pending: the workflow doesn't go from pending to completed", got)
+    }
+    if got := storedStatus(t, db, started); got != models.StatusCompleted {
+        t.Errorf("got %s, want completed", got)
+    }
+}
+
+func TestDeleteSubtasks(t *testing.T) {
+    db := newSubtaskTest(t)
+    parent := createTask(t, db, models.Task{Title: "Move house"})
+    child := createTask(t, db, models.Task{Title: "Pack", ParentID: &parent.ID})
+    createTask(t, db, models.Task{Title: "Books", ParentID: &child.ID})
+    createTask(t, db, models.Task{Title: "Dishes", ParentID: &parent.ID})
+    other := createTask(t, db, models.Task{Title: "Other"})
+
+    err := db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Delete(parent).Error; err != nil {
+            return err
+        }
+        return DeleteSubtasks(tx, parent)
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var left []models.Task
+    if err := db.Find(&left).Error; err != nil {
+        t.Fatal(err)
+    }
+    if len(left) != 1 || left[0].ID != other.ID {
+        t.Errorf("got %+v, want only the unrelated task", left)
+    }
+}
+
+func TestLoadTaskProgress(t *testing.T) {
+    db := newSubtaskTest(t)
+    parent := createTask(t, db, models.Task{Title: "Move house"})
+    checklistOnly := createTask(t, db, models.Task{Title: "Groceries"})
+    plain := createTask(t, db, models.Task{Title: "Call the bank"})
+    for _, status := range []string{models.StatusCompleted, models.StatusPending, models.StatusInProgress} {
+        createTask(t, db, models.Task{Title: "Subtask", ParentID: &parent.ID, Status: status})
+    }
+    for _, item := range []models.ChecklistItem{
+        {TaskID: parent.ID, Title: "Boxes", Done: true},
+        {TaskID: parent.ID, Title: "Tape"},
+        {TaskID: checklistOnly.ID, Title: "Milk", Done: true},
+    } {
+        if err := db.Create(&item).Error; err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    tasks := []models.Task{*parent, *checklistOnly, *plain}
+    if err := LoadTaskProgress(db, tasks); err != nil {
+        t.Fatal(err)
+    }
+
+    for i, want := range []*models.TaskProgress{
+        {Subtasks: 3, SubtasksCompleted: 1, Checklist: 2, ChecklistDone: 1, Percent: 40},
+        {Checklist: 1, ChecklistDone: 1, Percent: 100},
+        nil,
+    } {
+        got := tasks[i].Progress
+        if (got == nil) != (want == nil) || (got != nil && *got != *want) {
+            t.Errorf("%s: got %+v, want %+v", tasks[i].Title, got, want)
+        }
+    }
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "time"
+    "taskflow/internal/models"
+
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+)
+
+const (
+    SyncJobPending    = "pending"
+    SyncJobProcessing = "processing"
+    SyncJobDone       = "done"
+    SyncJobDead       = "dead"
+)
+
+const (
+    syncMaxAttempts  = 8
+    syncBaseBackoff  = 30 * time.Second
+    syncMaxBackoff   = 6 * time.Hour
+    syncPollInterval = 2 * time.Second
+    // syncStaleAfter is how long a job may stay in processing before it is
+    // assumed its worker died and the job is handed out again.
+    syncStaleAfter = 10 * time.Minute
+)
+
+// EnqueueTaskSync records that the task needs to be reconciled with the
+// calendar. It must be called with the transaction that changed the task.
+// A task has at most one pending job: the worker always reads the task's
+// latest state, so later changes just pull the existing job forward.
+func EnqueueTaskSync(tx *gorm.DB, task *models.Task) error {
+    now := time.Now()
+
+    result := tx.Model(&models.SyncJob{}).
+        Where("task_id = ? AND status = ?", task.ID, SyncJobPending).
+        Update("next_run_at", now)
+    if result.Error != nil {
+        return result.Error
+    }
+    if result.RowsAffected > 0 {
+        return nil
+    }
+
+    job := models.SyncJob{
+        TaskID:    task.ID,
+        UserID:    task.UserID,
+        Status:    SyncJobPending,
+        NextRunAt: now,
+    }
+    return tx.Create(&job).Error
+}
+
+type SyncWorker struct {
+    db          *gorm.DB
+    syncService *TaskSyncService
+}
+
+func NewSyncWorker(db *gorm.DB) *SyncWorker {
+    return &SyncWorker{
+        db:          db,
+        syncService: NewTaskSyncService(db),
+    }
+}
+
+// Start launches the given number of worker goroutines draining the sync
+// job table, plus one pulling calendar changes, until ctx is cancelled.
+func (w *SyncWorker) Start(ctx context.Context, workers int) {
+    w.requeueStaleJobs()
+
+    for i := 0; i < workers; i++ {
+        go w.run(ctx)
+    }
+    go w.runPuller(ctx)
+
+    go func() {
+        ticker := time.NewTicker(syncStaleAfter / 2)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+                w.requeueStaleJobs()
+            }
+        }
+    }()
+}
+
+func (w *SyncWorker) run(ctx context.Context) {
+    for {
+        job, err := w.claimJob()
+        if err != nil {
+            log.Printf("sync worker: failed to claim job: %v", err)
+        }
+
+        if job == nil {
+            select {
+            case <-ctx.Done():
+                return
+            case <-time.After(syncPollInterval):
+            }
+            continue
+        }
+
+        w.finishJob(job, w.process(job))
+
+        if ctx.Err() != nil {
+            return
+        }
+    }
+}
+
+// claimJob locks the next due job and marks it as processing. Jobs for a
+// task that is already being processed are skipped so the same task is
+// never synced concurrently.
+func (w *SyncWorker) claimJob() (*models.SyncJob, error) {
+    var job models.SyncJob
+
+    err := w.db.Transaction(func(tx *gorm.DB) error {
+        err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+            Where("status = ? AND next_run_at <= ?", SyncJobPending, time.Now()).
+            Where("task_id NOT IN (?)", tx.Model(&models.SyncJob{}).Select("task_id").Where("status = ?", SyncJobProcessing)).
+            Order("next_run_at").
+            First(&job).Error
+        if err != nil {
+            return err
+        }
+
+        now := time.Now()
+        job.Status = SyncJobProcessing
+        job.LockedAt = &now
+        job.Attempts++
+        return tx.Save(&job).Error
+    })
+
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &job, nil
+}
+
+func (w *SyncWorker) process(job *models.SyncJob) error {
+    // Unscoped so deleted tasks can still have their events removed
+    var task models.Task
+    if err := w.db.Unscoped().First(&task, job.TaskID).Error; err != nil {
+        return fmt.Errorf("failed to load task: %w", err)
+    }
+
+    ownerID, err := CalendarOwner(w.db, &task)
+    if err != nil {
+        return fmt.Errorf("failed to find calendar owner: %w", err)
+    }
+
+    // Without an owner the task is on nobody's calendar, a user without
+    // connections has its events removed
+    var user models.User
+    if ownerID != 0 {
+        if err := w.db.First(&user, ownerID).Error; err != nil {
+            return fmt.Errorf("failed to load user: %w", err)
+        }
+    }
+
+    return w.syncService.ReconcileTask(context.Background(), &task, &user, jobEventID(job))
+}
+
+func (w *SyncWorker) finishJob(job *models.SyncJob, syncErr error) {
+    updates := map[string]interface{}{"locked_at": nil}
+
+    switch {
+    case syncErr == nil:
+        updates["status"] = SyncJobDone
+        updates["last_error"] = ""
+    case job.Attempts >= syncMaxAttempts:
+        log.Printf("sync worker: job %d for task %d dead-lettered after %d attempts: %v", job.ID, job.TaskID, job.Attempts, syncErr)
+        updates["status"] = SyncJobDead
+        updates["last_error"] = syncErr.Error()
+    default:
+        updates["status"] = SyncJobPending
+        updates["last_error"] = syncErr.Error()
+        updates["next_run_at"] = time.Now().Add(syncBackoff(job.Attempts))
+    }
+
+    if err := w.db.Model(job).Updates(updates).Error; err != nil {
+        log.Printf("sync worker: failed to update job %d: %v", job.ID, err)
+    }
+}
+
+func (w *SyncWorker) requeueStaleJobs() {
+    err := w.db.Model(&models.SyncJob{}).
+        Where("status = ? AND locked_at < ?", SyncJobProcessing, time.Now().Add(-syncStaleAfter)).
+        Updates(map[string]interface{}{"status": SyncJobPending, "locked_at": nil}).Error
+    if err != nil {
+        log.Printf("sync worker: failed to requeue stale jobs: %v", err)
+    }
+}
+
+// syncBackoff doubles the delay with every failed attempt, capped at
+// syncMaxBackoff.
+func syncBackoff(attempts int) time.Duration {
+    backoff := syncBaseBackoff
+    for i := 1; i < attempts; i++ {
+        backoff *= 2
+        if backoff >= syncMaxBackoff {
+            return syncMaxBackoff
+        }
+    }
+    return backoff
+}
+
+// jobEventID is the event ID used when a job has to create an event. It is
+// stable across retries of the same job, so a create whose response was
+// lost is not repeated. It only uses base32hex characters (a-v, 0-9) since
+// that is all Google accepts in event IDs.
+func jobEventID(job *models.SyncJob) string {
+    return fmt.Sprintf("tf%dj%d", job.TaskID, job.ID)
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+    "fmt"
+    "taskflow/internal/ical"
+    "taskflow/internal/models"
+)
+
+// Which components a feed renders tasks as
+const (
+    FeedItemEvent = "event"
+    FeedItemTodo  = "todo"
+    FeedItemBoth  = "both"
+)
+
+// RenderTaskFeed renders tasks as an iCalendar feed. Events are only
+// written for tasks with a due date; to-dos are written for every task.
+// The output only depends on the tasks, so it can be hashed into an ETag.
+func RenderTaskFeed(feed *models.CalendarFeed, user *models.User, tasks []models.Task) *ical.Component {
+    cal := ical.NewCalendar()
+    name := feed.Name
+    if name == "" {
+        name = "TaskFlow"
+    }
+    cal.SetText("X-WR-CALNAME", name)
+    cal.Props = append(cal.Props,
+        ical.Property{Name: "REFRESH-INTERVAL", Params: map[string]string{"VALUE": "DURATION"}, Value: "PT1H"},
+        ical.Property{Name: "X-PUBLISHED-TTL", Value: "PT1H"},
+    )
+
+    for i := range tasks {
+        task := &tasks[i]
+        if feed.ItemType != FeedItemTodo && task.DueDate != nil {
+            cal.Add(taskVEvent(user, task))
+        }
+        if feed.ItemType == FeedItemTodo || feed.ItemType == FeedItemBoth {
+            cal.Add(TaskVTodo(task))
+        }
+    }
+
+    return cal
+}
+
+func taskVEvent(user *models.User, task *models.Task) *ical.Component {
+    opts := EventOptionsFor(user, task)
+    event := taskEvent(task, opts)
+
+    vevent := ical.NewComponent("VEVENT")
+    vevent.Set("UID", fmt.Sprintf("task-%d@taskflow", task.ID))
+    vevent.Set("DTSTAMP", ical.FormatTime(task.UpdatedAt))
+    vevent.Set("LAST-MODIFIED", ical.FormatTime(task.UpdatedAt))
+    setEventTimes(vevent, opts, event)
+    vevent.SetText("SUMMARY", task.Title)
+    if task.Description != "" {
+        vevent.SetText("DESCRIPTION", task.Description)
+    }
+    vevent.Set("TRANSP", "TRANSPARENT")
+    return vevent
+}
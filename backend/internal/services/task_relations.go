@@ -0,0 +1,22 @@
+package services
+
+import (
+    "taskflow/internal/models"
+
+    "gorm.io/gorm"
+)
+
+// LoadTaskRelations fills in the fields of tasks that only appear in API
+// responses, read from related tables in one query each.
+func LoadTaskRelations(db *gorm.DB, tasks []models.Task) error {
+    if err := LoadTaskProgress(db, tasks); err != nil {
+        return err
+    }
+    if err := loadTaskBlockers(db, tasks); err != nil {
+        return err
+    }
+    if err := LoadTaskLabels(db, tasks); err != nil {
+        return err
+    }
+    return LoadTaskWatchers(db, tasks)
+}
@@ -0,0 +1,280 @@
+package services
+
+import (
+    "fmt"
+    "html"
+    "os"
+    "sort"
+    "strings"
+    "unicode"
+    "taskflow/internal/models"
+
+    "gorm.io/gorm"
+)
+
+const (
+    highlightStart = "<mark>"
+    highlightStop  = "</mark>"
+    snippetRunes   = 160
+)
+
+// Matches are first delimited with control characters so the text can be
+// HTML escaped before they turn into highlightStart and highlightStop. A
+// stray one in a task only adds a tag.
+const (
+    matchStart = "\x02"
+    matchStop  = "\x03"
+)
+
+var matchMarks = strings.NewReplacer(matchStart, highlightStart, matchStop, highlightStop)
+
+// markMatches HTML escapes text delimited by the match markers and turns
+// the markers into <mark> tags.
+func markMatches(text string) string {
+    return matchMarks.Replace(html.EscapeString(text))
+}
+
+// searchLanguages maps the accepted language names to text search
+// configurations. Tasks are indexed in all of them.
+var searchLanguages = map[string]string{
+    "pt":         "portuguese",
+    "portuguese": "portuguese",
+    "en":         "english",
+    "english":    "english",
+}
+
+// SearchLanguage resolves a language name to its text search configuration,
+// the SEARCH_LANGUAGE default (Portuguese) when name is empty.
+func SearchLanguage(name string) (string, error) {
+    if name == "" {
+        name = os.Getenv("SEARCH_LANGUAGE")
+    }
+    if name == "" {
+        return "portuguese", nil
+    }
+
+    config, ok := searchLanguages[strings.ToLower(name)]
+    if !ok {
+        return "", fmt.Errorf("unsupported search language %q", name)
+    }
+    return config, nil
+}
+
+type TaskSearchOptions struct {
+    Text     string
+    Language string
+    Limit    int
+    Offset   int
+}
+
+// TaskSearchResult is a matching task with its relevance and the matched
+// words highlighted in the title and an excerpt of the description. The
+// highlights are HTML: the task text is escaped and matches wrapped in
+// <mark> tags.
+type TaskSearchResult struct {
+    models.Task
+    Rank           float64 `json:"rank"`
+    TitleHighlight string  `json:"title_highlight"`
+    Snippet        string  `json:"snippet"`
+}
+
+// TaskSearch runs a text search over the tasks selected by query, best
+// matches first. The last word of the text matches as a prefix.
+type TaskSearch interface {
+    Search(query *gorm.DB, opts TaskSearchOptions) ([]TaskSearchResult, error)
+}
+
+// NewTaskSearch returns the full text search on PostgreSQL, backed by the
+// generated tasks.search_vector column, and a plain LIKE search elsewhere.
+func NewTaskSearch(db *gorm.DB) TaskSearch {
+    if db.Dialector.Name() == "postgres" {
+        return postgresTaskSearch{}
+    }
+    return likeTaskSearch{}
+}
+
+type postgresTaskSearch struct{}
+
+func (postgresTaskSearch) Search(query *gorm.DB, opts TaskSearchOptions) ([]TaskSearchResult, error) {
+    terms := searchTerms(opts.Text)
+    if len(terms) == 0 {
+        return []TaskSearchResult{}, nil
+    }
+    tsquery := strings.Join(terms, " & ") + ":*"
+
+    // The configuration is one of searchLanguages, safe to inline
+    config, err := SearchLanguage(opts.Language)
+    if err != nil {
+        return nil, err
+    }
+    match := fmt.Sprintf("to_tsquery('%s', ?)", config)
+    headline := fmt.Sprintf("ts_headline('%s', %%s, %s, ?)", config, match)
+    headlineOptions := fmt.Sprintf(`StartSel="%s", StopSel="%s"`, matchStart, matchStop)
+
+    results := []TaskSearchResult{}
+    err = query.Model(&models.Task{}).
+        Select(
+            "tasks.*, ts_rank_cd(search_vector, "+match+") AS rank, "+
+                fmt.Sprintf(headline, "title")+" AS title_highlight, "+
+                fmt.Sprintf(headline, "COALESCE(description, '')")+" AS snippet",
+            tsquery,
+            tsquery, headlineOptions+", HighlightAll=true",
+            tsquery, headlineOptions+", MaxWords=30, MinWords=10, MaxFragments=2",
+        ).
+        Where("search_vector @@ "+match, tsquery).
+        Order("rank DESC").
+        Order("id").
+        Limit(opts.Limit).
+        Offset(opts.Offset).
+        Scan(&results).Error
+    if err != nil {
+        return nil, err
+    }
+
+    for i := range results {
+        results[i].TitleHighlight = markMatches(results[i].TitleHighlight)
+        results[i].Snippet = markMatches(results[i].Snippet)
+    }
+    return results, nil
+}
+
+// likeTaskSearch matches every word anywhere in the title or description and
+// ranks in memory, title matches first. It serves databases without text
+// search such as SQLite.
+type likeTaskSearch struct{}
+
+func (likeTaskSearch) Search(query *gorm.DB, opts TaskSearchOptions) ([]TaskSearchResult, error) {
+    terms := searchTerms(opts.Text)
+    if len(terms) == 0 {
+        return []TaskSearchResult{}, nil
+    }
+
+    for _, term := range terms {
+        pattern := "%" + escapeLike(term) + "%"
+        query = query.Where(`(LOWER(title) LIKE ? ESCAPE '\' OR LOWER(description) LIKE ? ESCAPE '\')`, pattern, pattern)
+    }
+
+    var tasks []models.Task
+    if err := query.Find(&tasks).Error; err != nil {
+        return nil, err
+    }
+
+    results := make([]TaskSearchResult, 0, len(tasks))
+    for _, task := range tasks {
+        title := strings.ToLower(task.Title)
+        description := strings.ToLower(task.Description)
+
+        var rank float64
+        for _, term := range terms {
+            rank += float64(strings.Count(title, term)) + 0.4*float64(strings.Count(description, term))
+        }
+
+        results = append(results, TaskSearchResult{
+            Task:           task,
+            Rank:           rank,
+            TitleHighlight: markMatches(highlight(task.Title, terms)),
+            Snippet:        markMatches(highlight(excerpt(task.Description, terms), terms)),
+        })
+    }
+
+    sort.SliceStable(results, func(i, j int) bool {
+        if results[i].Rank != results[j].Rank {
+            return results[i].Rank > results[j].Rank
+        }
+        return results[i].ID < results[j].ID
+    })
+
+    if opts.Offset >= len(results) {
+        return []TaskSearchResult{}, nil
+    }
+    results = results[opts.Offset:]
+    if opts.Limit > 0 && len(results) > opts.Limit {
+        results = results[:opts.Limit]
+    }
+    return results, nil
+}
+
+// searchTerms splits text into lowercase words, dropping the punctuation
+// that has a meaning in tsquery syntax.
+func searchTerms(text string) []string {
+    return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+        return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+    })
+}
+
+// highlight delimits the occurrences of terms in text with the match
+// markers, ignoring case.
+func highlight(text string, terms []string) string {
+    lower := []rune(strings.ToLower(text))
+    runes := []rune(text)
+    if len(lower) != len(runes) {
+        return text
+    }
+
+    marked := make([]bool, len(runes))
+    for _, term := range terms {
+        t := []rune(term)
+        for i := 0; i+len(t) <= len(lower); i++ {
+            if string(lower[i:i+len(t)]) == term {
+                for j := i; j < i+len(t); j++ {
+                    marked[j] = true
+                }
+            }
+        }
+    }
+
+    var b strings.Builder
+    for i, r := range runes {
+        if marked[i] && (i == 0 || !marked[i-1]) {
+            b.WriteString(matchStart)
+        }
+        b.WriteRune(r)
+        if marked[i] && (i == len(runes)-1 || !marked[i+1]) {
+            b.WriteString(matchStop)
+        }
+    }
+    return b.String()
+}
+
+// excerpt cuts text around the first matched term.
+func excerpt(text string, terms []string) string {
+    runes := []rune(text)
+    if len(runes) <= snippetRunes {
+        return text
+    }
+
+    start := -1
+    lower := strings.ToLower(text)
+    for _, term := range terms {
+        if i := strings.Index(lower, term); i >= 0 && (start < 0 || i < start) {
+            start = i
+        }
+    }
+    if start < 0 {
+        start = 0
+    }
+
+    // Byte offset to rune offset, then center the match
+    from := len([]rune(lower[:start])) - snippetRunes/4
+    if from < 0 {
+        from = 0
+    }
+    to := from + snippetRunes
+    if to > len(runes) {
+        to = len(runes)
+        from = to - snippetRunes
+    }
+
+    snippet := string(runes[from:to])
+    if from > 0 {
+        snippet = "…" + snippet
+    }
+    if to < len(runes) {
+        snippet += "…"
+    }
+    return snippet
+}
+
+func escapeLike(value string) string {
+    return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
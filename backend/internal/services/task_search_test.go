@@ -0,0 +1,150 @@
+package services
+
+import (
+    "fmt"
+    "strings"
+    "testing"
+    "taskflow/internal/models"
+
+    "github.com/glebarez/sqlite"
+    "gorm.io/gorm"
+    "gorm.io/gorm/logger"
+)
+
+// newTestDB opens an in-memory SQLite database of its own for a test.
+func newTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+    t.Helper()
+
+    dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", strings.ReplaceAll(t.Name(), "/", "_"))
+    db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := db.AutoMigrate(models...); err != nil {
+        t.Fatal(err)
+    }
+
+    sqlDB, err := db.DB()
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { sqlDB.Close() })
+    return db
+}
+
+func newSearchTest(t *testing.T, tasks ...models.Task) *gorm.DB {
+    db := newTestDB(t, &models.User{}, &models.Task{})
+    for i := range tasks {
+        tasks[i].UserID = 1
+        if err := db.Create(&tasks[i]).Error; err != nil {
+            t.Fatal(err)
+        }
+    }
+    return db
+}
+
+func searchTitles(results []TaskSearchResult) []string {
+    titles := make([]string, len(results))
+    for i, result := range results {
+        titles[i] = result.Title
+    }
+    return titles
+}
+
+func TestNewTaskSearchFallsBackToLike(t *testing.T) {
+    db := newSearchTest(t)
+    if _, ok := NewTaskSearch(db).(likeTaskSearch); !ok {
+        t.Fatalf("got %T on SQLite, want likeTaskSearch", NewTaskSearch(db))
+    }
+}
+
+func TestLikeTaskSearchRanksTitleMatchesFirst(t *testing.T) {
+    db := newSearchTest(t,
+        models.Task{Title: "Groceries", Description: "buy milk and bread"},
+        models.Task{Title: "Buy milk"},
+        models.Task{Title: "Milk the milk budget"},
+        models.Task{Title: "Call the bank"},
+    )
+
+    results, err := NewTaskSearch(db).Search(db.Where("user_id = ?", 1), TaskSearchOptions{Text: "milk"})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    got := strings.Join(searchTitles(results), ", ")
+    if want := "Milk the milk budget, Buy milk, Groceries"; got != want {
+        t.Errorf("got %s, want %s", got, want)
+    }
+
+    results, err = NewTaskSearch(db).Search(db.Where("user_id = ?", 1), TaskSearchOptions{Text: "milk", Limit: 1, Offset: 1})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got := strings.Join(searchTitles(results), ", "); got != "Buy milk" {
+        t.Errorf("second page: got %s, want Buy milk", got)
+    }
+}
+
+func TestLikeTaskSearchMatchesLastWordAsPrefix(t *testing.T) {
+    db := newSearchTest(t,
+        models.Task{Title: "Buy milk"},
+        models.Task{Title: "Buy bread"},
+        models.Task{Title: "Milkshake recipe"},
+    )
+
+    results, err := NewTaskSearch(db).Search(db.Where("user_id = ?", 1), TaskSearchOptions{Text: "buy mil"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got := strings.Join(searchTitles(results), ", "); got != "Buy milk" {
+        t.Fatalf("got %s, want Buy milk", got)
+    }
+    if got, want := results[0].TitleHighlight, "<mark>Buy</mark> <mark>mil</mark>k"; got != want {
+        t.Errorf("got highlight %q, want %q", got, want)
+    }
+}
+
+func TestLikeTaskSearchEscapesHighlights(t *testing.T) {
+    db := newSearchTest(t,
+        models.Task{Title: `<img src=x onerror="alert(1)"> milk`, Description: "<script>milk</script>"},
+    )
+
+    results, err := NewTaskSearch(db).Search(db.Where("user_id = ?", 1), TaskSearchOptions{Text: "milk"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(results) != 1 {
+        t.Fatalf("got %d results, want 1", len(results))
+    }
+
+    if got, want := results[0].TitleHighlight, "&lt;img src=x onerror=&#34;alert(1)&#34;&gt; <mark>milk</mark>"; got != want {
+        t.Errorf("got title %q, want %q", got, want)
+    }
+    if got, want := results[0].Snippet, "&lt;script&gt;<mark>milk</mark>&lt;/script&gt;"; got != want {
+        t.Errorf("got snippet %q, want %q", got, want)
+    }
+}
+
+func TestLikeTaskSearchExcerptsLongDescriptions(t *testing.T) {
+    description := strings.Repeat("lorem ipsum ", 30) + "the needle is here " + strings.Repeat("dolor sit ", 30)
+    db := newSearchTest(t, models.Task{Title: "Long notes", Description: description})
+
+    results, err := NewTaskSearch(db).Search(db.Where("user_id = ?", 1), TaskSearchOptions{Text: "needle"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(results) != 1 {
+        t.Fatalf("got %d results, want 1", len(results))
+    }
+
+    snippet := results[0].Snippet
+    if !strings.HasPrefix(snippet, "…") || !strings.HasSuffix(snippet, "…") {
+        t.Errorf("snippet %q is not cut on both sides", snippet)
+    }
+    if !strings.Contains(snippet, "<mark>needle</mark>") {
+        t.Errorf("snippet %q doesn't highlight the match", snippet)
+    }
+    if runes := len([]rune(strings.NewReplacer(highlightStart, "", highlightStop, "").Replace(snippet))); runes != snippetRunes+2 {
+        t.Errorf("got %d runes, want %d and the ellipses", runes, snippetRunes)
+    }
+}
@@ -1,133 +1,220 @@
 package services
 
 import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
     "taskflow/internal/models"
+
+    "gorm.io/gorm"
 )
 
 type TaskSyncService struct {
-    calendarService *GoogleCalendarService
+    db *gorm.DB
 }
 
-func NewTaskSyncService() *TaskSyncService {
+func NewTaskSyncService(db *gorm.DB) *TaskSyncService {
     return &TaskSyncService{
-        calendarService: NewGoogleCalendarService(),
+        db: db,
     }
 }
 
-func (s *TaskSyncService) SyncTaskToCalendar(task *models.Task, user *models.User) error {
-    if !user.CalendarSync || user.GoogleToken == "" || task.DueDate == nil {
-        return nil
-    }
+// CalendarTasks limits a query of tasks to those a user's calendars, feeds
+// and CalDAV collection show: their own tasks, and the tasks of their
+// workspaces assigned to them or, while nobody is, created by them.
+func CalendarTasks(db *gorm.DB, userID uint) *gorm.DB {
+    workspaces := db.Session(&gorm.Session{NewDB: true}).Model(&models.WorkspaceMember{}).Select("workspace_id").Where("user_id = ?", userID)
+    return db.Where("((workspace_id IS NULL AND user_id = ?) OR (workspace_id IN (?) AND COALESCE(assignee_id, user_id) = ?))", userID, workspaces, userID)
+}
 
-    token, err := s.calendarService.GetTokenFromJSON(user.GoogleToken)
-    if err != nil {
-        return err
+// CalendarOwner is the user whose calendars show a task, following
+// CalendarTasks, or 0 when that user left the task's workspace.
+func CalendarOwner(db *gorm.DB, task *models.Task) (uint, error) {
+    if task.WorkspaceID == nil {
+        return task.UserID, nil
     }
 
-    // If task already has a Google Event ID, update it
-    if task.GoogleEventID != "" {
-        _, err = s.calendarService.UpdateEvent(token, task.GoogleEventID, task.Title, task.Description, *task.DueDate)
-        return err
+    ownerID := task.UserID
+    if task.AssigneeID != nil {
+        ownerID = *task.AssigneeID
     }
 
-    // Otherwise create new event
-    event, err := s.calendarService.CreateEvent(token, task.Title, task.Description, *task.DueDate)
-    if err != nil {
-        return err
+    var members int64
+    err := db.Model(&models.WorkspaceMember{}).
+        Where("workspace_id = ? AND user_id = ?", *task.WorkspaceID, ownerID).
+        Count(&members).Error
+    if err != nil || members == 0 {
+        return 0, err
     }
-
-    task.GoogleEventID = event.Id
-    return nil
+    return ownerID, nil
 }
 
-func (s *TaskSyncService) RemoveTaskFromCalendar(task *models.Task, user *models.User) error {
-    if task.GoogleEventID == "" || user.GoogleToken == "" {
-        return nil
+// ReconcileTask brings every calendar user connected in line with the
+// task's current state: deleted, completed or undated tasks lose their
+// events, others get one. user is the task's CalendarOwner; events left on
+// the calendars of anyone else, such as a previous assignee, are removed.
+// newEventID, when set, is the ID used for events that have to be created,
+// which keeps retried creates idempotent.
+func (s *TaskSyncService) ReconcileTask(ctx context.Context, task *models.Task, user *models.User, newEventID string) error {
+    var connections []models.CalendarConnection
+    if err := s.db.Where("user_id = ?", user.ID).Find(&connections).Error; err != nil {
+        return err
     }
 
-    token, err := s.calendarService.GetTokenFromJSON(user.GoogleToken)
-    if err != nil {
+    var mappings []models.TaskEventMapping
+    if err := s.db.Where("task_id = ?", task.ID).Find(&mappings).Error; err != nil {
         return err
     }
 
-    err = s.calendarService.DeleteEvent(token, task.GoogleEventID)
-    if err != nil {
-        return err
+    byConnection := make(map[uint]*models.TaskEventMapping)
+    for i := range mappings {
+        byConnection[mappings[i].ConnectionID] = &mappings[i]
     }
 
-    task.GoogleEventID = ""
-    return nil
-}
+    remove := task.DeletedAt.Valid || task.Status == models.StatusCompleted || task.DueDate == nil
+
+    // Keep going on failures so one provider doesn't block the others
+    var errs []error
+    for i := range connections {
+        conn := &connections[i]
+        mapping := byConnection[conn.ID]
+        delete(byConnection, conn.ID)
+
+        if conn.Credentials == "" {
+            continue
+        }
 
-func (s *TaskSyncService) HandleTaskStatusChange(task *models.Task, user *models.User) error {
-    // Remove from calendar if task is completed
-    if task.Status == "completed" {
-        return s.RemoveTaskFromCalendar(task, user)
+        var err error
+        switch {
+        case remove:
+            err = s.removeEvent(ctx, conn, mapping)
+        case conn.SyncEnabled:
+            err = s.upsertEvent(ctx, conn, mapping, task, user, newEventID)
+        }
+        if err != nil {
+            errs = append(errs, fmt.Errorf("%s: %w", conn.Provider, err))
+        }
     }
 
-    // Sync to calendar if task has due date and is not completed
-    if task.DueDate != nil && task.Status != "completed" {
-        return s.SyncTaskToCalendar(task, user)
+    // Mappings left over are on someone else's calendar, or belong to
+    // connections that no longer exist
+    for _, mapping := range byConnection {
+        var conn models.CalendarConnection
+        err := s.db.First(&conn, mapping.ConnectionID).Error
+        switch {
+        case err == nil && conn.Credentials != "":
+            err = s.removeEvent(ctx, &conn, mapping)
+        case err == nil || errors.Is(err, gorm.ErrRecordNotFound):
+            err = s.db.Delete(mapping).Error
+        }
+        if err != nil {
+            errs = append(errs, fmt.Errorf("%s: %w", conn.Provider, err))
+        }
     }
 
-    return nil
+    return errors.Join(errs...)
 }
 
-func (s *TaskSyncService) SyncAllUserTasks(user *models.User, tasks []models.Task) error {
-    if !user.CalendarSync || user.GoogleToken == "" {
-        return nil
-    }
-
-    token, err := s.calendarService.GetTokenFromJSON(user.GoogleToken)
+// upsertEvent updates the task's event on a connection or creates it when
+// there is none. Events are recreated when the target calendar changed or
+// the event was deleted on the provider side.
+func (s *TaskSyncService) upsertEvent(ctx context.Context, conn *models.CalendarConnection, mapping *models.TaskEventMapping, task *models.Task, user *models.User, newEventID string) error {
+    provider, err := NewCalendarProvider(conn.Provider, s.db)
     if err != nil {
         return err
     }
 
-    for i := range tasks {
-        task := &tasks[i]
-        // Only sync tasks with due dates that are not completed
-        if task.DueDate != nil && task.Status != "completed" {
-            if task.GoogleEventID == "" {
-                // Create new event
-                event, err := s.calendarService.CreateEvent(token, task.Title, task.Description, *task.DueDate)
-                if err != nil {
-                    return err
-                }
-                task.GoogleEventID = event.Id
-            } else {
-                // Update existing event
-                _, err = s.calendarService.UpdateEvent(token, task.GoogleEventID, task.Title, task.Description, *task.DueDate)
-                if err != nil {
-                    return err
-                }
-            }
-        } else if task.GoogleEventID != "" {
-            // Remove events for tasks without due dates or completed tasks
-            s.calendarService.DeleteEvent(token, task.GoogleEventID)
-            task.GoogleEventID = ""
+    opts := connectionEventOptions(conn, user, task)
+    event := taskEvent(task, opts)
+
+    if mapping != nil && mapping.CalendarID != event.CalendarID {
+        if err := s.removeEvent(ctx, conn, mapping); err != nil {
+            return err
+        }
+        mapping = nil
+    }
+
+    if mapping != nil {
+        event.ID = mapping.ExternalEventID
+        updated, err := provider.UpdateEvent(ctx, conn, opts, event)
+        if err == nil {
+            now := time.Now()
+            mapping.ETag = updated.ETag
+            mapping.SyncedAt = &now
+            return s.db.Save(mapping).Error
+        }
+        if !errors.Is(err, ErrEventNotFound) {
+            return err
+        }
+
+        if err := s.db.Delete(mapping).Error; err != nil {
+            return err
         }
+        mapping = nil
+    }
+
+    event.ID = newEventID
+    created, err := provider.CreateEvent(ctx, conn, opts, event)
+    if err != nil {
+        return err
     }
 
-    return nil
+    now := time.Now()
+    return s.db.Create(&models.TaskEventMapping{
+        TaskID:          task.ID,
+        ConnectionID:    conn.ID,
+        ExternalEventID: created.ID,
+        CalendarID:      event.CalendarID,
+        ETag:            created.ETag,
+        SyncedAt:        &now,
+    }).Error
 }
 
-func (s *TaskSyncService) CleanupCompletedTasks(user *models.User, tasks []models.Task) error {
-    if user.GoogleToken == "" {
+func (s *TaskSyncService) removeEvent(ctx context.Context, conn *models.CalendarConnection, mapping *models.TaskEventMapping) error {
+    if mapping == nil {
         return nil
     }
 
-    token, err := s.calendarService.GetTokenFromJSON(user.GoogleToken)
+    provider, err := NewCalendarProvider(conn.Provider, s.db)
     if err != nil {
         return err
     }
 
+    if err := provider.DeleteEvent(ctx, conn, mapping.CalendarID, mapping.ExternalEventID); err != nil {
+        return err
+    }
+
+    return s.db.Delete(mapping).Error
+}
+
+func (s *TaskSyncService) SyncAllUserTasks(ctx context.Context, user *models.User, tasks []models.Task) error {
+    var errs []error
     for i := range tasks {
-        task := &tasks[i]
-        if task.Status == "completed" && task.GoogleEventID != "" {
-            s.calendarService.DeleteEvent(token, task.GoogleEventID)
-            task.GoogleEventID = ""
+        if err := s.ReconcileTask(ctx, &tasks[i], user, ""); err != nil {
+            errs = append(errs, fmt.Errorf("task %d: %w", tasks[i].ID, err))
         }
     }
 
-    return nil
+    return errors.Join(errs...)
+}
+
+// connectionEventOptions applies the connection's target calendar to the
+// user's event options. Google falls back to the calendar chosen in the
+// user's preferences, other providers to the account's default calendar.
+func connectionEventOptions(conn *models.CalendarConnection, user *models.User, task *models.Task) EventOptions {
+    opts := EventOptionsFor(user, task)
+    opts.CalendarID = connectionCalendarID(conn, user)
+    return opts
+}
+
+func connectionCalendarID(conn *models.CalendarConnection, user *models.User) string {
+    switch {
+    case conn.CalendarID != "":
+        return conn.CalendarID
+    case conn.Provider == ProviderGoogle:
+        return googleCalendarID(user.CalendarPreferences.CalendarID)
+    default:
+        return ""
+    }
 }
@@ -0,0 +1,115 @@
+package services
+
+import (
+    "fmt"
+    "sort"
+    "testing"
+    "taskflow/internal/models"
+
+    "gorm.io/gorm"
+)
+
+// newWorkspaceSyncTest has users 1 and 2 in a workspace, user 3 outside it.
+func newWorkspaceSyncTest(t *testing.T) (*gorm.DB, uint) {
+    db := newTestDB(t, &models.User{}, &models.Task{}, &models.SyncJob{}, &models.Workspace{}, &models.WorkspaceMember{},
+        &models.TaskWatcher{}, &models.AssignmentChange{}, &models.CalendarConnection{}, &models.TaskEventMapping{})
+
+    workspace := models.Workspace{Name: "Team"}
+    if err := CreateWorkspace(db, &workspace, 1); err != nil {
+        t.Fatal(err)
+    }
+    owner := &Access{Space: Space{UserID: 1, WorkspaceID: &workspace.ID}, Role: models.RoleOwner}
+    if _, err := AddMember(db, owner, 2, models.RoleMember); err != nil {
+        t.Fatal(err)
+    }
+    return db, workspace.ID
+}
+
+func calendarTaskTitles(t *testing.T, db *gorm.DB, userID uint) []string {
+    t.Helper()
+
+    var tasks []models.Task
+    if err := CalendarTasks(db, userID).Find(&tasks).Error; err != nil {
+        t.Fatal(err)
+    }
+    titles := make([]string, len(tasks))
+    for i := range tasks {
+        titles[i] = tasks[i].Title
+    }
+    sort.Strings(titles)
+    return titles
+}
+
+func TestCalendarTasksFollowAssignee(t *testing.T) {
+    db, workspaceID := newWorkspaceSyncTest(t)
+    two := uint(2)
+    three := uint(3)
+
+    for _, task := range []models.Task{
+        {UserID: 1, Title: "Personal"},
+        {UserID: 2, Title: "Theirs"},
+        {UserID: 1, WorkspaceID: &workspaceID, Title: "Created"},
+        {UserID: 1, WorkspaceID: &workspaceID, AssigneeID: &two, Title: "Assigned"},
+        {UserID: 3, WorkspaceID: &workspaceID, Title: "Left behind"},
+        {UserID: 1, WorkspaceID: &workspaceID, AssigneeID: &three, Title: "Stale assignee"},
+    } {
+        if err := db.Create(&task).Error; err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    for _, tc := range []struct {
+        userID uint
+        want   string
+    }{
+        {1, "[Created Personal]"},
+        {2, "[Assigned Theirs]"},
+        {3, "[]"},
+    } {
+        if got := calendarTaskTitles(t, db, tc.userID); fmt.Sprint(got) != tc.want {
+            t.Errorf("user %d: got %v, want %s", tc.userID, got, tc.want)
+        }
+    }
+
+    var tasks []models.Task
+    if err := db.Where("workspace_id IS NOT NULL").Order("id").Find(&tasks).Error; err != nil {
+        t.Fatal(err)
+    }
+    for i, want := range []uint{1, 2, 0, 0} {
+        got, err := CalendarOwner(db, &tasks[i])
+        if err != nil {
+            t.Fatal(err)
+        }
+        if got != want {
+            t.Errorf("%s: got owner %d, want %d", tasks[i].Title, got, want)
+        }
+    }
+}
+
+func TestAssignTaskQueuesCalendarSync(t *testing.T) {
+    db, workspaceID := newWorkspaceSyncTest(t)
+
+    task := models.Task{UserID: 1, WorkspaceID: &workspaceID, Title: "Write report"}
+    if err := db.Create(&task).Error; err != nil {
+        t.Fatal(err)
+    }
+
+    two := uint(2)
+    if err := AssignTask(db, &task, &two, 1); err != nil {
+        t.Fatal(err)
+    }
+
+    var jobs int64
+    if err := db.Model(&models.SyncJob{}).Where("task_id = ? AND status = ?", task.ID, SyncJobPending).Count(&jobs).Error; err != nil {
+        t.Fatal(err)
+    }
+    if jobs != 1 {
+        t.Errorf("got %d pending sync jobs, want 1", jobs)
+    }
+    if got := calendarTaskTitles(t, db, 2); fmt.Sprint(got) != "[Write report]" {
+        t.Errorf("assignee's calendar: got %v", got)
+    }
+    if got := calendarTaskTitles(t, db, 1); fmt.Sprint(got) != "[]" {
+        t.Errorf("creator's calendar: got %v", got)
+    }
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "taskflow/internal/models"
+
+    "gorm.io/gorm"
+)
+
+// ErrTaskVersionConflict is returned when a task changed after it was read.
+var ErrTaskVersionConflict = errors.New("task was modified by someone else")
+
+// SaveTask writes all fields of a task and increments its version, creating
+// it when it has no ID yet. An existing task is only written if it still has
+// the version it was read at, otherwise ErrTaskVersionConflict is returned.
+// A task without a position goes to the bottom of its status column.
+func SaveTask(tx *gorm.DB, task *models.Task) error {
+    if task.Position == "" {
+        position, err := AppendPosition(tx, TaskSpace(task), task.Status)
+        if err != nil {
+            return err
+        }
+        task.Position = position
+    }
+
+    if task.ID == 0 {
+        task.Version = 1
+        return tx.Create(task).Error
+    }
+
+    version := task.Version
+    task.Version++
+    result := tx.Model(task).Where("version = ?", version).Select("*").Updates(task)
+    if result.Error == nil && result.RowsAffected == 0 {
+        result.Error = ErrTaskVersionConflict
+    }
+    if result.Error != nil {
+        task.Version = version
+        return result.Error
+    }
+    return nil
+}
+
+// TaskETag is the entity tag of a task's JSON representation.
+func TaskETag(task *models.Task) string {
+    return fmt.Sprintf(`"%d-%d"`, task.ID, task.Version)
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "taskflow/internal/ical"
+    "taskflow/internal/models"
+)
+
+// TaskVTodo renders a task as a VTODO (RFC 5545 section 3.6.2).
+func TaskVTodo(task *models.Task) *ical.Component {
+    vtodo := ical.NewComponent("VTODO")
+    vtodo.Set("UID", fmt.Sprintf("todo-%d@taskflow", task.ID))
+    vtodo.Set("DTSTAMP", ical.FormatTime(task.UpdatedAt))
+    vtodo.Set("CREATED", ical.FormatTime(task.CreatedAt))
+    vtodo.Set("LAST-MODIFIED", ical.FormatTime(task.UpdatedAt))
+    vtodo.SetText("SUMMARY", task.Title)
+    if task.Description != "" {
+        vtodo.SetText("DESCRIPTION", task.Description)
+    }
+    if task.DueDate != nil {
+        vtodo.SetTime("DUE", *task.DueDate, task.DueDateAllDay)
+        for _, rule := range eventRecurrence(task) {
+            vtodo.Set("RRULE", strings.TrimPrefix(rule, "RRULE:"))
+        }
+    }
+    vtodo.Set("STATUS", todoStatus(task.Status))
+    if priority := todoPriority(task.Priority); priority != 0 {
+        vtodo.Set("PRIORITY", fmt.Sprint(priority))
+    }
+    if task.Status == models.StatusCompleted {
+        vtodo.Set("PERCENT-COMPLETE", "100")
+    }
+    return vtodo
+}
+
+// todoStatus maps task statuses to VTODO STATUS values.
+func todoStatus(status string) string {
+    switch status {
+    case models.StatusInProgress:
+        return "IN-PROCESS"
+    case models.StatusCompleted:
+        return "COMPLETED"
+    default:
+        return "NEEDS-ACTION"
+    }
+}
+
+// todoPriority maps task priorities to the 1 (highest) to 9 (lowest) VTODO
+// scale, using the high/medium/low points RFC 5545 suggests.
+func todoPriority(priority string) int {
+    switch priority {
+    case models.PriorityHigh:
+        return 1
+    case models.PriorityMedium:
+        return 5
+    case models.PriorityLow:
+        return 9
+    default:
+        return 0
+    }
+}
+
+// ApplyVTodo copies the fields TaskFlow keeps from a VTODO onto a task.
+// Everything else in the VTODO (alarms, categories, ...) is dropped.
+func ApplyVTodo(task *models.Task, vtodo *ical.Component) error {
+    task.Title = strings.TrimSpace(vtodo.Text("SUMMARY"))
+    if task.Title == "" {
+        task.Title = "Untitled"
+    }
+    task.Description = vtodo.Text("DESCRIPTION")
+
+    due, allDay, ok, err := vtodo.Time("DUE")
+    if err != nil {
+        return fmt.Errorf("invalid DUE: %w", err)
+    }
+    if ok {
+        task.DueDate = &due
+        task.DueDateAllDay = allDay
+    } else {
+        task.DueDate = nil
+        task.DueDateAllDay = false
+    }
+
+    if prop := vtodo.Get("RRULE"); prop != nil {
+        applyRecurrence(task, prop.Value)
+    } else if task.RecurFrom != models.RecurFromCompletion {
+        // Rules repeating from the completion aren't sent to clients
+        task.Recurrence = ""
+    }
+
+    task.Status = taskStatus(vtodo)
+
+    task.Priority = models.PriorityMedium
+    if prop := vtodo.Get("PRIORITY"); prop != nil {
+        if priority, err := strconv.Atoi(strings.TrimSpace(prop.Value)); err == nil {
+            task.Priority = taskPriority(priority)
+        }
+    }
+    return nil
+}
+
+// taskStatus maps VTODO STATUS back to a task status. Cancelled to-dos are
+// treated as done, TaskFlow has no separate state for them.
+func taskStatus(vtodo *ical.Component) string {
+    status := ""
+    if prop := vtodo.Get("STATUS"); prop != nil {
+        status = strings.ToUpper(strings.TrimSpace(prop.Value))
+    }
+
+    switch {
+    case status == "IN-PROCESS":
+        return models.StatusInProgress
+    case status == "COMPLETED" || status == "CANCELLED":
+        return models.StatusCompleted
+    case status == "" && vtodo.Get("COMPLETED") != nil:
+        return models.StatusCompleted
+    default:
+        return models.StatusPending
+    }
+}
+
+// taskPriority maps the VTODO 1-9 scale onto the three task priorities;
+// 0 means undefined.
+func taskPriority(priority int) string {
+    switch {
+    case priority >= 1 && priority <= 4:
+        return models.PriorityHigh
+    case priority >= 6 && priority <= 9:
+        return models.PriorityLow
+    default:
+        return models.PriorityMedium
+    }
+}
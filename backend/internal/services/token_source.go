@@ -0,0 +1,117 @@
+package services
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "sync"
+    "taskflow/internal/models"
+
+    "golang.org/x/oauth2"
+    "gorm.io/gorm"
+)
+
+// connectionTokenSource wraps the oauth2 refreshing token source and writes
+// every refreshed token back to the connection, so the next request starts
+// from the fresh token instead of refreshing again.
+type connectionTokenSource struct {
+    db   *gorm.DB
+    conn *models.CalendarConnection
+    base oauth2.TokenSource
+
+    mu      sync.Mutex
+    current *oauth2.Token
+}
+
+// newConnectionTokenSource returns a token source for the connection's
+// stored OAuth token. Refreshed tokens are saved to the connection; a
+// revoked refresh token disables the connection and records the reason.
+func newConnectionTokenSource(db *gorm.DB, config *oauth2.Config, conn *models.CalendarConnection) (oauth2.TokenSource, error) {
+    token, err := decodeOAuthToken(conn)
+    if err != nil {
+        return nil, err
+    }
+
+    return &connectionTokenSource{
+        db:      db,
+        conn:    conn,
+        base:    config.TokenSource(context.Background(), token),
+        current: token,
+    }, nil
+}
+
+func (ts *connectionTokenSource) Token() (*oauth2.Token, error) {
+    ts.mu.Lock()
+    defer ts.mu.Unlock()
+
+    token, err := ts.base.Token()
+    if err != nil {
+        var retrieveErr *oauth2.RetrieveError
+        if errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "invalid_grant" {
+            disableConnection(ts.db, ts.conn, "Calendar access was revoked, reconnect to resume sync")
+            return nil, ErrCredentialsRevoked
+        }
+        return nil, err
+    }
+
+    if token.AccessToken != ts.current.AccessToken {
+        ts.save(token)
+    }
+    ts.current = token
+
+    return token, nil
+}
+
+func (ts *connectionTokenSource) save(token *oauth2.Token) {
+    credentials, err := encodeOAuthToken(ts.conn, token)
+    if err != nil {
+        log.Printf("failed to serialize refreshed token for connection %d: %v", ts.conn.ID, err)
+        return
+    }
+
+    // Saving is best effort: the refreshed token is still valid in memory
+    err = ts.db.Model(&models.CalendarConnection{}).Where("id = ?", ts.conn.ID).
+        UpdateColumn("credentials", credentials).Error
+    if err != nil {
+        log.Printf("failed to save refreshed token for connection %d: %v", ts.conn.ID, err)
+        return
+    }
+
+    ts.conn.Credentials = credentials
+}
+
+// decodeOAuthToken reads the token stored in conn.Credentials, which is the
+// token JSON encrypted at rest.
+func decodeOAuthToken(conn *models.CalendarConnection) (*oauth2.Token, error) {
+    tokenJSON, err := DecryptCredentials(conn)
+    if err != nil {
+        return nil, fmt.Errorf("unable to decrypt token: %w", err)
+    }
+
+    token := &oauth2.Token{}
+    if err := json.Unmarshal([]byte(tokenJSON), token); err != nil {
+        return nil, err
+    }
+    return token, nil
+}
+
+// encodeOAuthToken encrypts a token for storage in conn.Credentials.
+func encodeOAuthToken(conn *models.CalendarConnection, token *oauth2.Token) (string, error) {
+    tokenJSON, err := oauthTokenJSON(token)
+    if err != nil {
+        return "", err
+    }
+    return EncryptCredentials(conn, tokenJSON)
+}
+
+// oauthTokenJSON is the plaintext form of the credentials of OAuth
+// connections.
+func oauthTokenJSON(token *oauth2.Token) (string, error) {
+    data, err := json.Marshal(token)
+    if err != nil {
+        return "", err
+    }
+    return string(data), nil
+}
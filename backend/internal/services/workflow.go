@@ -0,0 +1,151 @@
+package services
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "strings"
+    "sync"
+    "taskflow/internal/models"
+)
+
+// Workflow defines how tasks move between statuses. Transitions maps each
+// status to the statuses a task in it may move to. Tasks start in Initial,
+// or in any status Initial may move to.
+type Workflow struct {
+    Name        string              `json:"name"`
+    Initial     string              `json:"initial"`
+    Transitions map[string][]string `json:"transitions"`
+}
+
+// DefaultWorkflow is deliberately permissive: tasks may be started and
+// finished in any order, a pending task may be completed straight from the
+// list or the board, and a completed task is reopened to pending. A stricter
+// flow such as pending → in_progress → completed is configured with a
+// TASK_WORKFLOW file, see workflows/strict.json.
+var DefaultWorkflow = &Workflow{
+    Name:    "default",
+    Initial: models.StatusPending,
+    Transitions: map[string][]string{
+        models.StatusPending:    {models.StatusInProgress, models.StatusCompleted},
+        models.StatusInProgress: {models.StatusPending, models.StatusCompleted},
+        models.StatusCompleted:  {models.StatusPending},
+    },
+}
+
+// TransitionError is a status change the workflow doesn't allow. From is
+// empty for a task being created.
+type TransitionError struct {
+    From    string
+    To      string
+    Allowed []string
+}
+
+func (e *TransitionError) Error() string {
+    if e.From == "" {
+        return fmt.Sprintf("tasks can't be created as %s", e.To)
+    }
+    return fmt.Sprintf("tasks can't move from %s to %s", e.From, e.To)
+}
+
+// CanCreate checks that a task may start in status.
+func (w *Workflow) CanCreate(status string) error {
+    allowed := append([]string{w.Initial}, w.Transitions[w.Initial]...)
+    for _, s := range allowed {
+        if s == status {
+            return nil
+        }
+    }
+    return &TransitionError{To: status, Allowed: allowed}
+}
+
+// CanTransition checks that a task may move from one status to another.
+// Staying in the same status is always allowed.
+func (w *Workflow) CanTransition(from, to string) error {
+    if from == to {
+        return nil
+    }
+
+    allowed := w.Transitions[from]
+    for _, s := range allowed {
+        if s == to {
+            return nil
+        }
+    }
+    return &TransitionError{From: from, To: to, Allowed: append([]string{}, allowed...)}
+}
+
+// Validate checks that the workflow only refers to known statuses.
+func (w *Workflow) Validate() error {
+    if !models.ValidTaskStatus(w.Initial) {
+        return fmt.Errorf("invalid initial status %q", w.Initial)
+    }
+    for from, targets := range w.Transitions {
+        if !models.ValidTaskStatus(from) {
+            return fmt.Errorf("invalid status %q", from)
+        }
+        for _, to := range targets {
+            if !models.ValidTaskStatus(to) {
+                return fmt.Errorf("invalid status %q in transitions from %s", to, from)
+            }
+        }
+    }
+    return nil
+}
+
+// LoadWorkflow reads a workflow definition from a JSON file.
+func LoadWorkflow(path string) (*Workflow, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    var workflow Workflow
+    if err := json.Unmarshal(data, &workflow); err != nil {
+        return nil, fmt.Errorf("invalid workflow %s: %w", path, err)
+    }
+    if err := workflow.Validate(); err != nil {
+        return nil, fmt.Errorf("invalid workflow %s: %w", path, err)
+    }
+    if workflow.Name == "" {
+        workflow.Name = strings.TrimSuffix(path, ".json")
+    }
+    return &workflow, nil
+}
+
+var (
+    configuredWorkflow     *Workflow
+    configuredWorkflowErr  error
+    configuredWorkflowOnce sync.Once
+)
+
+// loadTaskWorkflow reads the TASK_WORKFLOW file once.
+func loadTaskWorkflow() (*Workflow, error) {
+    configuredWorkflowOnce.Do(func() {
+        configuredWorkflow = DefaultWorkflow
+
+        path := os.Getenv("TASK_WORKFLOW")
+        if path == "" {
+            return
+        }
+        configuredWorkflow, configuredWorkflowErr = LoadWorkflow(path)
+    })
+    return configuredWorkflow, configuredWorkflowErr
+}
+
+// CheckTaskWorkflow reports whether the TASK_WORKFLOW file is valid, so a
+// broken file stops the server at startup instead of being ignored.
+func CheckTaskWorkflow() error {
+    _, err := loadTaskWorkflow()
+    return err
+}
+
+// TaskWorkflow returns the workflow tasks follow: the one defined in the
+// TASK_WORKFLOW file, or DefaultWorkflow. All tasks share it for now.
+func TaskWorkflow() *Workflow {
+    workflow, err := loadTaskWorkflow()
+    if err != nil {
+        return DefaultWorkflow
+    }
+    return workflow
+}
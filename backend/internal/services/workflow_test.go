@@ -0,0 +1,94 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "taskflow/internal/models"
+)
+
+func TestWorkflowTransitions(t *testing.T) {
+    strict, err := LoadWorkflow("../../workflows/strict.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    for _, tc := range []struct {
+        workflow *Workflow
+        from, to string
+        allowed  string
+    }{
+        {DefaultWorkflow, "", models.StatusPending, ""},
+        {DefaultWorkflow, "", models.StatusCompleted, ""},
+        {DefaultWorkflow, models.StatusPending, models.StatusCompleted, ""},
+        {DefaultWorkflow, models.StatusCompleted, models.StatusCompleted, ""},
+        {DefaultWorkflow, models.StatusCompleted, models.StatusInProgress, "[pending]"},
+        {strict, "", models.StatusInProgress, ""},
+        {strict, "", models.StatusCompleted, "[pending in_progress]"},
+        {strict, models.StatusPending, models.StatusCompleted, "[in_progress]"},
+        {strict, models.StatusInProgress, models.StatusCompleted, ""},
+        {strict, models.StatusCompleted, models.StatusPending, "[in_progress]"},
+    } {
+        if tc.from == "" {
+            err = tc.workflow.CanCreate(tc.to)
+        } else {
+            err = tc.workflow.CanTransition(tc.from, tc.to)
+        }
+
+        var transition *TransitionError
+        switch {
+        case tc.allowed == "" && err != nil:
+            t.Errorf("%s: %q → %s: got %v, want allowed", tc.workflow.Name, tc.from, tc.to, err)
+        case tc.allowed != "" && !errors.As(err, &transition):
+            t.Errorf("%s: %q → %s: got %v, want a TransitionError", tc.workflow.Name, tc.from, tc.to, err)
+        case tc.allowed != "" && fmt.Sprint(transition.Allowed) != tc.allowed:
+            t.Errorf("%s: %q → %s: got allowed %v, want %s", tc.workflow.Name, tc.from, tc.to, transition.Allowed, tc.allowed)
+        }
+    }
+}
+
+func TestLoadWorkflow(t *testing.T) {
+    dir := t.TempDir()
+    write := func(name, content string) string {
+        path := filepath.Join(dir, name)
+        if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+            t.Fatal(err)
+        }
+        return path
+    }
+
+    workflow, err := LoadWorkflow(write("review.json", `{"initial": "pending", "transitions": {"pending": ["completed"]}}`))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !strings.HasSuffix(workflow.Name, "review") {
+        t.Errorf("got name %q, want it taken from the file", workflow.Name)
+    }
+
+    for _, tc := range []struct {
+        name, content, want string
+    }{
+        {"syntax.json", `{"initial": `, "invalid workflow"},
+        {"initial.json", `{"initial": "todo"}`, `invalid initial status "todo"`},
+        {"from.json", `{"initial": "pending", "transitions": {"done": ["pending"]}}`, `invalid status "done"`},
+        {"to.json", `{"initial": "pending", "transitions": {"pending": ["done"]}}`, `invalid status "done" in transitions from pending`},
+    } {
+        if _, err := LoadWorkflow(write(tc.name, tc.content)); err == nil || !strings.Contains(err.Error(), tc.want) {
+            t.Errorf("%s: got %v, want %q", tc.name, err, tc.want)
+        }
+    }
+
+    if _, err := LoadWorkflow(filepath.Join(dir, "missing.json")); !errors.Is(err, os.ErrNotExist) {
+        t.Errorf("missing file: got %v", err)
+    }
+}
+
+// useWorkflow makes TaskWorkflow return workflow for the rest of a test.
+func useWorkflow(t *testing.T, workflow *Workflow) {
+    loadTaskWorkflow()
+    configuredWorkflow, configuredWorkflowErr = workflow, nil
+    t.Cleanup(func() { configuredWorkflow = DefaultWorkflow })
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+    "errors"
+    "taskflow/internal/models"
+
+    "gorm.io/gorm"
+)
+
+var (
+    ErrNotMember      = errors.New("not a member of this workspace")
+    ErrAlreadyMember  = errors.New("user is already a member of this workspace")
+    ErrOwnerRequired  = errors.New("only the owner can hand out or take away the owner and admin roles")
+    ErrOwnerCantLeave = errors.New("the owner has to hand the workspace over before leaving it")
+    ErrOwnerRole      = errors.New("the owner's role only changes by handing the workspace to someone else")
+)
+
+// Permission is something a role allows in a space. Each one includes the
+// ones before it.
+type Permission int
+
+const (
+    // PermView reads tasks, projects and labels
+    PermView Permission = iota
+    // PermEdit creates, changes and deletes them
+    PermEdit
+    // PermManage renames the workspace and adds, removes and changes
+    // members below admin
+    PermManage
+    // PermOwn deletes the workspace and hands out the owner and admin roles
+    PermOwn
+)
+
+var rolePermissions = map[string]Permission{
+    models.RoleOwner:  PermOwn,
+    models.RoleAdmin:  PermManage,
+    models.RoleMember: PermEdit,
+    models.RoleViewer: PermView,
+}
+
+// Space is where tasks, projects and labels live: a workspace, or the
+// personal space of a user when WorkspaceID is nil.
+type Space struct {
+    UserID      uint
+    WorkspaceID *uint
+}
+
+// TaskSpace is the space a task is in.
+func TaskSpace(task *models.Task) Space {
+    return Space{UserID: task.UserID, WorkspaceID: task.WorkspaceID}
+}
+
+// Scope limits a query of tasks, projects or labels to those of the space.
+func (s Space) Scope(db *gorm.DB) *gorm.DB {
+    if s.WorkspaceID != nil {
+        return db.Where("workspace_id = ?", *s.WorkspaceID)
+    }
+    return db.Where("user_id = ? AND workspace_id IS NULL", s.UserID)
+}
+
+// Access is what a user may do in the space they work in. Users own their
+// personal space.
+type Access struct {
+    Space
+    Role string
+}
+
+// PersonalAccess is a user's access to their own tasks.
+func PersonalAccess(userID uint) *Access {
+    return &Access{Space: Space{UserID: userID}, Role: models.RoleOwner}
+}
+
+// WorkspaceAccess is a user's access to a workspace, ErrNotMember when they
+// have none.
+func WorkspaceAccess(db *gorm.DB, userID, workspaceID uint) (*Access, error) {
+    var member models.WorkspaceMember
+    err := db.Joins("JOIN workspaces ON workspaces.id = workspace_members.workspace_id AND workspaces.deleted_at IS NULL").
+        Where("workspace_members.workspace_id = ? AND workspace_members.user_id = ?", workspaceID, userID).
+        First(&member).Error
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, ErrNotMember
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &Access{Space: Space{UserID: userID, WorkspaceID: &workspaceID}, Role: member.Role}, nil
+}
+
+// Can reports whether the user's role allows perm.
+func (a *Access) Can(perm Permission) bool {
+    allowed, ok := rolePermissions[a.Role]
+    return ok && perm <= allowed
+}
+
+// CanEditTask reports whether a user may change a task: one of their own,
+// or one of a workspace where their role allows editing.
+func CanEditTask(db *gorm.DB, userID uint, task *models.Task) (bool, error) {
+    if task.WorkspaceID == nil {
+        return task.UserID == userID, nil
+    }
+
+    access, err := WorkspaceAccess(db, userID, *task.WorkspaceID)
+    if errors.Is(err, ErrNotMember) {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+    return access.Can(PermEdit), nil
+}
+
+// CreateWorkspace creates a workspace owned by a user.
+func CreateWorkspace(tx *gorm.DB, workspace *models.Workspace, ownerID uint) error {
+    if err := tx.Create(workspace).Error; err != nil {
+        return err
+    }
+    return tx.Create(&models.WorkspaceMember{
+        WorkspaceID: workspace.ID,
+        UserID:      ownerID,
+        Role:        models.RoleOwner,
+    }).Error
+}
+
+// AddMember gives a user a role in the workspace of access. Only the owner
+// can add admins, and nobody is added as owner.
+func AddMember(tx *gorm.DB, access *Access, userID uint, role string) (*models.WorkspaceMember, error) {
+    if role == models.RoleOwner || (role == models.RoleAdmin && !access.Can(PermOwn)) {
+        return nil, ErrOwnerRequired
+    }
+
+    var existing int64
+    err := tx.Model(&models.WorkspaceMember{}).
+        Where("workspace_id = ? AND user_id = ?", *access.WorkspaceID, userID).
+        Count(&existing).Error
+    if err != nil {
+        return nil, err
+    }
+    if existing > 0 {
+        return nil, ErrAlreadyMember
+    }
+
+    member := models.WorkspaceMember{WorkspaceID: *access.WorkspaceID, UserID: userID, Role: role}
+    if err := tx.Create(&member).Error; err != nil {
+        return nil, err
+    }
+    return &member, nil
+}
+
+// SetMemberRole changes the role of a member. Admins change members and
+// viewers; the owner also admins, and hands the workspace over by making
+// someone else owner, staying on as admin.
+func SetMemberRole(tx *gorm.DB, access *Access, member *models.WorkspaceMember, role string) error {
+    if member.Role == role {
+        return nil
+    }
+    if member.Role == models.RoleOwner {
+        return ErrOwnerRole
+    }
+    if !access.Can(PermOwn) && (member.Role == models.RoleAdmin || role == models.RoleOwner || role == models.RoleAdmin) {
+        return ErrOwnerRequired
+    }
+
+    if role == models.RoleOwner {
+        err := tx.Model(&models.WorkspaceMember{}).
+            Where("workspace_id = ? AND user_id = ?", member.WorkspaceID, access.UserID).
+            Update("role", models.RoleAdmin).Error
+        if err != nil {
+            return err
+        }
+    }
+    member.Role = role
+    return tx.Model(member).Update("role", role).Error
+}
+
+// RemoveMember takes a user out of a workspace, unassigning their tasks.
+// Anyone but the owner may leave; admins remove members and viewers, the
+// owner anyone else.
+func RemoveMember(tx *gorm.DB, access *Access, member *models.WorkspaceMember) error {
+    if member.Role == models.RoleOwner {
+        return ErrOwnerCantLeave
+    }
+    if member.UserID != access.UserID && member.Role == models.RoleAdmin && !access.Can(PermOwn) {
+        return ErrOwnerRequired
+    }
+    if err := unassignMember(tx, member.WorkspaceID, member.UserID, access.UserID); err != nil {
+        return err
+    }
+    return tx.Delete(member).Error
+}
+
+// DeleteWorkspace deletes a workspace with its members, tasks, projects and
+// labels. The tasks' events are removed from their members' calendars.
+func DeleteWorkspace(tx *gorm.DB, workspace *models.Workspace) error {
+    var synced []models.Task
+    err := tx.Where("workspace_id = ? AND id IN (?)", workspace.ID, tx.Model(&models.TaskEventMapping{}).Select("task_id")).
+        Find(&synced).Error
+    if err != nil {
+        return err
+    }
+    for i := range synced {
+        if err := EnqueueTaskSync(tx, &synced[i]); err != nil {
+            return err
+        }
+    }
+
+    labels := tx.Model(&models.Label{}).Select("id").Where("workspace_id = ?", workspace.ID)
+    if err := tx.Where("label_id IN (?)", labels).Delete(&models.TaskLabel{}).Error; err != nil {
+        return err
+    }
+    if err := tx.Where("workspace_id = ?", workspace.ID).Delete(&models.Label{}).Error; err != nil {
+        return err
+    }
+    if err := tx.Where("workspace_id = ?", workspace.ID).Delete(&models.Task{}).Error; err != nil {
+        return err
+    }
+    if err := tx.Where("workspace_id = ?", workspace.ID).Delete(&models.Project{}).Error; err != nil {
+        return err
+    }
+    if err := tx.Where("workspace_id = ?", workspace.ID).Delete(&models.WorkspaceMember{}).Error; err != nil {
+        return err
+    }
+    return tx.Delete(workspace).Error
+}
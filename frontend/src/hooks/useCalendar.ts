@@ -1,5 +1,5 @@
 import { useState, useEffect } from 'react';
-import { CalendarEvent } from '../services/calendarApi';
+import { CalendarEvent, calendarService } from '../services/calendarApi';
 
 export const useCalendar = () => {
   const [events, setEvents] = useState<CalendarEvent[]>([]);
@@ -14,17 +14,8 @@ export const useCalendar = () => {
   const loadEvents = async () => {
     try {
       setLoading(true);
-      // Mock data for now
-      const mockEvents: CalendarEvent[] = [
-        {
-          id: '1',
-          title: 'Team Meeting',
-          start: new Date().toISOString(),
-          end: new Date(Date.now() + 60 * 60 * 1000).toISOString(),
-          description: 'Weekly team sync',
-        },
-      ];
-      setEvents(mockEvents);
+      const response = await calendarService.getEvents();
+      setEvents(response.data);
     } catch (err) {
       setError('Failed to load events');
     } finally {
@@ -34,12 +25,9 @@ export const useCalendar = () => {
 
   const createEvent = async (event: Omit<CalendarEvent, 'id'>) => {
     try {
-      const newEvent: CalendarEvent = {
-        ...event,
-        id: Date.now().toString(),
-      };
-      setEvents(prev => [...prev, newEvent]);
-      return newEvent;
+      const response = await calendarService.createEvent(event);
+      setEvents(prev => [...prev, response.data]);
+      return response.data;
     } catch (err) {
       setError('Failed to create event');
       throw err;
@@ -48,8 +36,9 @@ export const useCalendar = () => {
 
   const updateEvent = async (id: string, eventData: Partial<CalendarEvent>) => {
     try {
-      setEvents(prev => prev.map(event => 
-        event.id === id ? { ...event, ...eventData } : event
+      const response = await calendarService.updateEvent(id, eventData);
+      setEvents(prev => prev.map(event =>
+        event.id === id ? response.data : event
       ));
     } catch (err) {
       setError('Failed to update event');
@@ -59,6 +48,7 @@ export const useCalendar = () => {
 
   const deleteEvent = async (id: string) => {
     try {
+      await calendarService.deleteEvent(id);
       setEvents(prev => prev.filter(event => event.id !== id));
     } catch (err) {
       setError('Failed to delete event');
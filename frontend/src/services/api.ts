@@ -15,6 +15,7 @@ export interface Task {
   status: 'pending' | 'in_progress' | 'completed';
   priority: 'low' | 'medium' | 'high';
   due_date?: string;
+  version?: number;
   created_at: string;
   updated_at: string;
 }
@@ -31,7 +32,9 @@ export const taskService = {
   create: (task: Omit<Task, 'id' | 'created_at' | 'updated_at'>) => 
     api.post<Task>('/tasks', task),
   update: (id: string, task: Partial<Task>) => 
-    api.put<Task>(`/tasks/${id}`, task),
+    api.patch<Task>(`/tasks/${id}`, task, {
+      headers: { 'Content-Type': 'application/merge-patch+json' },
+    }),
   delete: (id: string) => api.delete(`/tasks/${id}`),
 };
 
@@ -6,11 +6,14 @@ export interface CalendarEvent {
   start: string;
   end: string;
   description?: string;
+  all_day?: boolean;
   task_id?: string;
+  provider?: string;
 }
 
 export const calendarService = {
-  getEvents: () => api.get<CalendarEvent[]>('/calendar/events'),
+  getEvents: (params?: { start?: string; end?: string }) =>
+    api.get<CalendarEvent[]>('/calendar/events', { params }),
   createEvent: (event: Omit<CalendarEvent, 'id'>) => 
     api.post<CalendarEvent>('/calendar/events', event),
   updateEvent: (id: string, event: Partial<CalendarEvent>) => 